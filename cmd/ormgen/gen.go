@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	beginMarker = "// ormgen:begin"
+	endMarker   = "// ormgen:end"
+	header      = "// Code generated by ormgen. Only the block between the ormgen:begin and ormgen:end markers is regenerated,\n// code outside the block is kept.\n"
+
+	ormPkg = "github.com/d0ngw/go/orm"
+)
+
+// options 生成的选项
+type options struct {
+	pkg    string         //包名
+	trim   string         //生成结构体名称及文件名时去掉的表名前缀
+	shard  *regexp.Regexp //分表的表名,第一个分组为逻辑表名,为nil时不识别分表
+	tables []string       //要生成的表,支持path.Match的通配符,为空时生成所有的表
+}
+
+// entity 要生成的实体
+type entity struct {
+	name    string   //结构体名称
+	table   string   //逻辑表名
+	comment string   //表的注释
+	shards  []string //分表的表名,不为空时嵌入orm.BaseShardEntity
+	fields  []*field
+	pk      *column
+	source  *table
+}
+
+// field 实体的字段
+type field struct {
+	name    string
+	typ     string
+	tags    [][2]string
+	comment string
+}
+
+// generatedTags ormgen生成的tag,重新生成时其他的tag被保留
+var generatedTags = map[string]bool{"column": true, "pk": true, "pkAuto": true, "type": true, "size": true, "nullable": true, "index": true, "unique": true}
+
+// buildEntities 根据表生成实体,匹配opts.shard的多个表合并为一个分表的实体;没有主键或者是联合主键的表被忽略
+func buildEntities(tables []*table, opts *options) (entities []*entity, warnings []string) {
+	groups := map[string][]*table{}
+	for _, t := range tables {
+		if opts.shard != nil {
+			if m := opts.shard.FindStringSubmatch(t.name); len(m) > 1 && m[1] != "" {
+				groups[m[1]] = append(groups[m[1]], t)
+			}
+		}
+	}
+	done := map[string]bool{}
+	for _, t := range tables {
+		name, shards := t.name, []*table{t}
+		if opts.shard != nil {
+			if m := opts.shard.FindStringSubmatch(t.name); len(m) > 1 && len(groups[m[1]]) > 1 {
+				name, shards = m[1], groups[m[1]]
+			}
+		}
+		if done[name] || !matchTables(opts.tables, name, t.name) {
+			continue
+		}
+		done[name] = true
+
+		e := &entity{name: structName(strings.TrimPrefix(name, opts.trim)), table: name, comment: t.comment, source: shards[0]}
+		if len(shards) > 1 {
+			sort.Slice(shards, func(i, j int) bool {
+				a, b := shards[i].name, shards[j].name
+				return len(a) < len(b) || len(a) == len(b) && a < b
+			})
+			e.source = shards[0]
+			for _, shard := range shards {
+				e.shards = append(e.shards, shard.name)
+				if columnsSignature(shard) != columnsSignature(e.source) {
+					warnings = append(warnings, fmt.Sprintf("columns of %s differ from %s,use %s", shard.name, e.source.name, e.source.name))
+				}
+			}
+		}
+		if e.pk = e.source.pk(); e.pk == nil {
+			warnings = append(warnings, fmt.Sprintf("skip table %s without single column primary key", e.source.name))
+			continue
+		}
+		entities = append(entities, e)
+	}
+	return
+}
+
+// matchTables 表名是否匹配patterns
+func matchTables(patterns []string, names ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func columnsSignature(t *table) string {
+	var b strings.Builder
+	for _, col := range t.columns {
+		b.WriteString(col.name + " " + col.columnType + " " + strconv.FormatBool(col.nullable) + ";")
+	}
+	return b.String()
+}
+
+// commonInitialisms 转换为驼峰命名时全部大写的单词
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true, "GUID": true, "HTML": true, "HTTP": true,
+	"HTTPS": true, "ID": true, "IP": true, "JSON": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true, "SLA": true,
+	"SMTP": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true,
+	"URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true, "XSS": true,
+}
+
+// structName 将下划线分隔的名称转换为驼峰命名
+func structName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			b.WriteString(upper)
+		} else {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	s := b.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "T" + s
+	}
+	return s
+}
+
+// fileName 实体的文件名,避免以_test或者GOOS,GOARCH结尾
+func fileName(e *entity, opts *options) string {
+	name := strings.ToLower(strings.TrimPrefix(e.table, opts.trim))
+	if i := strings.LastIndexByte(name, '_'); i >= 0 && buildSuffixes[name[i+1:]] {
+		name += "_entity"
+	}
+	return name + ".go"
+}
+
+var buildSuffixes = map[string]bool{
+	"test": true, "aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true, "illumos": true, "ios": true,
+	"js": true, "linux": true, "nacl": true, "netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+	"386": true, "amd64": true, "arm": true, "arm64": true, "loong64": true, "mips": true, "mips64": true, "mips64le": true, "mipsle": true,
+	"ppc64": true, "ppc64le": true, "riscv64": true, "s390x": true, "wasm": true,
+}
+
+// goType 列对应的Go类型
+func goType(col *column, pk bool) string {
+	nullable := col.nullable && !pk
+	unsigned := strings.Contains(strings.ToLower(col.columnType), "unsigned")
+	pick := func(signed, unsignedType, null string) string {
+		switch {
+		case nullable:
+			return null
+		case unsigned:
+			return unsignedType
+		}
+		return signed
+	}
+	switch strings.ToLower(col.dataType) {
+	case "tinyint":
+		if strings.HasPrefix(strings.ToLower(col.columnType), "tinyint(1)") {
+			return pick("bool", "bool", "sql.NullBool")
+		}
+		return pick("int8", "uint8", "sql.NullInt16")
+	case "smallint", "year":
+		return pick("int16", "uint16", "sql.NullInt32")
+	case "mediumint", "int", "integer":
+		return pick("int32", "uint32", "sql.NullInt64")
+	case "bigint":
+		return pick("int64", "uint64", "sql.NullInt64")
+	case "float":
+		return pick("float32", "float32", "sql.NullFloat64")
+	case "double", "real", "decimal", "numeric":
+		return pick("float64", "float64", "sql.NullFloat64")
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set", "json", "time":
+		return pick("string", "string", "sql.NullString")
+	case "date", "datetime", "timestamp":
+		return pick("time.Time", "time.Time", "sql.NullTime")
+	}
+	return "[]byte"
+}
+
+// inferredType orm根据Go类型推断的MySQL列类型及是否允许NULL,参见orm.CreateTableSQL
+func inferredType(typ string, size int64) (sqlType string, nullable bool, ok bool) {
+	switch typ {
+	case "bool":
+		return "tinyint(1)", false, true
+	case "sql.NullBool":
+		return "tinyint(1)", true, true
+	case "int8", "uint8":
+		return "tinyint", false, true
+	case "sql.NullByte":
+		return "tinyint unsigned", true, true
+	case "int16", "uint16":
+		return "smallint", false, true
+	case "sql.NullInt16":
+		return "smallint", true, true
+	case "int32", "uint32":
+		return "int", false, true
+	case "sql.NullInt32":
+		return "int", true, true
+	case "int", "uint", "int64", "uint64":
+		return "bigint", false, true
+	case "sql.NullInt64":
+		return "bigint", true, true
+	case "float32":
+		return "float", false, true
+	case "float64":
+		return "double", false, true
+	case "sql.NullFloat64":
+		return "double", true, true
+	case "string", "sql.NullString":
+		if size <= 0 {
+			size = 255
+		}
+		return "varchar(" + strconv.FormatInt(size, 10) + ")", typ != "string", true
+	case "time.Time":
+		return "datetime", false, true
+	case "sql.NullTime", "orm.NullTime":
+		return "datetime", true, true
+	case "[]byte":
+		return "blob", true, true
+	}
+	return "", false, false
+}
+
+var intWidthRegexp = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+
+// normalizeColumnType 去掉整数类型的显示宽度(tinyint(1)除外)
+func normalizeColumnType(columnType string) string {
+	columnType = strings.ToLower(strings.TrimSpace(columnType))
+	if strings.HasPrefix(columnType, "tinyint(1)") {
+		return columnType
+	}
+	return intWidthRegexp.ReplaceAllString(columnType, "$1")
+}
+
+// columnTags 生成列的tag,typ为字段的Go类型,codec表示字段有codec tag
+func columnTags(t *table, col *column, typ string, pk, codec bool) [][2]string {
+	tags := [][2]string{{"column", col.name}}
+	if pk {
+		tags = append(tags, [2]string{"pk", "y"})
+		if !strings.Contains(strings.ToLower(col.extra), "auto_increment") {
+			tags = append(tags, [2]string{"pkAuto", "n"})
+		}
+	}
+
+	actual := normalizeColumnType(col.columnType)
+	var (
+		size     int64
+		inferred string
+		nullable bool
+		ok       bool
+	)
+	if strings.ToLower(col.dataType) == "varchar" && (typ == "string" || typ == "sql.NullString") {
+		size = col.maxLength
+	}
+	if codec {
+		inferred, nullable, ok = "text", true, true
+	} else {
+		inferred, nullable, ok = inferredType(typ, size)
+	}
+	if size > 0 && size != 255 && !codec {
+		tags = append(tags, [2]string{"size", strconv.FormatInt(size, 10)})
+	}
+	if !ok || actual != inferred {
+		tags = append(tags, [2]string{"type", col.columnType})
+	}
+	if !pk && col.nullable != nullable {
+		tags = append(tags, [2]string{"nullable", map[bool]string{true: "y", false: "n"}[col.nullable]})
+	}
+
+	var indexName, uniqueName string
+	for _, idx := range t.indexes {
+		for _, name := range idx.columns {
+			if name != col.name {
+				continue
+			}
+			switch {
+			case idx.unique && uniqueName == "":
+				uniqueName = idx.name
+				if idx.name == "uk_"+col.name && len(idx.columns) == 1 {
+					uniqueName = "y"
+				}
+			case !idx.unique && indexName == "":
+				indexName = idx.name
+				if idx.name == "idx_"+col.name && len(idx.columns) == 1 {
+					indexName = "y"
+				}
+			}
+		}
+	}
+	if indexName != "" {
+		tags = append(tags, [2]string{"index", indexName})
+	}
+	if uniqueName != "" {
+		tags = append(tags, [2]string{"unique", uniqueName})
+	}
+	return tags
+}
+
+// existingFile 已经存在的文件中需要保留的内容
+type existingFile struct {
+	pkg     string
+	imports []string //import的spec,如 "time", json "encoding/json"
+	prefix  string   //import之后ormgen:begin之前的代码
+	suffix  string   //ormgen:end之后的代码
+	fields  map[string]*existingField
+	extras  []string //没有column tag的字段,原样保留
+}
+
+// existingField 已经生成的字段
+type existingField struct {
+	name string
+	typ  string
+	tags [][2]string
+}
+
+// parseExisting 解析已经存在的文件,文件中必须有ormgen的标记
+func parseExisting(src []byte) (*existingFile, error) {
+	begin, end := bytes.Index(src, []byte(beginMarker)), bytes.Index(src, []byte(endMarker))
+	if begin < 0 || end < begin {
+		return nil, fmt.Errorf("can't find %q and %q", beginMarker, endMarker)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse fail,err:%v", err)
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	text := func(node ast.Node) string {
+		return string(src[offset(node.Pos()):offset(node.End())])
+	}
+
+	ex := &existingFile{pkg: file.Name.Name, fields: map[string]*existingField{}}
+	headerEnd := offset(file.Name.End())
+	for _, spec := range file.Imports {
+		ex.imports = append(ex.imports, text(spec))
+	}
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			headerEnd = offset(gen.End())
+		}
+	}
+	if headerEnd < begin {
+		ex.prefix = strings.TrimSpace(string(src[headerEnd:begin]))
+	}
+	suffix := src[end+len(endMarker):]
+	if i := bytes.IndexByte(suffix, '\n'); i >= 0 {
+		suffix = suffix[i+1:]
+	} else {
+		suffix = nil
+	}
+	ex.suffix = strings.TrimSpace(string(suffix))
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE || offset(gen.Pos()) < begin || offset(gen.End()) > end {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			st, ok := spec.(*ast.TypeSpec).Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			for _, f := range st.Fields.List {
+				var tag reflect.StructTag
+				if f.Tag != nil {
+					s, _ := strconv.Unquote(f.Tag.Value)
+					tag = reflect.StructTag(s)
+				}
+				columnName, hasColumn := tag.Lookup("column")
+				if !hasColumn || len(f.Names) != 1 {
+					if len(f.Names) == 0 && text(f.Type) == "orm.BaseShardEntity" {
+						continue
+					}
+					extra := text(f)
+					if f.Doc != nil {
+						extra = text(f.Doc) + "\n" + extra
+					}
+					if f.Comment != nil {
+						extra += " " + text(f.Comment)
+					}
+					ex.extras = append(ex.extras, extra)
+					continue
+				}
+				ex.fields[columnName] = &existingField{name: f.Names[0].Name, typ: text(f.Type), tags: parseTags(string(tag))}
+			}
+			break
+		}
+		break
+	}
+	return ex, nil
+}
+
+var tagRegexp = regexp.MustCompile(`([^\s:"]+):"((?:[^"\\]|\\.)*)"`)
+
+// parseTags 按顺序解析struct tag
+func parseTags(tag string) [][2]string {
+	var tags [][2]string
+	for _, m := range tagRegexp.FindAllStringSubmatch(tag, -1) {
+		value, err := strconv.Unquote(`"` + m[2] + `"`)
+		if err != nil {
+			value = m[2]
+		}
+		tags = append(tags, [2]string{m[1], value})
+	}
+	return tags
+}
+
+// hasTag tags中是否有key
+func hasTag(tags [][2]string, key string) bool {
+	for _, tag := range tags {
+		if tag[0] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// buildFields 生成实体的字段,已经存在的字段保留名称,类型及非ormgen生成的tag
+func (e *entity) buildFields(ex *existingFile) {
+	e.fields = nil
+	names := map[string]bool{}
+	for _, col := range e.source.columns {
+		pk := col == e.pk
+		f := &field{name: structName(col.name), typ: goType(col, pk), comment: col.comment}
+		var kept [][2]string
+		if ex != nil {
+			if old := ex.fields[col.name]; old != nil {
+				f.name, f.typ = old.name, old.typ
+				for _, tag := range old.tags {
+					if !generatedTags[tag[0]] {
+						kept = append(kept, tag)
+					}
+				}
+			}
+		}
+		for names[f.name] {
+			f.name += "_"
+		}
+		names[f.name] = true
+		f.tags = append(columnTags(e.source, col, f.typ, pk, hasTag(kept, "codec")), kept...)
+		e.fields = append(e.fields, f)
+	}
+}
+
+// render 生成实体的文件,existing为已经存在的文件内容
+func render(e *entity, opts *options, existing []byte) ([]byte, error) {
+	var ex *existingFile
+	if existing != nil {
+		var err error
+		if ex, err = parseExisting(existing); err != nil {
+			return nil, err
+		}
+	}
+	e.buildFields(ex)
+
+	pkg := opts.pkg
+	imports := map[string]bool{`"database/sql"`: true, `"time"`: true}
+	if len(e.shards) > 0 {
+		imports[strconv.Quote(ormPkg)] = true
+	}
+	var prefix, suffix string
+	if ex != nil {
+		pkg, prefix, suffix = ex.pkg, ex.prefix, ex.suffix
+		for _, spec := range ex.imports {
+			imports[spec] = true
+		}
+	}
+
+	var block strings.Builder
+	block.WriteString(beginMarker + "\n\n")
+	if len(e.shards) > 0 {
+		fmt.Fprintf(&block, "// %s 分表%s的实体", e.name, strings.Join(e.shards, ","))
+	} else {
+		fmt.Fprintf(&block, "// %s 表%s的实体", e.name, e.table)
+	}
+	if e.comment != "" {
+		block.WriteString(":" + oneLine(e.comment))
+	}
+	fmt.Fprintf(&block, "\ntype %s struct {\n", e.name)
+	if len(e.shards) > 0 {
+		block.WriteString("orm.BaseShardEntity\n")
+	}
+	for _, f := range e.fields {
+		var tags []string
+		for _, tag := range f.tags {
+			tags = append(tags, tag[0]+":"+strconv.Quote(tag[1]))
+		}
+		fmt.Fprintf(&block, "%s %s `%s`", f.name, f.typ, strings.Join(tags, " "))
+		if f.comment != "" {
+			block.WriteString(" //" + oneLine(f.comment))
+		}
+		block.WriteString("\n")
+	}
+	if ex != nil {
+		for _, extra := range ex.extras {
+			block.WriteString(extra + "\n")
+		}
+	}
+	fmt.Fprintf(&block, "}\n\n// TableName implements orm.Entity.TableName\nfunc (p *%s) TableName() string {\n\treturn %q\n}\n\n%s\n", e.name, e.table, endMarker)
+
+	compose := func(imports map[string]bool) []byte {
+		var b strings.Builder
+		b.WriteString(header + "\npackage " + pkg + "\n\n")
+		var std, others []string
+		for spec := range imports {
+			if p := importPath(spec); strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+				others = append(others, spec)
+			} else {
+				std = append(std, spec)
+			}
+		}
+		sort.Slice(std, func(i, j int) bool { return importPath(std[i]) < importPath(std[j]) })
+		sort.Slice(others, func(i, j int) bool { return importPath(others[i]) < importPath(others[j]) })
+		if len(std)+len(others) > 0 {
+			b.WriteString("import (\n" + strings.Join(std, "\n"))
+			if len(std) > 0 && len(others) > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(strings.Join(others, "\n") + "\n)\n\n")
+		}
+		if prefix != "" {
+			b.WriteString(prefix + "\n\n")
+		}
+		b.WriteString(block.String())
+		if suffix != "" {
+			b.WriteString("\n" + suffix + "\n")
+		}
+		return []byte(b.String())
+	}
+
+	// 去掉没有使用的import
+	src := compose(imports)
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated code of %s fail,err:%v", e.table, err)
+	}
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	for spec := range imports {
+		if name := importName(spec); name != "_" && name != "." && !used[name] {
+			delete(imports, spec)
+		}
+	}
+	out, err := format.Source(compose(imports))
+	if err != nil {
+		return nil, fmt.Errorf("format generated code of %s fail,err:%v", e.table, err)
+	}
+	return out, nil
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// importPath import spec中的路径
+func importPath(spec string) string {
+	i := strings.IndexByte(spec, '"')
+	p, _ := strconv.Unquote(strings.TrimSpace(spec[i:]))
+	return p
+}
+
+var versionSuffix = regexp.MustCompile(`^v\d+$|\.v\d+$`)
+
+// importName import spec引入的包名,没有指定名称时根据路径推断
+func importName(spec string) string {
+	if i := strings.IndexByte(spec, '"'); i > 0 {
+		if name := strings.TrimSpace(spec[:i]); name != "" {
+			return name
+		}
+	}
+	parts := strings.Split(importPath(spec), "/")
+	name := parts[len(parts)-1]
+	if versionSuffix.MatchString(name) && len(parts) > 1 && strings.HasPrefix(name, "v") {
+		name = parts[len(parts)-2]
+	}
+	name = versionSuffix.ReplaceAllString(name, "")
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/d0ngw/go/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+// seqEntity 与表t_seq生成的实体相同
+type seqEntity struct {
+	ID   uint64 `column:"id" pk:"y"`
+	Name string `column:"name" size:"32"`
+}
+
+func (p *seqEntity) TableName() string {
+	return "t_seq"
+}
+
+func fakeSchema(t *testing.T) []*table {
+	db := orm.NewFakeDB().NewPool("gen").NewOp().DB()
+	for _, stmt := range []string{
+		"INSERT INTO information_schema.TABLES (TABLE_SCHEMA,TABLE_NAME,TABLE_TYPE,TABLE_COMMENT) VALUES " +
+			"('test','t_user','BASE TABLE','用户'),('test','t_order_0','BASE TABLE',''),('test','t_order_1','BASE TABLE',''),('test','t_log','BASE TABLE',''),('test','t_seq','BASE TABLE',''),('test','v_user','VIEW','')",
+		"INSERT INTO information_schema.COLUMNS (TABLE_SCHEMA,TABLE_NAME,ORDINAL_POSITION,COLUMN_NAME,DATA_TYPE,COLUMN_TYPE,IS_NULLABLE,COLUMN_KEY,EXTRA,COLUMN_COMMENT,CHARACTER_MAXIMUM_LENGTH) VALUES " +
+			"('test','t_user',1,'id','bigint','bigint(20)','NO','PRI','auto_increment','',NULL)," +
+			"('test','t_user',2,'name','varchar','varchar(32)','NO','UNI','','名称',32)," +
+			"('test','t_user',3,'nick_name','varchar','varchar(255)','YES','MUL','','',255)," +
+			"('test','t_user',4,'age','int','int unsigned','NO','','','',NULL)," +
+			"('test','t_user',5,'balance','decimal','decimal(10,2)','NO','','','',NULL)," +
+			"('test','t_user',6,'enabled','tinyint','tinyint(1)','NO','','','',NULL)," +
+			"('test','t_user',7,'birthday','date','date','YES','','','',NULL)," +
+			"('test','t_user',8,'created_at','datetime','datetime','NO','','','',NULL)," +
+			"('test','t_user',9,'avatar_url','text','text','YES','','','',65535)," +
+			"('test','t_user',10,'version','bigint','bigint','NO','','','',NULL)," +
+			"('test','t_order_0',1,'order_id','bigint','bigint','NO','PRI','','',NULL)," +
+			"('test','t_order_0',2,'user_id','bigint','bigint','NO','MUL','','',NULL)," +
+			"('test','t_order_1',1,'order_id','bigint','bigint','NO','PRI','','',NULL)," +
+			"('test','t_order_1',2,'user_id','bigint','bigint','NO','MUL','','',NULL)," +
+			"('test','t_log',1,'msg','text','text','YES','','','',65535)," +
+			"('test','t_seq',1,'id','bigint','bigint unsigned','NO','PRI','auto_increment','',NULL)," +
+			"('test','t_seq',2,'name','varchar','varchar(32)','NO','','','',32)",
+		"INSERT INTO information_schema.STATISTICS (TABLE_SCHEMA,TABLE_NAME,INDEX_NAME,NON_UNIQUE,SEQ_IN_INDEX,COLUMN_NAME) VALUES " +
+			"('test','t_user','PRIMARY',0,1,'id'),('test','t_user','uk_name',0,1,'name'),('test','t_user','idx_nick',1,1,'nick_name'),('test','t_user','idx_nick',1,2,'age')," +
+			"('test','t_order_0','idx_user_id',1,1,'user_id'),('test','t_order_1','idx_user_id',1,1,'user_id'),('test','t_seq','PRIMARY',0,1,'id')",
+	} {
+		_, err := db.Exec(stmt)
+		assert.NoError(t, err)
+	}
+	tables, err := loadTables(context.Background(), db, "test")
+	assert.NoError(t, err)
+	return tables
+}
+
+func TestGenerate(t *testing.T) {
+	tables := fakeSchema(t)
+	assert.Len(t, tables, 5)
+	opts := &options{pkg: "model", trim: "t_", shard: regexp.MustCompile(`^(.+)_\d+$`)}
+	entities, warnings := buildEntities(tables, opts)
+	assert.Equal(t, []string{"skip table t_log without single column primary key"}, warnings)
+	assert.Len(t, entities, 3)
+	order, seq, user := entities[0], entities[1], entities[2]
+	assert.Equal(t, "Order", order.name)
+	assert.Equal(t, "t_order", order.table)
+	assert.Equal(t, []string{"t_order_0", "t_order_1"}, order.shards)
+	assert.Equal(t, "order.go", fileName(order, opts))
+	assert.Equal(t, "User", user.name)
+
+	// 无符号的自增主键生成uint64,orm回填自增id时支持无符号类型
+	src, err := render(seq, opts, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "ID   uint64 `column:\"id\" pk:\"y\" type:\"bigint unsigned\"`")
+	orm.AddMeta(&seqEntity{})
+	fake := orm.NewFakeDB()
+	fake.AddTable(&seqEntity{})
+	op := fake.NewPool("seq").NewOp()
+	for i := 1; i <= 2; i++ {
+		e := &seqEntity{Name: "s"}
+		assert.NoError(t, orm.Add(op, e))
+		assert.EqualValues(t, i, e.ID)
+	}
+
+	src, err = render(user, opts, nil)
+	assert.NoError(t, err)
+	code := string(src)
+	for _, expect := range []string{
+		"package model\n",
+		"import (\n\t\"database/sql\"\n\t\"time\"\n)",
+		"// User 表t_user的实体:用户\ntype User struct {",
+		"ID        int64          `column:\"id\" pk:\"y\"`",
+		"Name      string         `column:\"name\" size:\"32\" unique:\"y\"` //名称",
+		"NickName  sql.NullString `column:\"nick_name\" index:\"idx_nick\"`",
+		"Age       uint32         `column:\"age\" type:\"int unsigned\" index:\"idx_nick\"`",
+		"Balance   float64        `column:\"balance\" type:\"decimal(10,2)\"`",
+		"Enabled   bool           `column:\"enabled\"`",
+		"Birthday  sql.NullTime   `column:\"birthday\" type:\"date\"`",
+		"CreatedAt time.Time      `column:\"created_at\"`",
+		"AvatarURL sql.NullString `column:\"avatar_url\" type:\"text\"`",
+		"func (p *User) TableName() string {\n\treturn \"t_user\"\n}",
+	} {
+		assert.Contains(t, code, expect)
+	}
+
+	src, err = render(order, opts, nil)
+	assert.NoError(t, err)
+	code = string(src)
+	assert.Contains(t, code, "import (\n\t\"github.com/d0ngw/go/orm\"\n)")
+	assert.Contains(t, code, "type Order struct {\n\torm.BaseShardEntity\n\tOrderID int64 `column:\"order_id\" pk:\"y\" pkAuto:\"n\"`\n\tUserID  int64 `column:\"user_id\" index:\"y\"`\n}")
+	assert.Contains(t, code, "return \"t_order\"")
+
+	// 修改生成的文件后重新生成
+	edited := strings.Replace(string(src), "UserID  int64 `column:\"user_id\" index:\"y\"`", "Buyer int `column:\"user_id\" index:\"y\" shard:\"y\"`\n\tItems []*Item `rel:\"hasMany,fk=order_id\"` //明细", 1)
+	edited = strings.Replace(edited, "// ormgen:end\n", "// ormgen:end\n\n// Paid 是否已支付\nfunc (p *Order) Paid(now time.Time) bool {\n\treturn now.IsZero()\n}\n", 1)
+	edited = strings.Replace(edited, "// ormgen:begin", "// Item 明细\ntype Item struct{}\n\n// ormgen:begin", 1)
+	order.source.columns = append(order.source.columns, &column{name: "amount", dataType: "bigint", columnType: "bigint", key: ""})
+	src, err = render(order, opts, []byte(edited))
+	assert.NoError(t, err)
+	code = string(src)
+	assert.Contains(t, code, "import (\n\t\"time\"\n\n\t\"github.com/d0ngw/go/orm\"\n)")
+	assert.Contains(t, code, "Buyer   int     `column:\"user_id\" index:\"y\" shard:\"y\"`")
+	assert.Contains(t, code, "Amount  int64   `column:\"amount\"`")
+	assert.Contains(t, code, "Items   []*Item `rel:\"hasMany,fk=order_id\"` //明细")
+	assert.Contains(t, code, "// Item 明细\ntype Item struct{}\n\n// ormgen:begin")
+	assert.Contains(t, code, "// ormgen:end\n\n// Paid 是否已支付\nfunc (p *Order) Paid(now time.Time) bool {")
+
+	again, err := render(order, opts, src)
+	assert.NoError(t, err)
+	assert.Equal(t, code, string(again))
+
+	_, err = render(order, opts, []byte("package model\n\ntype Order struct{}\n"))
+	assert.Error(t, err)
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, "UserID", structName("user_id"))
+	assert.Equal(t, "HTTPURLLog", structName("http_url_log"))
+	assert.Equal(t, "T2021Stat", structName("2021_stat"))
+	assert.Equal(t, "yaml", importName(`"gopkg.in/yaml.v3"`))
+	assert.Equal(t, "redis", importName(`"github.com/go-redis/redis/v8"`))
+	assert.Equal(t, "c", importName(`c "github.com/d0ngw/go/common"`))
+	assert.Equal(t, "mysql", importName(`"github.com/go-sql-driver/mysql"`))
+	assert.Equal(t, "user_test_entity.go", fileName(&entity{table: "t_user_test"}, &options{trim: "t_"}))
+	assert.Equal(t, "int", normalizeColumnType("INT(11)"))
+	assert.Equal(t, "tinyint(1)", normalizeColumnType("tinyint(1)"))
+	assert.Equal(t, "bigint unsigned", normalizeColumnType("bigint(20) unsigned"))
+}
@@ -0,0 +1,120 @@
+// ormgen 根据MySQL的information_schema生成带有column,pk,pkAuto等tag的实体及TableName方法.
+//
+// 用法:
+//
+//	ormgen -config db.yaml -out ./model -pkg model -trim t_ -tables 't_user*,t_order'
+//
+// config为orm.DBConfig的YAML配置;每个实体生成一个文件,匹配-shard的多个表(如user_0,user_1)生成一个嵌入orm.BaseShardEntity的实体,
+// TableName返回逻辑表名.重新生成时只替换文件中ormgen:begin和ormgen:end之间的代码,其余代码(如手写的方法)原样保留;
+// 已经存在的字段保留名称,类型及非ormgen生成的tag(如version,softDelete,codec),没有column tag的字段也会保留.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	c "github.com/d0ngw/go/common"
+	"github.com/d0ngw/go/orm"
+)
+
+func main() {
+	var (
+		configPath = flag.String("config", "", "数据库配置的YAML文件,内容为orm.DBConfig")
+		out        = flag.String("out", ".", "输出目录")
+		pkg        = flag.String("pkg", "", "包名,为空时使用输出目录的名称")
+		trim       = flag.String("trim", "", "生成结构体名称及文件名时去掉的表名前缀")
+		shard      = flag.String("shard", `^(.+)_\d+$`, "分表的表名,第一个分组为逻辑表名,为空时不识别分表")
+		tables     = flag.String("tables", "", "要生成的表,以逗号分隔,支持通配符,为空时生成所有的表")
+	)
+	flag.Parse()
+	if err := run(*configPath, *out, *pkg, *trim, *shard, *tables); err != nil {
+		fmt.Fprintf(os.Stderr, "ormgen fail,err:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath, out, pkg, trim, shard, tables string) error {
+	if configPath == "" {
+		return fmt.Errorf("need -config")
+	}
+	config := &orm.DBConfig{}
+	if err := c.LoadYAMLFromPath(configPath, config); err != nil {
+		return fmt.Errorf("load config %s fail,err:%v", configPath, err)
+	}
+	if err := config.Parse(); err != nil {
+		return err
+	}
+	dialect, err := orm.DialectOf(config.Driver)
+	if err != nil {
+		return err
+	}
+	if dialect.Name() != orm.MySQLDialectName {
+		return fmt.Errorf("unsupported driver %s,only mysql is supported", dialect.Name())
+	}
+
+	opts := &options{pkg: pkg, trim: trim}
+	if shard != "" {
+		if opts.shard, err = regexp.Compile(shard); err != nil {
+			return fmt.Errorf("invalid -shard %s,err:%v", shard, err)
+		}
+	}
+	for _, t := range strings.Split(tables, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.tables = append(opts.tables, t)
+		}
+	}
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+	if opts.pkg == "" {
+		opts.pkg = strings.ReplaceAll(filepath.Base(out), "-", "_")
+	}
+	if err = os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+
+	pool, err := orm.NewMySQLDBPool(config)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	all, err := loadTables(context.Background(), pool.NewOp().DB(), config.Schema)
+	if err != nil {
+		return err
+	}
+	entities, warnings := buildEntities(all, opts)
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	for _, e := range entities {
+		if err = generate(e, opts, filepath.Join(out, fileName(e, opts))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generate 生成或者重新生成实体的文件
+func generate(e *entity, opts *options, file string) error {
+	existing, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		existing = nil
+	}
+	src, err := render(e, opts, existing)
+	if err != nil {
+		return fmt.Errorf("generate %s fail,err:%v", file, err)
+	}
+	if err = os.WriteFile(file, src, 0644); err != nil {
+		return err
+	}
+	fmt.Println(file)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// column information_schema.COLUMNS中的列
+type column struct {
+	name       string
+	dataType   string //类型名称,如varchar
+	columnType string //完整的类型,如varchar(32),int unsigned
+	nullable   bool
+	key        string //PRI,UNI,MUL
+	extra      string //auto_increment等
+	comment    string
+	maxLength  int64 //字符串的最大长度
+}
+
+// index information_schema.STATISTICS中的索引
+type index struct {
+	name    string
+	unique  bool
+	columns []string
+}
+
+// table 数据库中的表
+type table struct {
+	name    string
+	comment string
+	columns []*column
+	indexes []*index
+}
+
+// pk 主键列,没有主键或者是联合主键时返回nil
+func (p *table) pk() *column {
+	var pk *column
+	for _, col := range p.columns {
+		if col.key == "PRI" {
+			if pk != nil {
+				return nil
+			}
+			pk = col
+		}
+	}
+	return pk
+}
+
+// loadTables 从information_schema中读取schema中所有的表
+func loadTables(ctx context.Context, db *sql.DB, schema string) ([]*table, error) {
+	var (
+		tables []*table
+		byName = map[string]*table{}
+	)
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME,COALESCE(TABLE_COMMENT,'') FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME", schema)
+	if err != nil {
+		return nil, fmt.Errorf("query tables fail,err:%v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := &table{}
+		if err = rows.Scan(&t.name, &t.comment); err != nil {
+			return nil, fmt.Errorf("scan table fail,err:%v", err)
+		}
+		tables = append(tables, t)
+		byName[t.name] = t
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tables fail,err:%v", err)
+	}
+
+	colRows, err := db.QueryContext(ctx, "SELECT TABLE_NAME,COLUMN_NAME,DATA_TYPE,COLUMN_TYPE,IS_NULLABLE,COLUMN_KEY,EXTRA,COALESCE(COLUMN_COMMENT,''),CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME,ORDINAL_POSITION", schema)
+	if err != nil {
+		return nil, fmt.Errorf("query columns fail,err:%v", err)
+	}
+	defer colRows.Close()
+	for colRows.Next() {
+		var (
+			tableName, nullable string
+			maxLength           sql.NullInt64
+			col                 = &column{}
+		)
+		if err = colRows.Scan(&tableName, &col.name, &col.dataType, &col.columnType, &nullable, &col.key, &col.extra, &col.comment, &maxLength); err != nil {
+			return nil, fmt.Errorf("scan column fail,err:%v", err)
+		}
+		col.nullable = nullable == "YES"
+		col.maxLength = maxLength.Int64
+		if t := byName[tableName]; t != nil {
+			t.columns = append(t.columns, col)
+		}
+	}
+	if err = colRows.Err(); err != nil {
+		return nil, fmt.Errorf("query columns fail,err:%v", err)
+	}
+
+	idxRows, err := db.QueryContext(ctx, "SELECT TABLE_NAME,INDEX_NAME,NON_UNIQUE,COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME,INDEX_NAME,SEQ_IN_INDEX", schema)
+	if err != nil {
+		return nil, fmt.Errorf("query indexes fail,err:%v", err)
+	}
+	defer idxRows.Close()
+	for idxRows.Next() {
+		var (
+			tableName, indexName, columnName string
+			nonUnique                        int
+		)
+		if err = idxRows.Scan(&tableName, &indexName, &nonUnique, &columnName); err != nil {
+			return nil, fmt.Errorf("scan index fail,err:%v", err)
+		}
+		t := byName[tableName]
+		if t == nil || indexName == "PRIMARY" {
+			continue
+		}
+		if n := len(t.indexes); n == 0 || t.indexes[n-1].name != indexName {
+			t.indexes = append(t.indexes, &index{name: indexName, unique: nonUnique == 0})
+		}
+		idx := t.indexes[len(t.indexes)-1]
+		idx.columns = append(idx.columns, columnName)
+	}
+	if err = idxRows.Err(); err != nil {
+		return nil, fmt.Errorf("query indexes fail,err:%v", err)
+	}
+	return tables, nil
+}
@@ -0,0 +1,255 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BatchOptions 批量写入的参数
+type BatchOptions struct {
+	MaxRows  int //每条语句最多插入的行数
+	MaxBytes int //每条语句的最大字节数(语句和参数的估算值),应小于数据库允许的最大包,如mysql的max_allowed_packet
+}
+
+// DefaultBatchOptions 默认的批量写入参数
+var DefaultBatchOptions = BatchOptions{
+	MaxRows:  500,
+	MaxBytes: 1 << 20,
+}
+
+// batchRow 批量写入的一行
+type batchRow struct {
+	entity Entity
+	ind    reflect.Value
+	params []interface{}
+	size   int
+}
+
+// batchChunk 一条多行INSERT语句写入的行
+type batchChunk struct {
+	tname string
+	rows  []*batchRow
+}
+
+type entityBatchRowFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, upsert bool) (*batchRow, error)
+type entityBatchInsertFunc func(ctx context.Context, executor *sqlExecutor, tname string, rows []*batchRow, upsert bool) (int64, error)
+
+// paramSize 估算参数在语句中占用的字节数
+func paramSize(v interface{}) int {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return 4
+		}
+		dv, err := valuer.Value()
+		if err != nil {
+			return 8
+		}
+		v = dv
+	}
+	switch val := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(val) + 2
+	case []byte:
+		return len(val)*2 + 3
+	}
+	return 20
+}
+
+// 构建实体模型的批量写入函数
+func createBatchFuncs(modelInfo *meta) (entityBatchRowFunc, entityBatchInsertFunc) {
+	insertFields := filterFields(exceptIDPred, modelInfo.fields)
+	rowParams := "(" + strings.Join(toSlice("?", len(insertFields)), ",") + ")"
+
+	updateFields := filterFields(upsertUpdatePred, modelInfo.fields)
+	updateColumns := make([]string, 0, len(updateFields))
+	for _, field := range updateFields {
+		updateColumns = append(updateColumns, field.column)
+	}
+	conflictColumns := upsertConflictColumns(modelInfo)
+
+	rowFunc := func(ctx context.Context, executor *sqlExecutor, entity Entity, upsert bool) (*batchRow, error) {
+		ind := checkEntity(modelInfo, entity, executor)
+		if err := modelInfo.beforeInsert(ctx, entity); err != nil {
+			return nil, err
+		}
+		if err := modelInfo.fillID(ctx, ind); err != nil {
+			return nil, err
+		}
+		modelInfo.fillInsertTime(ind)
+		if upsert {
+			modelInfo.fillUpdateTime(ind)
+		}
+		row := &batchRow{entity: entity, ind: ind, params: buildParamValues(ind, insertFields), size: len(rowParams) + 1}
+		for _, param := range row.params {
+			row.size += paramSize(param)
+		}
+		return row, nil
+	}
+
+	insertFunc := func(ctx context.Context, executor *sqlExecutor, tname string, rows []*batchRow, upsert bool) (int64, error) {
+		if len(rows) == 0 {
+			return 0, nil
+		}
+		paramValues := make([]interface{}, 0, len(rows)*len(insertFields))
+		for _, row := range rows {
+			paramValues = append(paramValues, row.params...)
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", tname, executor.columns(insertFields), strings.Join(toSlice(rowParams, len(rows)), ","))
+		if upsert {
+			upsertSQL, err := executor.dialect.Upsert(conflictColumns, upsertSetVersion(modelInfo, executor, tname, upsertAssignments(executor, updateColumns, executor.dialect.Excluded)))
+			if err != nil {
+				return 0, err
+			}
+			insertSQL += upsertSQL
+		}
+
+		pkAuto := modelInfo.pkField.pkAuto && !upsert
+		if pkAuto {
+			if returning := executor.dialect.Returning(modelInfo.pkField.column); returning != "" {
+				return insertReturningIDs(ctx, executor, insertSQL+returning, paramValues, modelInfo.pkField, rows)
+			}
+		}
+
+		rs, err := exec(ctx, executor, insertSQL, paramValues)
+		if err != nil {
+			return 0, err
+		}
+		if pkAuto {
+			lastID, err := rs.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+			firstID := executor.dialect.FirstInsertID(lastID, len(rows))
+			for i, row := range rows {
+				setAutoID(row.ind.FieldByIndex(modelInfo.pkField.index), firstID+int64(i))
+			}
+		}
+		return rs.RowsAffected()
+	}
+	return rowFunc, insertFunc
+}
+
+// insertReturningIDs 执行带有RETURNING的多行插入语句,按顺序回填自增主键
+func insertReturningIDs(ctx context.Context, executor *sqlExecutor, insertSQL string, args []interface{}, pkField *metaField, batchRows []*batchRow) (int64, error) {
+	rows, err := query(ctx, executor, insertSQL, args)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		if n >= int64(len(batchRows)) {
+			return n, fmt.Errorf("returning more ids than %d rows", len(batchRows))
+		}
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return n, err
+		}
+		setAutoID(batchRows[n].ind.FieldByIndex(pkField.index), id)
+		n++
+	}
+	return n, rows.Err()
+}
+
+// addBatch 按表名分组,并按BatchOptions拆分后批量写入
+func addBatch(ctx context.Context, op *Op, entities []Entity, upsert bool) (int64, error) {
+	if len(entities) == 0 {
+		return 0, nil
+	}
+	if entities[0] == nil {
+		return 0, fmt.Errorf("invalid nil entity at 0")
+	}
+	modelMeta := findEntityMeta(entities[0])
+	executor := op.executor()
+	opts := op.BatchOptions()
+
+	var (
+		tables []string
+		groups = map[string][]*batchRow{}
+	)
+	for i, entity := range entities {
+		if entity == nil {
+			return 0, fmt.Errorf("invalid nil entity at %d", i)
+		}
+		row, err := modelMeta.batchRowFunc(ctx, executor, entity, upsert)
+		if err != nil {
+			return 0, err
+		}
+		tname, err := tblName(entity)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := groups[tname]; !ok {
+			tables = append(tables, tname)
+		}
+		groups[tname] = append(groups[tname], row)
+	}
+
+	var chunks []batchChunk
+	for _, tname := range tables {
+		rows := groups[tname]
+		// INSERT INTO及列名等固定部分的估算
+		baseSize := 64 + len(tname) + 16*len(modelMeta.fields)
+		for start := 0; start < len(rows); {
+			end, size := start, baseSize
+			for end < len(rows) && end-start < opts.MaxRows {
+				if end > start && size+rows[end].size > opts.MaxBytes {
+					break
+				}
+				size += rows[end].size
+				end++
+			}
+			chunks = append(chunks, batchChunk{tname: tname, rows: rows[start:end]})
+			start = end
+		}
+	}
+
+	// execChunks 执行所有的语句,之后调用AfterInsert,在事务中执行时钩子的错误会回滚整个批次
+	execChunks := func() (int64, error) {
+		executor := op.executor()
+		var total int64
+		for _, chunk := range chunks {
+			affected, err := execBatch(ctx, op, modelMeta, executor, chunk.tname, chunk.rows, upsert)
+			if err != nil {
+				return total, err
+			}
+			total += affected
+		}
+		for _, chunk := range chunks {
+			for _, row := range chunk.rows {
+				if err := modelMeta.afterInsert(ctx, row.entity); err != nil {
+					return total, err
+				}
+			}
+		}
+		return total, nil
+	}
+
+	if len(chunks) > 1 && op.tx == nil {
+		// 拆分为多条语句时在事务中执行,避免失败时只写入了部分数据
+		var total int64
+		_, err := op.DoInTransCtx(ctx, nil, func(tx *sql.Tx) (interface{}, error) {
+			affected, err := execChunks()
+			total = affected
+			return nil, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+	return execChunks()
+}
+
+func execBatch(ctx context.Context, op *Op, modelMeta *meta, executor *sqlExecutor, tname string, rows []*batchRow, upsert bool) (int64, error) {
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.batchInsertFunc(ctx, executor, tname, rows, upsert)
+}
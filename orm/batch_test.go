@@ -0,0 +1,183 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchKV struct {
+	Key string `column:"k" pk:"y" pkAuto:"n" size:"32"`
+	Val int64  `column:"val"`
+}
+
+func (p *batchKV) TableName() string {
+	return "batch_kv"
+}
+
+type batchUnsigned struct {
+	ID   uint64 `column:"id" pk:"y"`
+	Name string `column:"name" size:"32"`
+}
+
+func (p *batchUnsigned) TableName() string {
+	return "batch_unsigned"
+}
+
+func TestAddUnsignedPk(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&batchUnsigned{})
+
+	createTables(t, &batchUnsigned{})
+
+	dboper := &Op{pool: dbpool}
+	m := &batchUnsigned{Name: "a"}
+	assert.NoError(t, Add(dboper, m))
+	assert.EqualValues(t, 1, m.ID)
+
+	entities := []Entity{&batchUnsigned{Name: "b"}, &batchUnsigned{Name: "c"}}
+	assert.NoError(t, AddBatch(dboper, entities))
+	assert.EqualValues(t, 2, entities[0].(*batchUnsigned).ID)
+	assert.EqualValues(t, 3, entities[1].(*batchUnsigned).ID)
+}
+
+func TestAddBatch(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+
+	dboper := &Op{pool: dbpool}
+	dboper.SetBatchOptions(BatchOptions{MaxRows: 2})
+
+	var entities []Entity
+	for i := 0; i < 5; i++ {
+		tm := &tmodel{Name: sql.NullString{String: "batch", Valid: true}, Age: int64(i)}
+		if i%2 == 1 {
+			tm.SetTableShardFunc(func() (string, error) { return "tt_2", nil })
+		}
+		entities = append(entities, tm)
+	}
+	err := AddBatch(dboper, entities)
+	assert.NoError(t, err)
+
+	for _, e := range entities {
+		tm := e.(*tmodel)
+		assert.True(t, tm.ID > 0)
+		get, err := Get(dboper, tm, tm.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, get)
+		assert.EqualValues(t, tm.Age, get.(*tmodel).Age)
+	}
+
+	total, err := QueryCount(dboper, &tmodel{}, "*", "WHERE name = ?", "batch")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+
+	deleted, err := DelByCondition(dboper, &tmodel{}, "WHERE name = ?", "batch")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+
+	assert.NoError(t, AddBatch(dboper, nil))
+	assert.Error(t, AddBatch(dboper, []Entity{&tmodel{}, nil}))
+}
+
+func TestAddBatchSplit(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+
+	dboper := &Op{pool: dbpool}
+	dboper.SetBatchOptions(BatchOptions{MaxBytes: 1})
+	assert.EqualValues(t, DefaultBatchOptions.MaxRows, dboper.BatchOptions().MaxRows)
+
+	entities := []Entity{
+		&tmodel{Name: sql.NullString{String: "split", Valid: true}},
+		&tmodel{Name: sql.NullString{String: "split", Valid: true}},
+	}
+	err := AddBatch(dboper, entities)
+	assert.NoError(t, err)
+	assert.NotEqual(t, entities[0].(*tmodel).ID, entities[1].(*tmodel).ID)
+
+	deleted, err := DelByCondition(dboper, &tmodel{}, "WHERE name = ?", "split")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deleted)
+}
+
+func TestAddOrUpdateBatch(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&batchKV{})
+
+	createTables(t, &batchKV{})
+
+	dboper := &Op{pool: dbpool}
+	var entities []Entity
+	for i := 0; i < 3; i++ {
+		entities = append(entities, &batchKV{Key: fmt.Sprintf("k%d", i), Val: int64(i)})
+	}
+	assert.NoError(t, AddBatch(dboper, entities[:2]))
+
+	for _, e := range entities {
+		e.(*batchKV).Val += 10
+	}
+	affected, err := AddOrUpdateBatch(dboper, entities)
+	assert.NoError(t, err)
+	assert.True(t, affected >= 3)
+
+	for _, e := range entities {
+		kv := e.(*batchKV)
+		get, err := Get(dboper, kv, kv.Key)
+		assert.NoError(t, err)
+		assert.NotNil(t, get)
+		assert.EqualValues(t, kv.Val, get.(*batchKV).Val)
+	}
+
+	// 拆分为多条语句时,后面的语句失败时前面写入的行也会回滚
+	dboper.SetBatchOptions(BatchOptions{MaxRows: 1})
+	err = AddBatch(dboper, []Entity{&batchKV{Key: "k3"}, &batchKV{Key: "k0"}})
+	assert.Error(t, err)
+	get, err := Get(dboper, &batchKV{}, "k3")
+	assert.NoError(t, err)
+	assert.Nil(t, get)
+}
+
+type batchUnique struct {
+	ID   int64  `column:"id" pk:"y"`
+	Code string `column:"code" size:"32" unique:"y"`
+	Val  int64  `column:"val"`
+}
+
+func (p *batchUnique) TableName() string {
+	return "batch_unique"
+}
+
+func TestAddOrUpdateUnique(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&batchUnique{})
+	AddMeta(&tmodel{})
+
+	createTables(t, &batchUnique{})
+
+	// 自增主键不在插入的列中,按照unique索引判断冲突
+	dboper := &Op{pool: dbpool}
+	assert.NoError(t, Add(dboper, &batchUnique{Code: "a", Val: 1}))
+	_, err = AddOrUpdate(dboper, &batchUnique{Code: "a", Val: 2})
+	assert.NoError(t, err)
+	_, err = AddOrUpdateBatch(dboper, []Entity{&batchUnique{Code: "a", Val: 3}, &batchUnique{Code: "b", Val: 1}})
+	assert.NoError(t, err)
+
+	list, err := From[*batchUnique]().OrderBy("code").Find(dboper)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.EqualValues(t, 3, list[0].Val)
+	assert.EqualValues(t, 1, list[1].Val)
+
+	// 没有可用于判断冲突的唯一键
+	_, err = AddOrUpdate(dboper, &tmodel{Name: sql.NullString{String: "upsert", Valid: true}})
+	if dbpool.Dialect() == MySQLDialect {
+		assert.NoError(t, err)
+		_, err = DelByCondition(dboper, &tmodel{}, "WHERE name = ?", "upsert")
+		assert.NoError(t, err)
+	} else {
+		assert.Error(t, err)
+	}
+}
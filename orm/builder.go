@@ -0,0 +1,472 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Cond 查询条件,列名会根据实体的column tag进行校验
+type Cond interface {
+	// build 根据实体的元数据及方言生成条件语句及参数
+	build(m *meta, d Dialect) (cond string, params []interface{}, err error)
+}
+
+type opCond struct {
+	column string
+	op     string
+	val    interface{}
+}
+
+func (p *opCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	column, err := quoteColumn(m, d, p.column)
+	if err != nil {
+		return "", nil, err
+	}
+	return column + " " + p.op + " ?", []interface{}{condParam(m, p.column, p.val)}, nil
+}
+
+// Eq column = val
+func Eq(column string, val interface{}) Cond {
+	return &opCond{column: column, op: "=", val: val}
+}
+
+// Ne column <> val
+func Ne(column string, val interface{}) Cond {
+	return &opCond{column: column, op: "<>", val: val}
+}
+
+// Gt column > val
+func Gt(column string, val interface{}) Cond {
+	return &opCond{column: column, op: ">", val: val}
+}
+
+// Ge column >= val
+func Ge(column string, val interface{}) Cond {
+	return &opCond{column: column, op: ">=", val: val}
+}
+
+// Lt column < val
+func Lt(column string, val interface{}) Cond {
+	return &opCond{column: column, op: "<", val: val}
+}
+
+// Le column <= val
+func Le(column string, val interface{}) Cond {
+	return &opCond{column: column, op: "<=", val: val}
+}
+
+// Like column LIKE val
+func Like(column string, val interface{}) Cond {
+	return &opCond{column: column, op: "LIKE", val: val}
+}
+
+type inCond struct {
+	column string
+	not    bool
+	vals   []interface{}
+}
+
+func (p *inCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	column, err := quoteColumn(m, d, p.column)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(p.vals) == 0 {
+		if p.not {
+			return "1 = 1", nil, nil
+		}
+		return "1 = 0", nil, nil
+	}
+	op := "IN"
+	if p.not {
+		op = "NOT IN"
+	}
+	params := make([]interface{}, 0, len(p.vals))
+	for _, val := range p.vals {
+		params = append(params, condParam(m, p.column, val))
+	}
+	return column + " " + op + " (" + strings.Join(toSlice("?", len(p.vals)), ",") + ")", params, nil
+}
+
+// In column IN (vals...),vals也可以是一个slice,vals为空时条件为假
+func In(column string, vals ...interface{}) Cond {
+	return &inCond{column: column, vals: flatVals(vals)}
+}
+
+// NotIn column NOT IN (vals...),vals也可以是一个slice,vals为空时条件为真
+func NotIn(column string, vals ...interface{}) Cond {
+	return &inCond{column: column, not: true, vals: flatVals(vals)}
+}
+
+// flatVals 如果只有一个slice参数,将其展开
+func flatVals(vals []interface{}) []interface{} {
+	if len(vals) != 1 || vals[0] == nil {
+		return vals
+	}
+	v := reflect.ValueOf(vals[0])
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return vals
+	}
+	ret := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ret = append(ret, v.Index(i).Interface())
+	}
+	return ret
+}
+
+type nullCond struct {
+	column string
+	not    bool
+}
+
+func (p *nullCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	column, err := quoteColumn(m, d, p.column)
+	if err != nil {
+		return "", nil, err
+	}
+	if p.not {
+		return column + " IS NOT NULL", nil, nil
+	}
+	return column + " IS NULL", nil, nil
+}
+
+// IsNull column IS NULL
+func IsNull(column string) Cond {
+	return &nullCond{column: column}
+}
+
+// IsNotNull column IS NOT NULL
+func IsNotNull(column string) Cond {
+	return &nullCond{column: column, not: true}
+}
+
+type betweenCond struct {
+	column     string
+	begin, end interface{}
+}
+
+func (p *betweenCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	column, err := quoteColumn(m, d, p.column)
+	if err != nil {
+		return "", nil, err
+	}
+	return column + " BETWEEN ? AND ?", []interface{}{p.begin, p.end}, nil
+}
+
+// Between column BETWEEN begin AND end
+func Between(column string, begin, end interface{}) Cond {
+	return &betweenCond{column: column, begin: begin, end: end}
+}
+
+type joinCond struct {
+	sep   string
+	conds []Cond
+}
+
+func (p *joinCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	if len(p.conds) == 0 {
+		return "", nil, fmt.Errorf("empty %s condition", strings.TrimSpace(p.sep))
+	}
+	var (
+		conds  = make([]string, 0, len(p.conds))
+		params []interface{}
+	)
+	for _, c := range p.conds {
+		if c == nil {
+			return "", nil, fmt.Errorf("nil condition")
+		}
+		cond, condParams, err := c.build(m, d)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, cond)
+		params = append(params, condParams...)
+	}
+	if len(conds) == 1 {
+		return conds[0], params, nil
+	}
+	return "(" + strings.Join(conds, p.sep) + ")", params, nil
+}
+
+// And (conds[0] AND conds[1] ...)
+func And(conds ...Cond) Cond {
+	return &joinCond{sep: " AND ", conds: conds}
+}
+
+// Or (conds[0] OR conds[1] ...)
+func Or(conds ...Cond) Cond {
+	return &joinCond{sep: " OR ", conds: conds}
+}
+
+type notCond struct {
+	cond Cond
+}
+
+func (p *notCond) build(m *meta, d Dialect) (string, []interface{}, error) {
+	if p.cond == nil {
+		return "", nil, fmt.Errorf("nil condition")
+	}
+	cond, params, err := p.cond.build(m, d)
+	if err != nil {
+		return "", nil, err
+	}
+	return "NOT (" + cond + ")", params, nil
+}
+
+// Not NOT (cond)
+func Not(cond Cond) Cond {
+	return &notCond{cond: cond}
+}
+
+// quoteColumn 校验列名并加上方言的引号
+func quoteColumn(m *meta, d Dialect, column string) (string, error) {
+	if _, ok := m.columnFields[column]; !ok {
+		return "", fmt.Errorf("can't find column %s in %s", column, m.name)
+	}
+	return d.Quote(column), nil
+}
+
+// condParam 条件及更新的参数,使用codec的列先进行编码,如aes列可以使用明文做等值查询
+func condParam(m *meta, column string, val interface{}) interface{} {
+	if field := m.columnFields[column]; field != nil && field.codec != nil && val != nil {
+		return codecValue{codec: field.codec, v: reflect.ValueOf(val)}
+	}
+	return val
+}
+
+type setColumn struct {
+	column string
+	val    interface{}
+}
+
+// QueryBuilder 基于实体元数据的查询构建器
+type QueryBuilder[T Entity] struct {
+	entity   T
+	conds    []Cond
+	orders   []string
+	columns  []string
+	sets     []setColumn
+	limit    int
+	offset   int
+	preloads []string
+}
+
+// From 创建T的查询构建器,T必须是已经注册过的实体指针类型
+func From[T Entity]() *QueryBuilder[T] {
+	return FromEntity(newEntity[T]())
+}
+
+// FromEntity 使用entity创建查询构建器,entity用于确定表名,如分表的实体需要先设置好TableShardFunc
+func FromEntity[T Entity](entity T) *QueryBuilder[T] {
+	return &QueryBuilder[T]{entity: entity}
+}
+
+// newEntity 创建T指向的实体
+func newEntity[T Entity]() T {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Ptr {
+		panic(NewDBErrorf(nil, "Expect ptr ,but it's %s", typ))
+	}
+	return reflect.New(typ.Elem()).Interface().(T)
+}
+
+// Entity 构建器使用的实体
+func (p *QueryBuilder[T]) Entity() T {
+	return p.entity
+}
+
+// Where 添加条件,多个条件之间使用AND连接
+func (p *QueryBuilder[T]) Where(conds ...Cond) *QueryBuilder[T] {
+	p.conds = append(p.conds, conds...)
+	return p
+}
+
+// OrderBy 添加排序的列,以"-"开头的列降序排列
+func (p *QueryBuilder[T]) OrderBy(columns ...string) *QueryBuilder[T] {
+	p.orders = append(p.orders, columns...)
+	return p
+}
+
+// Select 只查询指定的列
+func (p *QueryBuilder[T]) Select(columns ...string) *QueryBuilder[T] {
+	p.columns = append(p.columns, columns...)
+	return p
+}
+
+// Limit 限制返回的条数,<=0表示不限制
+func (p *QueryBuilder[T]) Limit(limit int) *QueryBuilder[T] {
+	p.limit = limit
+	return p
+}
+
+// Offset 跳过的条数,没有设置Limit时也生效
+func (p *QueryBuilder[T]) Offset(offset int) *QueryBuilder[T] {
+	p.offset = offset
+	return p
+}
+
+// Preload 查询后加载名称为names的关联字段,参见PreloadCtx
+func (p *QueryBuilder[T]) Preload(names ...string) *QueryBuilder[T] {
+	p.preloads = append(p.preloads, names...)
+	return p
+}
+
+// Set 设置Update时需要更新的列
+func (p *QueryBuilder[T]) Set(column string, val interface{}) *QueryBuilder[T] {
+	p.sets = append(p.sets, setColumn{column: column, val: val})
+	return p
+}
+
+// whereSQL 生成WHERE语句
+func (p *QueryBuilder[T]) whereSQL(m *meta, d Dialect) (string, []interface{}, error) {
+	if len(p.conds) == 0 {
+		return "", nil, nil
+	}
+	cond, params, err := And(p.conds...).build(m, d)
+	if err != nil {
+		return "", nil, err
+	}
+	return "WHERE " + cond, params, nil
+}
+
+// querySQL 生成WHERE,ORDER BY,LIMIT语句
+func (p *QueryBuilder[T]) querySQL(m *meta, d Dialect) (string, []interface{}, error) {
+	condition, params, err := p.whereSQL(m, d)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(p.orders) > 0 {
+		orders := make([]string, 0, len(p.orders))
+		for _, order := range p.orders {
+			column, desc := order, false
+			if strings.HasPrefix(order, "-") {
+				column, desc = order[1:], true
+			}
+			column, err = quoteColumn(m, d, column)
+			if err != nil {
+				return "", nil, err
+			}
+			if desc {
+				column += " DESC"
+			}
+			orders = append(orders, column)
+		}
+		condition += " ORDER BY " + strings.Join(orders, ",")
+	}
+	if limit := d.Limit(p.limit, p.offset); limit != "" {
+		condition += " " + limit
+	}
+	return condition, params, nil
+}
+
+// Find 查询实体
+func (p *QueryBuilder[T]) Find(op *Op) ([]T, error) {
+	return p.FindCtx(op.Context(), op)
+}
+
+// FindCtx 使用ctx查询实体
+func (p *QueryBuilder[T]) FindCtx(ctx context.Context, op *Op) ([]T, error) {
+	m := findEntityMeta(p.entity)
+	condition, params, err := p.querySQL(m, op.Dialect())
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []Entity
+	if len(p.columns) > 0 {
+		for _, column := range p.columns {
+			if _, err = quoteColumn(m, op.Dialect(), column); err != nil {
+				return nil, err
+			}
+		}
+		entities, err = QueryColumnsCtx(ctx, op, p.entity, p.columns, condition, params...)
+	} else {
+		entities, err = QueryCtx(ctx, op, p.entity, condition, params...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(p.preloads) > 0 {
+		if err = PreloadCtx(ctx, op, entities, p.preloads...); err != nil {
+			return nil, err
+		}
+	}
+	return toTyped[T](entities), nil
+}
+
+// First 查询第一个实体,没有找到时ok为false
+func (p *QueryBuilder[T]) First(op *Op) (entity T, ok bool, err error) {
+	return p.FirstCtx(op.Context(), op)
+}
+
+// FirstCtx 使用ctx查询第一个实体,没有找到时ok为false
+func (p *QueryBuilder[T]) FirstCtx(ctx context.Context, op *Op) (entity T, ok bool, err error) {
+	limit := p.limit
+	p.limit = 1
+	defer func() {
+		p.limit = limit
+	}()
+	entities, err := p.FindCtx(ctx, op)
+	if err != nil || len(entities) == 0 {
+		return
+	}
+	return entities[0], true, nil
+}
+
+// Count 查询满足条件的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) Count(op *Op) (int64, error) {
+	return p.CountCtx(op.Context(), op)
+}
+
+// CountCtx 使用ctx查询满足条件的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) CountCtx(ctx context.Context, op *Op) (int64, error) {
+	condition, params, err := p.whereSQL(findEntityMeta(p.entity), op.Dialect())
+	if err != nil {
+		return 0, err
+	}
+	return QueryCountCtx(ctx, op, p.entity, "*", condition, params...)
+}
+
+// Delete 删除满足条件的实体,返回删除的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) Delete(op *Op) (int64, error) {
+	return p.DeleteCtx(op.Context(), op)
+}
+
+// DeleteCtx 使用ctx删除满足条件的实体,返回删除的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) DeleteCtx(ctx context.Context, op *Op) (int64, error) {
+	condition, params, err := p.whereSQL(findEntityMeta(p.entity), op.Dialect())
+	if err != nil {
+		return 0, err
+	}
+	return DelByConditionCtx(ctx, op, p.entity, condition, params...)
+}
+
+// Update 使用Set设置的列更新满足条件的实体,返回更新的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) Update(op *Op) (int64, error) {
+	return p.UpdateCtx(op.Context(), op)
+}
+
+// UpdateCtx 使用ctx和Set设置的列更新满足条件的实体,返回更新的条数,忽略OrderBy,Limit和Offset
+func (p *QueryBuilder[T]) UpdateCtx(ctx context.Context, op *Op) (int64, error) {
+	if len(p.sets) == 0 {
+		return 0, fmt.Errorf("no column to update")
+	}
+	m := findEntityMeta(p.entity)
+	columns := make([]string, 0, len(p.sets))
+	params := make([]interface{}, 0, len(p.sets))
+	for _, set := range p.sets {
+		column, err := quoteColumn(m, op.Dialect(), set.column)
+		if err != nil {
+			return 0, err
+		}
+		columns = append(columns, column+"=?")
+		params = append(params, condParam(m, set.column, set.val))
+	}
+	condition, condParams, err := p.whereSQL(m, op.Dialect())
+	if err != nil {
+		return 0, err
+	}
+	return UpdateColumnsCtx(ctx, op, p.entity, strings.Join(columns, ","), condition, append(params, condParams...)...)
+}
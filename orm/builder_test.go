@@ -0,0 +1,87 @@
+package orm
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderSQL(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	m := findEntityMeta(&tmodel{})
+
+	b := From[*tmodel]().Where(Eq("name", "d0ngw"), In("id", []int64{1, 2, 3}), Or(IsNull("f64"), Gt("age", 10))).OrderBy("-create_time", "id").Limit(20).Offset(40)
+	condition, params, err := b.querySQL(m, MySQLDialect)
+	assert.NoError(t, err)
+	assert.Equal(t, "WHERE (`name` = ? AND `id` IN (?,?,?) AND (`f64` IS NULL OR `age` > ?)) ORDER BY `create_time` DESC,`id` LIMIT 20 OFFSET 40", condition)
+	assert.EqualValues(t, []interface{}{"d0ngw", int64(1), int64(2), int64(3), 10}, params)
+
+	condition, _, err = From[*tmodel]().Where(Eq("name", "d0ngw")).OrderBy("id").Offset(10).querySQL(m, MySQLDialect)
+	assert.NoError(t, err)
+	assert.Equal(t, "WHERE `name` = ? ORDER BY `id` LIMIT 18446744073709551615 OFFSET 10", condition)
+
+	condition, params, err = From[*tmodel]().Where(In("id"), Not(Between("age", 1, 2))).querySQL(m, MySQLDialect)
+	assert.NoError(t, err)
+	assert.Equal(t, "WHERE (1 = 0 AND NOT (`age` BETWEEN ? AND ?))", condition)
+	assert.EqualValues(t, []interface{}{1, 2}, params)
+
+	condition, params, err = From[*tmodel]().querySQL(m, MySQLDialect)
+	assert.NoError(t, err)
+	assert.Equal(t, "", condition)
+	assert.Empty(t, params)
+
+	_, _, err = From[*tmodel]().Where(Eq("no_column", 1)).querySQL(m, MySQLDialect)
+	assert.Error(t, err)
+
+	_, _, err = From[*tmodel]().OrderBy("-no_column").querySQL(m, MySQLDialect)
+	assert.Error(t, err)
+
+	condition, params, err = From[*tmodel]().Where(Eq("name", "d0ngw")).OrderBy("-id").Limit(10).querySQL(m, PostgresDialect)
+	assert.NoError(t, err)
+	assert.Equal(t, `WHERE "name" = ? ORDER BY "id" DESC LIMIT 10`, condition)
+	assert.EqualValues(t, []interface{}{"d0ngw"}, params)
+}
+
+func TestBuilder(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+
+	dboper := &Op{pool: dbpool}
+	now := time.Now().Unix()
+	for i := 0; i < 3; i++ {
+		tm := tmodel{Name: sql.NullString{String: "builder", Valid: true}, Time: sql.NullInt64{Int64: now, Valid: true}, Age: int64(i)}
+		err := Add(dboper, &tm)
+		assert.NoError(t, err)
+	}
+
+	b := From[*tmodel]().Where(Eq("name", "builder"))
+	total, err := b.Count(dboper)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+
+	l, err := From[*tmodel]().Where(Eq("name", "builder"), Ge("age", 1)).OrderBy("-age").Find(dboper)
+	assert.NoError(t, err)
+	assert.Len(t, l, 2)
+	assert.EqualValues(t, 2, l[0].Age)
+
+	first, ok, err := From[*tmodel]().Where(Eq("name", "builder")).OrderBy("age").Select("id", "age").First(dboper)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 0, first.Age)
+	assert.False(t, first.Name.Valid)
+
+	updated, err := From[*tmodel]().Where(Eq("name", "builder"), Lt("age", 2)).Set("f64", 0.5).Update(dboper)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, updated)
+
+	deleted, err := b.Delete(dboper)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+
+	_, ok, err = b.First(dboper)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
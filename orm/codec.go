@@ -0,0 +1,231 @@
+package orm
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	c "github.com/d0ngw/go/common"
+)
+
+const (
+	// JSONCodec 使用json编码的列,字段可以是map,struct,slice及其指针
+	JSONCodec = "json"
+	// AESCodec 使用AES加密并以base64保存的列,字段必须是string或者[]byte,密钥通过SetAESKey或者DBConfig.AesKey设置
+	AESCodec = "aes"
+)
+
+// Codec 列的编解码器,实体字段通过codec标签指定,如`column:"ext" codec:"json"`
+type Codec interface {
+	// Encode 将字段的值v编码为写入数据库的值
+	Encode(v reflect.Value) (driver.Value, error)
+	// Decode 将从数据库读取的值src解码到字段v,src为nil表示NULL
+	Decode(src []byte, v reflect.Value) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{JSONCodec: jsonCodec{}, AESCodec: &aesCodec{}}
+)
+
+// RegisterCodec 注册名称为name的编解码器,codec为nil时删除;需要在解析实体元数据前注册
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec == nil {
+		delete(codecs, name)
+		return
+	}
+	codecs[name] = codec
+}
+
+func findCodec(name string) Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs[name]
+}
+
+// SetAESKey 设置aes编解码器使用的密钥,长度必须是16,24或者32
+func SetAESKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("invalid aes key length %d", len(key))
+	}
+	codec, ok := findCodec(AESCodec).(*aesCodec)
+	if !ok {
+		return fmt.Errorf("aes codec is replaced")
+	}
+	codec.setKey(key)
+	return nil
+}
+
+// setupCodecs 使用config中的密钥设置编解码器;aes密钥是全局的,已经设置了不同的密钥时返回错误,不覆盖其他连接池的密钥
+func setupCodecs(config *DBConfig) error {
+	if config.AesKey == "" {
+		return nil
+	}
+	codec, ok := findCodec(AESCodec).(*aesCodec)
+	if !ok {
+		return fmt.Errorf("aes codec is replaced")
+	}
+	if key, err := codec.getKey(); err == nil && !bytes.Equal(key, []byte(config.AesKey)) {
+		return fmt.Errorf("aes key conflicts with the key already set")
+	}
+	return SetAESKey([]byte(config.AesKey))
+}
+
+// codecValue 写入时使用codec编码的字段值
+type codecValue struct {
+	codec Codec
+	v     reflect.Value
+}
+
+// Value implements driver.Valuer
+func (p codecValue) Value() (driver.Value, error) {
+	return p.codec.Encode(p.v)
+}
+
+// codecScanner 读取时使用codec解码到字段
+type codecScanner struct {
+	codec Codec
+	v     reflect.Value
+}
+
+// Scan implements sql.Scanner
+func (p *codecScanner) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case nil:
+		return p.codec.Decode(nil, p.v)
+	case string:
+		return p.codec.Decode([]byte(val), p.v)
+	case []byte:
+		return p.codec.Decode(val, p.v)
+	}
+	return fmt.Errorf("codec can't scan %T", src)
+}
+
+// fieldParam 字段写入数据库的参数
+func fieldParam(ind reflect.Value, field *metaField) interface{} {
+	v := ind.FieldByIndex(field.index)
+	if field.codec != nil {
+		return codecValue{codec: field.codec, v: v}
+	}
+	return v.Interface()
+}
+
+// fieldDest 扫描字段时使用的目标
+func fieldDest(ind reflect.Value, field *metaField) interface{} {
+	v := ind.FieldByIndex(field.index)
+	if field.codec != nil {
+		return &codecScanner{codec: field.codec, v: v}
+	}
+	return v.Addr().Interface()
+}
+
+// jsonCodec json编解码,nil的map,slice及指针保存为NULL
+type jsonCodec struct{}
+
+func (p jsonCodec) Encode(v reflect.Value) (driver.Value, error) {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("json encode fail,err:%v", err)
+	}
+	return string(data), nil
+}
+
+func (p jsonCodec) Decode(src []byte, v reflect.Value) error {
+	if len(src) == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	ptr := reflect.New(v.Type())
+	if err := json.Unmarshal(src, ptr.Interface()); err != nil {
+		return fmt.Errorf("json decode fail,err:%v", err)
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// aesCodec 使用common.AesEncrypt加密后以base64保存,相同的明文加密结果相同,可以用于等值查询
+type aesCodec struct {
+	mu  sync.RWMutex
+	key []byte
+}
+
+func (p *aesCodec) setKey(key []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = append([]byte(nil), key...)
+}
+
+func (p *aesCodec) getKey() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.key == nil {
+		return nil, fmt.Errorf("aes key is not set")
+	}
+	return p.key, nil
+}
+
+func (p *aesCodec) Encode(v reflect.Value) (driver.Value, error) {
+	var data []byte
+	switch {
+	case v.Kind() == reflect.String:
+		data = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.IsNil() {
+			return nil, nil
+		}
+		data = v.Bytes()
+	default:
+		return nil, fmt.Errorf("aes codec unsupported type %s", v.Type())
+	}
+	key, err := p.getKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := c.AesEncrypt(data, key)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (p *aesCodec) Decode(src []byte, v reflect.Value) error {
+	if src == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	key, err := p.getKey()
+	if err != nil {
+		return err
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(string(src))
+	if err != nil {
+		return fmt.Errorf("aes decode fail,err:%v", err)
+	}
+	data, err := c.AesDecrypt(encrypted, key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(string(data))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(data)
+	default:
+		return fmt.Errorf("aes codec unsupported type %s", v.Type())
+	}
+	return nil
+}
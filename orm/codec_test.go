@@ -0,0 +1,101 @@
+package orm
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecAddr struct {
+	City string `json:"city"`
+	Zip  int    `json:"zip"`
+}
+
+type codecModel struct {
+	ID     int64             `column:"id" pk:"y" pkAuto:"n"`
+	Tags   []string          `column:"tags" codec:"json"`
+	Attrs  map[string]string `column:"attrs" codec:"json"`
+	Addr   codecAddr         `column:"addr" codec:"json"`
+	Home   *codecAddr        `column:"home" codec:"json"`
+	Phone  string            `column:"phone" codec:"aes"`
+	Secret []byte            `column:"secret" codec:"aes"`
+}
+
+func (p *codecModel) TableName() string {
+	return "codec_model"
+}
+
+type badCodecModel struct {
+	ID  int64 `column:"id" pk:"y"`
+	Age int   `column:"age" codec:"aes"`
+}
+
+func (p *badCodecModel) TableName() string {
+	return "bad_codec_model"
+}
+
+func TestCodec(t *testing.T) {
+	AddMeta(&codecModel{})
+	createTables(t, &codecModel{})
+
+	op := &Op{pool: dbpool}
+	m := &codecModel{ID: 1, Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}, Addr: codecAddr{City: "bj", Zip: 100}, Phone: "13800000000", Secret: []byte("s")}
+	aes := findCodec(AESCodec).(*aesCodec)
+	aes.setKey(nil)
+	defer aes.setKey(nil)
+	assert.Error(t, Add(op, m))
+
+	assert.Error(t, SetAESKey([]byte("short")))
+	assert.NoError(t, SetAESKey([]byte("0123456789abcdef")))
+	assert.NoError(t, setupCodecs(&DBConfig{AesKey: "0123456789abcdef"}))
+	assert.Error(t, setupCodecs(&DBConfig{AesKey: "fedcba9876543210"}))
+	assert.NoError(t, Add(op, m))
+	assert.NoError(t, Add(op, &codecModel{ID: 2, Phone: "13900000000"}))
+
+	var tags, home sql.NullString
+	var phone string
+	assert.NoError(t, dbpool.db.QueryRow("SELECT tags,home,phone FROM codec_model WHERE id = 1").Scan(&tags, &home, &phone))
+	assert.Equal(t, `["a","b"]`, tags.String)
+	assert.False(t, home.Valid)
+	assert.NotEqual(t, "13800000000", phone)
+
+	e, err := Get(op, &codecModel{}, int64(1))
+	assert.NoError(t, err)
+	loaded := e.(*codecModel)
+	assert.Equal(t, m.Tags, loaded.Tags)
+	assert.Equal(t, m.Attrs, loaded.Attrs)
+	assert.Equal(t, m.Addr, loaded.Addr)
+	assert.Nil(t, loaded.Home)
+	assert.Equal(t, "13800000000", loaded.Phone)
+	assert.Equal(t, []byte("s"), loaded.Secret)
+
+	loaded.Home = &codecAddr{City: "sh"}
+	loaded.Tags = nil
+	_, err = Update(op, loaded)
+	assert.NoError(t, err)
+	e, err = Get(op, &codecModel{}, int64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "sh", e.(*codecModel).Home.City)
+	assert.Nil(t, e.(*codecModel).Tags)
+
+	found, err := From[*codecModel]().Where(Eq("phone", "13900000000")).Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.EqualValues(t, 2, found[0].ID)
+
+	n, err := From[*codecModel]().Where(In("phone", "13800000000", "13900000000")).Count(op)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	n, err = From[*codecModel]().Set("phone", "13700000000").Where(Eq("id", 2)).Update(op)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	e, err = Get(op, &codecModel{}, int64(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "13700000000", e.(*codecModel).Phone)
+
+	assert.Panics(t, func() {
+		MetaOf(&badCodecModel{})
+	})
+}
@@ -2,7 +2,9 @@ package orm
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync/atomic"
 
 	// import mysql
 	_ "github.com/go-sql-driver/mysql"
@@ -21,6 +23,32 @@ func (e *DBError) Error() string {
 	return fmt.Sprintf("DBError msg:%s,err:%v", e.Msg, e.Err)
 }
 
+// Unwrap 返回原始的错误
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// ErrStaleEntity 使用乐观锁更新时版本号不匹配(实体已被修改或者不存在),可以用errors.Is判断
+var ErrStaleEntity = &DBError{Msg: "stale entity"}
+
+// IsStaleEntity 是否是乐观锁版本号不匹配的错误
+func IsStaleEntity(err error) bool {
+	return errors.Is(err, ErrStaleEntity)
+}
+
+// RetryOnStale 执行读取-修改-更新的函数f,f返回ErrStaleEntity时重新执行,最多执行maxAttempts次
+func RetryOnStale(maxAttempts int, f func() error) (err error) {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	for i := 0; i < maxAttempts; i++ {
+		if err = f(); !IsStaleEntity(err) {
+			return
+		}
+	}
+	return
+}
+
 // NewDBError  构建数据库操作错误
 func NewDBError(err error, msg string) *DBError {
 	return &DBError{Msg: msg, Err: err}
@@ -80,8 +108,16 @@ func (p EntitySlice) ToInterface() []interface{} {
 
 // Pool 数据库连接池
 type Pool struct {
-	db   *sql.DB
-	name string
+	db           *sql.DB
+	name         string
+	dialect      Dialect
+	replicas     *replicaSet                   //从库,读操作在Op没有写操作时使用
+	interceptors atomic.Pointer[[]Interceptor] //连接池的拦截器
+}
+
+// NewPool 使用db和dialect创建连接池,dialect为nil时使用MySQLDialect
+func NewPool(db *sql.DB, dialect Dialect) *Pool {
+	return &Pool{db: db, dialect: dialect}
 }
 
 //NewOp 创建DBOper
@@ -94,5 +130,35 @@ func (p *Pool) Name() string {
 	return p.name
 }
 
+// Dialect 数据库方言
+func (p *Pool) Dialect() Dialect {
+	if p.dialect == nil {
+		return MySQLDialect
+	}
+	return p.dialect
+}
+
+// readDB 选择读操作使用的数据库,没有可用的从库时使用主库
+func (p *Pool) readDB() *sql.DB {
+	if p.replicas != nil {
+		if r := p.replicas.pick(); r != nil {
+			return r.db
+		}
+	}
+	return p.db
+}
+
+// Close 关闭主库及从库的连接,停止从库的健康检查
+func (p *Pool) Close() error {
+	var err error
+	if p.replicas != nil {
+		err = p.replicas.close()
+	}
+	if e := p.db.Close(); e != nil {
+		err = e
+	}
+	return err
+}
+
 // PoolFunc the func to crate db pool
 type PoolFunc func(config *DBConfig) (pool *Pool, err error)
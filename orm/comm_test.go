@@ -10,10 +10,33 @@ import (
 	"path"
 	"strings"
 	"testing"
+
+	c "github.com/d0ngw/go/common"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
 )
 
 var (
-	config = DBConfig{
+	// 环境变量ORM_TEST_DRIVER=sqlite时使用内存中的sqlite运行测试,默认使用mysql
+	testDriver  = os.Getenv("ORM_TEST_DRIVER")
+	config      = testConfig(testDriver)
+	dbpool, err = NewDBPool(&config)
+
+	setupSQL, _    = ioutil.ReadFile(testdataFile("setup.sql"))
+	teardownSQL, _ = ioutil.ReadFile(testdataFile("teardown.sql"))
+)
+
+func testConfig(driver string) DBConfig {
+	if driver == SQLiteDialectName {
+		// 使用共享缓存,连接池中的连接访问同一个内存数据库
+		return DBConfig{
+			Driver:  SQLiteDialectName,
+			URL:     "file:test.db?mode=memory&cache=shared",
+			MaxConn: 2,
+			MaxIdle: 2,
+		}
+	}
+	return DBConfig{
 		User:    "root",
 		Pass:    "123456",
 		URL:     "127.0.0.1:3306",
@@ -21,11 +44,32 @@ var (
 		MaxConn: 100,
 		MaxIdle: 10,
 	}
-	dbpool, err = NewMySQLDBPool(&config)
+}
 
-	setupSQL, _    = ioutil.ReadFile(path.Join("testdata", "setup.sql"))
-	teardownSQL, _ = ioutil.ReadFile(path.Join("testdata", "teardown.sql"))
-)
+// testdataFile 优先使用testdata下与testDriver同名目录中的文件
+func testdataFile(name string) string {
+	if testDriver != "" {
+		file := path.Join("testdata", testDriver, name)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return path.Join("testdata", name)
+}
+
+// loadShardConf 加载testdata/shard.yaml,非mysql时所有的分片都使用config
+func loadShardConf(conf *shardConf) error {
+	if err := c.LoadYAMLFromPath(testdataFile("shard.yaml"), conf); err != nil {
+		return err
+	}
+	if testDriver != "" && testDriver != MySQLDialectName && conf.DBShards != nil {
+		for name := range conf.DBShards.Shards {
+			shardConfig := config
+			conf.DBShards.Shards[name] = &shardConfig
+		}
+	}
+	return nil
+}
 
 // Conf 配置
 type Conf struct {
@@ -141,6 +185,24 @@ func (p *User) TableName() string {
 	return "user"
 }
 
+// createTables 在dbpool中创建实体的表,测试结束时删除
+func createTables(t *testing.T, entities ...Entity) {
+	t.Helper()
+	for _, entity := range entities {
+		tname, err := tblName(entity)
+		assert.NoError(t, err)
+		stmts, err := CreateTableSQL(entity, dbpool.Dialect())
+		assert.NoError(t, err)
+		for _, stmt := range stmts {
+			_, err = dbpool.db.Exec(stmt)
+			assert.NoError(t, err)
+		}
+		t.Cleanup(func() {
+			dbpool.db.Exec(DropTableSQL(tname))
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	setUp()
 	code := m.Run()
@@ -26,15 +26,29 @@ type EntityShardConfigurer interface {
 
 //DBConfig 数据库配置
 type DBConfig struct {
-	User          string            `yaml:"user"`
-	Pass          string            `yaml:"pass"`
-	URL           string            `yaml:"url"`
-	Schema        string            `yaml:"schema"`
-	MaxConn       int               `yaml:"maxConn"`
-	MaxIdle       int               `yaml:"maxIdle"`
-	MaxTimeSecond int               `yaml:"maxTimeSecond"`
-	Charset       string            `yaml:"charset"`
-	Ext           map[string]string `yaml:"ext"`
+	Driver             string            `yaml:"driver"`     //数据库方言:mysql(默认),postgres,sqlite
+	DriverName         string            `yaml:"driverName"` //database/sql中注册的驱动名称,为空时使用方言的默认驱动
+	User               string            `yaml:"user"`
+	Pass               string            `yaml:"pass"`
+	URL                string            `yaml:"url"`
+	Schema             string            `yaml:"schema"`
+	MaxConn            int               `yaml:"maxConn"`
+	MaxIdle            int               `yaml:"maxIdle"`
+	MaxTimeSecond      int               `yaml:"maxTimeSecond"`
+	Charset            string            `yaml:"charset"`
+	Ext                map[string]string `yaml:"ext"`
+	Replicas           []*ReplicaConfig  `yaml:"replicas"`           //从库,读操作路由到从库
+	ReplicaPolicy      string            `yaml:"replicaPolicy"`      //从库的选择策略:round_robin(默认),weighted
+	ReplicaCheckSecond int               `yaml:"replicaCheckSecond"` //从库健康检查的间隔秒数,为0时使用5秒,<0时不检查
+	AesKey             string            `yaml:"aesKey"`             //codec:"aes"的列使用的密钥,长度为16,24或者32,所有连接池必须相同
+}
+
+// ReplicaConfig 从库配置,未设置的User,Pass使用主库的配置
+type ReplicaConfig struct {
+	URL    string `yaml:"url"`
+	User   string `yaml:"user"`
+	Pass   string `yaml:"pass"`
+	Weight int    `yaml:"weight"` //权重,weighted策略使用,<=0时为1
 }
 
 // Parse implements DBConfigurer
@@ -42,12 +56,53 @@ func (p *DBConfig) Parse() error {
 	if p.URL == "" {
 		return fmt.Errorf("need url")
 	}
-	if p.Schema == "" {
+	dialect, err := DialectOf(p.Driver)
+	if err != nil {
+		return err
+	}
+	if p.Schema == "" && dialect != SQLiteDialect {
 		return fmt.Errorf("need schema")
 	}
+	switch p.ReplicaPolicy {
+	case "", ReplicaRoundRobin, ReplicaWeighted:
+	default:
+		return fmt.Errorf("invalid replica policy %s", p.ReplicaPolicy)
+	}
+	switch len(p.AesKey) {
+	case 0, 16, 24, 32:
+	default:
+		return fmt.Errorf("invalid aes key length %d", len(p.AesKey))
+	}
+	for i, replica := range p.Replicas {
+		if replica == nil || replica.URL == "" {
+			return fmt.Errorf("need url for replica %d", i)
+		}
+	}
 	return nil
 }
 
+// replicaConfig 从库的完整配置
+func (p *DBConfig) replicaConfig(replica *ReplicaConfig) *DBConfig {
+	config := *p
+	config.URL = replica.URL
+	if replica.User != "" {
+		config.User = replica.User
+	}
+	if replica.Pass != "" {
+		config.Pass = replica.Pass
+	}
+	config.Replicas = nil
+	return &config
+}
+
+// driverName 返回database/sql的驱动名称
+func (p *DBConfig) driverName(dialect Dialect) string {
+	if p.DriverName != "" {
+		return p.DriverName
+	}
+	return dialect.DriverName()
+}
+
 // DBConfig implements DBConfigurer
 func (p *DBConfig) DBConfig() *DBConfig {
 	return p
@@ -0,0 +1,254 @@
+package orm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect 数据库方言,处理不同数据库在SQL语法上的差异
+type Dialect interface {
+	// Name 方言的名称
+	Name() string
+	// DriverName database/sql中注册的默认驱动名称
+	DriverName() string
+	// Quote 为表名、列名等标识符加上引号
+	Quote(identifier string) string
+	// Rebind 将语句中的?占位符转换为方言的占位符
+	Rebind(query string) string
+	// Upsert 插入时唯一键冲突则使用assignments更新的语句,拼接在INSERT语句之后;conflictColumns为冲突的唯一键,
+	// 需要指定冲突列的方言在conflictColumns为空时返回错误
+	Upsert(conflictColumns []string, assignments []string) (string, error)
+	// Excluded 在Upsert的assignments中引用待插入的行中column的值
+	Excluded(column string) string
+	// Returning 插入后返回自增主键的语句,拼接在INSERT语句之后;为空表示使用sql.Result.LastInsertId
+	Returning(pkColumn string) string
+	// FirstInsertID 多行插入rows行后,根据LastInsertId推算第一行的自增主键
+	FirstInsertID(lastInsertID int64, rows int) int64
+	// Limit 生成LIMIT及OFFSET语句,limit<=0时表示不限制条数,此时offset>0仍然生效
+	Limit(limit, offset int) string
+}
+
+const (
+	// MySQLDialectName mysql
+	MySQLDialectName = "mysql"
+	// PostgresDialectName postgres
+	PostgresDialectName = "postgres"
+	// SQLiteDialectName sqlite
+	SQLiteDialectName = "sqlite"
+)
+
+var (
+	// MySQLDialect mysql方言
+	MySQLDialect Dialect = &mysqlDialect{}
+	// PostgresDialect postgres方言
+	PostgresDialect Dialect = &postgresDialect{}
+	// SQLiteDialect sqlite方言
+	SQLiteDialect Dialect = &sqliteDialect{}
+)
+
+// DialectOf 根据名称查找方言,name为空时返回MySQLDialect
+func DialectOf(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "", MySQLDialectName:
+		return MySQLDialect, nil
+	case PostgresDialectName, "postgresql", "pgx":
+		return PostgresDialect, nil
+	case SQLiteDialectName, "sqlite3":
+		return SQLiteDialect, nil
+	}
+	return nil, fmt.Errorf("unsupported dialect %s", name)
+}
+
+// NewDBPool 根据DBConfig.Driver选择方言并创建连接池
+func NewDBPool(config *DBConfig) (*Pool, error) {
+	if config == nil {
+		return nil, &DBError{"Not found config", nil}
+	}
+	dialect, err := DialectOf(config.Driver)
+	if err != nil {
+		return nil, NewDBError(err, "Invalid config")
+	}
+	switch dialect {
+	case PostgresDialect:
+		return NewPostgresDBPool(config)
+	case SQLiteDialect:
+		return NewSQLiteDBPool(config)
+	}
+	return NewMySQLDBPool(config)
+}
+
+// limitOffset 生成LIMIT及OFFSET语句,noLimit为方言中不限制条数的LIMIT值,为空时只生成OFFSET
+func limitOffset(limit, offset int, noLimit string) string {
+	if limit <= 0 {
+		if offset <= 0 {
+			return ""
+		}
+		if noLimit == "" {
+			return "OFFSET " + strconv.Itoa(offset)
+		}
+		return "LIMIT " + noLimit + " OFFSET " + strconv.Itoa(offset)
+	}
+	ret := "LIMIT " + strconv.Itoa(limit)
+	if offset > 0 {
+		ret += " OFFSET " + strconv.Itoa(offset)
+	}
+	return ret
+}
+
+// onConflict 生成ON CONFLICT ... DO UPDATE语句
+func onConflict(dialect Dialect, conflictColumns []string, assignments []string) (string, error) {
+	if len(conflictColumns) == 0 {
+		return "", fmt.Errorf("%s upsert need conflict columns,use a non auto increment pk or unique tag", dialect.Name())
+	}
+	columns := make([]string, 0, len(conflictColumns))
+	for _, column := range conflictColumns {
+		columns = append(columns, dialect.Quote(column))
+	}
+	return " ON CONFLICT (" + strings.Join(columns, ",") + ") DO UPDATE SET " + strings.Join(assignments, ","), nil
+}
+
+type mysqlDialect struct{}
+
+func (p *mysqlDialect) Name() string {
+	return MySQLDialectName
+}
+
+func (p *mysqlDialect) DriverName() string {
+	return "mysql"
+}
+
+func (p *mysqlDialect) Quote(identifier string) string {
+	return "`" + identifier + "`"
+}
+
+func (p *mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+// Upsert mysql在任何唯一键冲突时都会更新,忽略conflictColumns
+func (p *mysqlDialect) Upsert(conflictColumns []string, assignments []string) (string, error) {
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ","), nil
+}
+
+func (p *mysqlDialect) Excluded(column string) string {
+	return "VALUES(" + p.Quote(column) + ")"
+}
+
+func (p *mysqlDialect) Returning(pkColumn string) string {
+	return ""
+}
+
+// FirstInsertID mysql多行插入时LastInsertId返回的是第一行的id,之后的行按auto_increment_increment递增,
+// 回填主键时假定auto_increment_increment为1
+func (p *mysqlDialect) FirstInsertID(lastInsertID int64, rows int) int64 {
+	return lastInsertID
+}
+
+// Limit mysql的OFFSET必须和LIMIT一起使用,不限制条数时使用最大的LIMIT
+func (p *mysqlDialect) Limit(limit, offset int) string {
+	return limitOffset(limit, offset, "18446744073709551615")
+}
+
+type postgresDialect struct{}
+
+func (p *postgresDialect) Name() string {
+	return PostgresDialectName
+}
+
+func (p *postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (p *postgresDialect) Quote(identifier string) string {
+	return `"` + identifier + `"`
+}
+
+// Rebind 将?转换为$1,$2...,单引号中的?不做转换
+func (p *postgresDialect) Rebind(query string) string {
+	if strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inQuote = !inQuote
+			b.WriteByte(ch)
+		case ch == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func (p *postgresDialect) Upsert(conflictColumns []string, assignments []string) (string, error) {
+	return onConflict(p, conflictColumns, assignments)
+}
+
+func (p *postgresDialect) Excluded(column string) string {
+	return "excluded." + p.Quote(column)
+}
+
+func (p *postgresDialect) Returning(pkColumn string) string {
+	return " RETURNING " + p.Quote(pkColumn)
+}
+
+// FirstInsertID postgres使用RETURNING返回自增主键
+func (p *postgresDialect) FirstInsertID(lastInsertID int64, rows int) int64 {
+	return lastInsertID
+}
+
+func (p *postgresDialect) Limit(limit, offset int) string {
+	return limitOffset(limit, offset, "")
+}
+
+type sqliteDialect struct{}
+
+func (p *sqliteDialect) Name() string {
+	return SQLiteDialectName
+}
+
+func (p *sqliteDialect) DriverName() string {
+	return "sqlite"
+}
+
+func (p *sqliteDialect) Quote(identifier string) string {
+	return `"` + identifier + `"`
+}
+
+func (p *sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (p *sqliteDialect) Upsert(conflictColumns []string, assignments []string) (string, error) {
+	return onConflict(p, conflictColumns, assignments)
+}
+
+func (p *sqliteDialect) Excluded(column string) string {
+	return "excluded." + p.Quote(column)
+}
+
+func (p *sqliteDialect) Returning(pkColumn string) string {
+	return ""
+}
+
+// FirstInsertID sqlite多行插入时LastInsertId返回的是最后一行的id
+func (p *sqliteDialect) FirstInsertID(lastInsertID int64, rows int) int64 {
+	return lastInsertID - int64(rows) + 1
+}
+
+// Limit sqlite的OFFSET必须和LIMIT一起使用,LIMIT为负数时表示不限制
+func (p *sqliteDialect) Limit(limit, offset int) string {
+	return limitOffset(limit, offset, "-1")
+}
@@ -0,0 +1,59 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect(t *testing.T) {
+	d, err := DialectOf("")
+	assert.NoError(t, err)
+	assert.Equal(t, MySQLDialect, d)
+
+	d, err = DialectOf("PostgreSQL")
+	assert.NoError(t, err)
+	assert.Equal(t, PostgresDialect, d)
+
+	d, err = DialectOf("sqlite3")
+	assert.NoError(t, err)
+	assert.Equal(t, SQLiteDialect, d)
+
+	_, err = DialectOf("oracle")
+	assert.Error(t, err)
+
+	assert.Equal(t, "SELECT * FROM tt WHERE id = ? AND name = '?'", MySQLDialect.Rebind("SELECT * FROM tt WHERE id = ? AND name = '?'"))
+	assert.Equal(t, "SELECT * FROM tt WHERE id = $1 AND name = '?' AND age IN ($2,$3)", PostgresDialect.Rebind("SELECT * FROM tt WHERE id = ? AND name = '?' AND age IN (?,?)"))
+
+	upsert, err := MySQLDialect.Upsert(nil, []string{"`name`=?", "`age`=" + MySQLDialect.Excluded("age")})
+	assert.NoError(t, err)
+	assert.Equal(t, " ON DUPLICATE KEY UPDATE `name`=?,`age`=VALUES(`age`)", upsert)
+	upsert, err = PostgresDialect.Upsert([]string{"id"}, []string{`"name"=?`, `"age"=` + PostgresDialect.Excluded("age")})
+	assert.NoError(t, err)
+	assert.Equal(t, ` ON CONFLICT ("id") DO UPDATE SET "name"=?,"age"=excluded."age"`, upsert)
+	upsert, err = SQLiteDialect.Upsert([]string{"tenant", "name"}, []string{`"age"=?`})
+	assert.NoError(t, err)
+	assert.Equal(t, ` ON CONFLICT ("tenant","name") DO UPDATE SET "age"=?`, upsert)
+	_, err = SQLiteDialect.Upsert(nil, []string{`"age"=?`})
+	assert.Error(t, err)
+
+	assert.EqualValues(t, 10, MySQLDialect.FirstInsertID(10, 3))
+	assert.EqualValues(t, 8, SQLiteDialect.FirstInsertID(10, 3))
+
+	assert.Equal(t, "", MySQLDialect.Returning("id"))
+	assert.Equal(t, ` RETURNING "id"`, PostgresDialect.Returning("id"))
+
+	assert.Equal(t, "", MySQLDialect.Limit(0, 0))
+	assert.Equal(t, "LIMIT 18446744073709551615 OFFSET 10", MySQLDialect.Limit(0, 10))
+	assert.Equal(t, "OFFSET 10", PostgresDialect.Limit(0, 10))
+	assert.Equal(t, "LIMIT -1 OFFSET 10", SQLiteDialect.Limit(-1, 10))
+	assert.Equal(t, "LIMIT 10", SQLiteDialect.Limit(10, 0))
+	assert.Equal(t, "LIMIT 10 OFFSET 20", PostgresDialect.Limit(10, 20))
+
+	config := &DBConfig{Driver: "sqlite", URL: ":memory:"}
+	assert.NoError(t, config.Parse())
+	config = &DBConfig{Driver: "postgres", URL: "127.0.0.1:5432"}
+	assert.Error(t, config.Parse())
+	config = &DBConfig{Driver: "oracle", URL: "127.0.0.1:5432", Schema: "test"}
+	assert.Error(t, config.Parse())
+}
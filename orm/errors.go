@@ -0,0 +1,144 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrorKind 数据库错误的类别
+type ErrorKind int
+
+const (
+	// ErrorUnknown 无法识别的错误
+	ErrorUnknown ErrorKind = iota
+	// ErrorDuplicateKey 主键或者唯一索引冲突,mysql 1062,1586,postgres 23505
+	ErrorDuplicateKey
+	// ErrorDeadlock 死锁或者序列化失败,事务已被回滚,mysql 1213,postgres 40P01,40001
+	ErrorDeadlock
+	// ErrorLockTimeout 等待锁超时,mysql 1205,postgres 55P03
+	ErrorLockTimeout
+	// ErrorConnectionLost 连接断开,语句是否已经执行无法确定
+	ErrorConnectionLost
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorDuplicateKey:
+		return "duplicate_key"
+	case ErrorDeadlock:
+		return "deadlock"
+	case ErrorLockTimeout:
+		return "lock_timeout"
+	case ErrorConnectionLost:
+		return "connection_lost"
+	}
+	return "unknown"
+}
+
+// sqlStateError 通过SQLSTATE标识错误的驱动错误,如pgconn.PgError,pq.Error
+type sqlStateError interface {
+	SQLState() string
+}
+
+// ClassifyError 识别驱动返回的错误的类别,支持被DBError等包装的错误
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ErrorUnknown
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062, 1586:
+			return ErrorDuplicateKey
+		case 1213:
+			return ErrorDeadlock
+		case 1205:
+			return ErrorLockTimeout
+		case 1053, 1927:
+			// 服务器关闭或者连接被kill
+			return ErrorConnectionLost
+		}
+		return ErrorUnknown
+	}
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		switch {
+		case state == "23505":
+			return ErrorDuplicateKey
+		case state == "40P01" || state == "40001":
+			return ErrorDeadlock
+		case state == "55P03":
+			return ErrorLockTimeout
+		case strings.HasPrefix(state, "08"):
+			return ErrorConnectionLost
+		}
+		return ErrorUnknown
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorConnectionLost
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && !errors.Is(err, context.DeadlineExceeded) {
+		return ErrorConnectionLost
+	}
+	return ErrorUnknown
+}
+
+// IsDuplicateKey 是否是主键或者唯一索引冲突的错误
+func IsDuplicateKey(err error) bool {
+	return ClassifyError(err) == ErrorDuplicateKey
+}
+
+// IsDeadlock 是否是死锁的错误
+func IsDeadlock(err error) bool {
+	return ClassifyError(err) == ErrorDeadlock
+}
+
+// IsLockTimeout 是否是等待锁超时的错误
+func IsLockTimeout(err error) bool {
+	return ClassifyError(err) == ErrorLockTimeout
+}
+
+// IsConnectionLost 是否是连接断开的错误
+func IsConnectionLost(err error) bool {
+	return ClassifyError(err) == ErrorConnectionLost
+}
+
+// IsRetryable 是否是重新执行整个事务可能成功的错误,即死锁和等待锁超时
+func IsRetryable(err error) bool {
+	kind := ClassifyError(err)
+	return kind == ErrorDeadlock || kind == ErrorLockTimeout
+}
+
+// Kind 错误的类别
+func (e *DBError) Kind() ErrorKind {
+	return ClassifyError(e.Err)
+}
+
+// IsDuplicateKey 是否是主键或者唯一索引冲突的错误
+func (e *DBError) IsDuplicateKey() bool {
+	return e.Kind() == ErrorDuplicateKey
+}
+
+// IsDeadlock 是否是死锁的错误
+func (e *DBError) IsDeadlock() bool {
+	return e.Kind() == ErrorDeadlock
+}
+
+// IsLockTimeout 是否是等待锁超时的错误
+func (e *DBError) IsLockTimeout() bool {
+	return e.Kind() == ErrorLockTimeout
+}
+
+// IsConnectionLost 是否是连接断开的错误
+func (e *DBError) IsConnectionLost() bool {
+	return e.Kind() == ErrorConnectionLost
+}
@@ -0,0 +1,803 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// FakeDB 用于单元测试的内存数据库,使用MySQL方言,支持orm生成的INSERT(包括ON DUPLICATE KEY UPDATE),UPDATE,SELECT及DELETE语句;
+// 表在第一次使用时根据已注册实体的元数据创建,分表等表名与实体不同的表可以通过AddTable指定实体;
+// 事务第一次访问表时复制该表,提交时将事务中插入,修改及删除的行合并到库中,唯一键冲突时提交失败;
+// 自增主键在事务之间共享,回滚时不回退;字符串比较区分大小写;通过拦截器记录执行的语句,用于断言
+type FakeDB struct {
+	mu      sync.Mutex
+	dbs     map[string]fakeData //库名->库中的表
+	metas   map[string]*meta    //表名->实体元数据
+	cache   map[string]fakeStatement
+	stmtsMu sync.Mutex
+	stmts   []Stmt
+}
+
+// NewFakeDB 创建内存数据库
+func NewFakeDB() *FakeDB {
+	return &FakeDB{dbs: map[string]fakeData{}, metas: map[string]*meta{}, cache: map[string]fakeStatement{}}
+}
+
+// AddTable 指定表使用entity的元数据,tables为空时使用entity.TableName()
+func (p *FakeDB) AddTable(entity Entity, tables ...string) {
+	m := findEntityMeta(entity)
+	if len(tables) == 0 {
+		tables = []string{entity.TableName()}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, table := range tables {
+		p.metas[table] = m
+	}
+}
+
+// NewPool 创建使用名称为name的库的连接池,相同名称的连接池共享数据
+func (p *FakeDB) NewPool(name string) *Pool {
+	pool := NewPool(sql.OpenDB(&fakeConnector{fake: p, name: name}), MySQLDialect)
+	pool.name = name
+	pool.Use(p)
+	return pool
+}
+
+// PoolFunc 用于SimpleDBService及SimpleShardDBService,每个DBConfig使用Schema对应的库,Schema为空时使用URL
+func (p *FakeDB) PoolFunc() PoolFunc {
+	return func(config *DBConfig) (*Pool, error) {
+		if config == nil {
+			return nil, &DBError{"Not found config", nil}
+		}
+		name := config.Schema
+		if name == "" {
+			name = config.URL
+		}
+		return p.NewPool(name), nil
+	}
+}
+
+// Before implements Interceptor.Before
+func (p *FakeDB) Before(ctx context.Context, stmt *Stmt) context.Context {
+	return ctx
+}
+
+// After implements Interceptor.After,记录执行的语句
+func (p *FakeDB) After(ctx context.Context, stmt *Stmt) {
+	p.stmtsMu.Lock()
+	defer p.stmtsMu.Unlock()
+	p.stmts = append(p.stmts, *stmt)
+}
+
+// Stmts 执行过的语句及事务操作
+func (p *FakeDB) Stmts() []Stmt {
+	p.stmtsMu.Lock()
+	defer p.stmtsMu.Unlock()
+	return append([]Stmt(nil), p.stmts...)
+}
+
+// Reset 清除记录的语句
+func (p *FakeDB) Reset() {
+	p.stmtsMu.Lock()
+	defer p.stmtsMu.Unlock()
+	p.stmts = nil
+}
+
+var fakeSpaceRegexp = regexp.MustCompile(`\s+`)
+
+// normalizeSQL 去掉标识符的引号并合并空白,用于匹配语句
+func normalizeSQL(s string) string {
+	s = strings.NewReplacer("`", "", "\"", "").Replace(s)
+	return strings.ToUpper(strings.TrimSpace(fakeSpaceRegexp.ReplaceAllString(s, " ")))
+}
+
+// Executed 查找成功执行过的包含pattern的语句,忽略大小写,标识符的引号及多余的空白;args不为空时参数也必须相同(整数等按规范化后的值比较)
+func (p *FakeDB) Executed(pattern string, args ...interface{}) []Stmt {
+	pattern = normalizeSQL(pattern)
+	var ret []Stmt
+	for _, stmt := range p.Stmts() {
+		if stmt.Err != nil || (stmt.Kind != StmtExec && stmt.Kind != StmtQuery) || !strings.Contains(normalizeSQL(stmt.SQL), pattern) {
+			continue
+		}
+		if len(args) > 0 && !fakeArgsEqual(args, stmt.Args) {
+			continue
+		}
+		ret = append(ret, stmt)
+	}
+	return ret
+}
+
+// fakeArgsEqual 比较参数,整数等按规范化后的值比较
+func fakeArgsEqual(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(fakeNorm(a[i]), fakeNorm(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Committed 提交的事务数
+func (p *FakeDB) Committed() int {
+	return p.count(StmtCommit)
+}
+
+// RolledBack 回滚的事务数
+func (p *FakeDB) RolledBack() int {
+	return p.count(StmtRollback)
+}
+
+func (p *FakeDB) count(kind StmtKind) int {
+	n := 0
+	for _, stmt := range p.Stmts() {
+		if stmt.Kind == kind && stmt.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// FakeTestingT 断言使用的*testing.T
+type FakeTestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertExecuted 断言执行过包含pattern的语句,参见Executed
+func (p *FakeDB) AssertExecuted(t FakeTestingT, pattern string, args ...interface{}) bool {
+	t.Helper()
+	if len(p.Executed(pattern, args...)) == 0 {
+		t.Errorf("sql not executed:%s,args:%v\nexecuted:\n%s", pattern, args, p.dump())
+		return false
+	}
+	return true
+}
+
+// AssertNotExecuted 断言没有执行过包含pattern的语句
+func (p *FakeDB) AssertNotExecuted(t FakeTestingT, pattern string, args ...interface{}) bool {
+	t.Helper()
+	if stmts := p.Executed(pattern, args...); len(stmts) > 0 {
+		t.Errorf("sql executed:%s,args:%v", stmts[0].SQL, stmts[0].Args)
+		return false
+	}
+	return true
+}
+
+// AssertCommitted 断言提交了n个事务
+func (p *FakeDB) AssertCommitted(t FakeTestingT, n int) bool {
+	t.Helper()
+	if committed := p.Committed(); committed != n {
+		t.Errorf("expect %d committed transactions,but it's %d", n, committed)
+		return false
+	}
+	return true
+}
+
+// AssertRolledBack 断言回滚了n个事务
+func (p *FakeDB) AssertRolledBack(t FakeTestingT, n int) bool {
+	t.Helper()
+	if rolledBack := p.RolledBack(); rolledBack != n {
+		t.Errorf("expect %d rolled back transactions,but it's %d", n, rolledBack)
+		return false
+	}
+	return true
+}
+
+func (p *FakeDB) dump() string {
+	var b strings.Builder
+	for _, stmt := range p.Stmts() {
+		fmt.Fprintf(&b, "  [%s] %s %v err:%v\n", stmt.Kind, stmt.SQL, stmt.Args, stmt.Err)
+	}
+	return b.String()
+}
+
+// parse 解析语句,结果按语句缓存
+func (p *FakeDB) parse(query string) (fakeStatement, error) {
+	p.mu.Lock()
+	stmt, ok := p.cache[query]
+	p.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+	stmt, err := parseFakeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.cache[query] = stmt
+	p.mu.Unlock()
+	return stmt, nil
+}
+
+// findTableMeta 查找表对应的实体元数据,调用时需要持有锁
+func (p *FakeDB) findTableMeta(table string) *meta {
+	if m, ok := p.metas[table]; ok {
+		return m
+	}
+	var found *meta
+	for _, m := range defaultMetaReg.cache {
+		if entity, ok := reflect.New(m.modelType).Interface().(Entity); ok && entity.TableName() == table {
+			found = m
+			break
+		}
+	}
+	p.metas[table] = found
+	return found
+}
+
+// fakeRow 一行数据,列名->值
+type fakeRow map[string]driver.Value
+
+// fakeRowIDs 行的内部编号
+var fakeRowIDs atomic.Int64
+
+// fakeSeq 自增主键的序列,表的副本之间共享
+type fakeSeq struct {
+	mu   sync.Mutex
+	next int64
+}
+
+// alloc 分配下一个主键
+func (p *fakeSeq) alloc() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.next
+	p.next++
+	return id
+}
+
+// observe 指定了主键时,下次分配的主键大于id
+func (p *fakeSeq) observe(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id >= p.next {
+		p.next = id + 1
+	}
+}
+
+// fakeTable 内存表
+type fakeTable struct {
+	meta    *meta           //实体元数据,为nil时不检查列
+	columns map[string]bool //所有的列
+	pk      string          //主键列
+	autoInc bool            //是否自增主键
+	uniques [][]string      //唯一键,包括主键
+	seq     *fakeSeq
+	rows    []fakeRow
+	ids     []int64 //每行的内部编号,用于合并事务的修改
+}
+
+func newFakeTable(m *meta) *fakeTable {
+	t := &fakeTable{meta: m, seq: &fakeSeq{next: 1}}
+	if m == nil {
+		return t
+	}
+	t.columns = map[string]bool{}
+	t.pk = m.pkField.column
+	t.autoInc = m.pkField.pkAuto
+	t.uniques = [][]string{{t.pk}}
+	unique := map[string][]string{}
+	var names []string
+	for _, field := range m.fields {
+		t.columns[field.column] = true
+		if name := field.schema.unique; name != "" {
+			if _, ok := unique[name]; !ok {
+				names = append(names, name)
+			}
+			unique[name] = append(unique[name], field.column)
+		}
+	}
+	for _, name := range names {
+		t.uniques = append(t.uniques, unique[name])
+	}
+	return t
+}
+
+func (p *fakeTable) clone() *fakeTable {
+	t := *p
+	t.rows = make([]fakeRow, len(p.rows))
+	for i, row := range p.rows {
+		t.rows[i] = row.clone()
+	}
+	t.ids = append([]int64(nil), p.ids...)
+	return &t
+}
+
+// add 添加一行
+func (p *fakeTable) add(row fakeRow) {
+	p.rows = append(p.rows, row)
+	p.ids = append(p.ids, fakeRowIDs.Add(1))
+}
+
+// index 行的内部编号->行的位置
+func (p *fakeTable) index() map[int64]int {
+	index := make(map[int64]int, len(p.ids))
+	for i, id := range p.ids {
+		index[id] = i
+	}
+	return index
+}
+
+// merge 在表的副本上应用事务中cur相对于base的修改,已经被其他事务删除的行不再修改
+func (p *fakeTable) merge(base, cur *fakeTable) (*fakeTable, error) {
+	t := p.clone()
+	old, now := base.index(), cur.index()
+	rows, ids := t.rows[:0], t.ids[:0]
+	for i, id := range t.ids {
+		if _, ok := old[id]; ok {
+			if _, ok = now[id]; !ok {
+				continue
+			}
+		}
+		rows, ids = append(rows, t.rows[i]), append(ids, id)
+	}
+	t.rows, t.ids = rows, ids
+
+	index := t.index()
+	for i, id := range cur.ids {
+		row := cur.rows[i]
+		k := -1
+		if j, ok := old[id]; ok {
+			if k, ok = index[id]; !ok || fakeRowEqual(base.rows[j], row) {
+				continue
+			}
+			t.rows[k] = row.clone()
+		} else {
+			t.rows, t.ids = append(t.rows, row.clone()), append(t.ids, id)
+			k = len(t.rows) - 1
+			if pk, ok := fakeNorm(row[t.pk]).(int64); ok && t.autoInc {
+				t.seq.observe(pk)
+			}
+		}
+		if j, unique := t.conflict(t.rows[k], k); j >= 0 {
+			return nil, fakeDuplicate(t.rows[k], unique)
+		}
+	}
+	return t, nil
+}
+
+func (p fakeRow) clone() fakeRow {
+	row := make(fakeRow, len(p))
+	for k, v := range p {
+		row[k] = v
+	}
+	return row
+}
+
+// checkColumn 检查列是否存在
+func (p *fakeTable) checkColumn(column string) error {
+	if p.columns != nil && !p.columns[column] {
+		return &mysql.MySQLError{Number: 1054, Message: fmt.Sprintf("Unknown column '%s'", column)}
+	}
+	return nil
+}
+
+// newRow 使用values创建一行,没有指定的列使用默认值
+func (p *fakeTable) newRow(values fakeRow) fakeRow {
+	row := fakeRow{}
+	if p.meta != nil {
+		for _, field := range p.meta.fields {
+			row[field.column] = fakeDefault(field)
+		}
+	}
+	for k, v := range values {
+		row[k] = v
+	}
+	if p.autoInc {
+		if id, ok := fakeNorm(row[p.pk]).(int64); ok && id > 0 {
+			p.seq.observe(id)
+		} else {
+			row[p.pk] = p.seq.alloc()
+		}
+	}
+	return row
+}
+
+// conflict 查找与row的唯一键冲突的行,skip为需要忽略的行
+func (p *fakeTable) conflict(row fakeRow, skip int) (int, []string) {
+	for _, unique := range p.uniques {
+	rows:
+		for i, other := range p.rows {
+			if i == skip {
+				continue
+			}
+			for _, column := range unique {
+				a, b := row[column], other[column]
+				if a == nil || b == nil || fakeCompare(a, b) != 0 {
+					continue rows
+				}
+			}
+			return i, unique
+		}
+	}
+	return -1, nil
+}
+
+// fakeDefault 没有指定值的列的默认值
+func fakeDefault(field *metaField) driver.Value {
+	schema := field.schema
+	if schema.hasDefault {
+		if v, err := parseFakeSQLValue(schema.defaultVal); err == nil {
+			return v
+		}
+	}
+	typ := field.structField.Type
+	if field.codec != nil || schema.nullable == "y" || typ.Kind() == reflect.Ptr || reflect.PtrTo(typ).Implements(scannerType) && typ != timeType {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(0)
+	case reflect.Float32, reflect.Float64:
+		return float64(0)
+	case reflect.String:
+		return ""
+	}
+	if typ == timeType {
+		return time.Time{}
+	}
+	return nil
+}
+
+// fakeData 一个库中的表
+type fakeData map[string]*fakeTable
+
+// fakeConnector 创建内存数据库的连接
+type fakeConnector struct {
+	fake *FakeDB
+	name string
+}
+
+func (p *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: p.fake, name: p.name}, nil
+}
+
+func (p *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("use FakeDB.NewPool")
+}
+
+// fakeConn 内存数据库的连接
+type fakeConn struct {
+	fake *FakeDB
+	name string
+	tx   *fakeTx
+}
+
+// fakeTx 事务,修改在表的副本上进行,提交时将修改的行合并到库中
+type fakeTx struct {
+	conn       *fakeConn
+	base       fakeData //第一次访问时表的副本
+	data       fakeData
+	dirty      map[string]bool
+	savepoints []fakeSavepoint
+}
+
+type fakeSavepoint struct {
+	name  string
+	data  fakeData
+	dirty map[string]bool
+}
+
+func (p *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: p, query: query}, nil
+}
+
+func (p *fakeConn) Close() error {
+	return nil
+}
+
+func (p *fakeConn) Begin() (driver.Tx, error) {
+	return p.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (p *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if p.tx != nil {
+		return nil, fmt.Errorf("already in transaction")
+	}
+	p.tx = &fakeTx{conn: p, base: fakeData{}, data: fakeData{}, dirty: map[string]bool{}}
+	return p.tx, nil
+}
+
+// pull 事务第一次访问表时从库中复制
+func (p *fakeTx) pull(name string) *fakeTable {
+	if base, ok := p.base[name]; ok {
+		return base.clone()
+	}
+	fake := p.conn.fake
+	fake.mu.Lock()
+	data := fake.database(p.conn.name)
+	table := data[name]
+	if table == nil {
+		table = newFakeTable(fake.findTableMeta(name))
+		data[name] = table
+	}
+	base := table.clone()
+	fake.mu.Unlock()
+	p.base[name] = base
+	return base.clone()
+}
+
+func (p *fakeTx) Commit() error {
+	if p.conn.tx != p {
+		return sql.ErrTxDone
+	}
+	p.conn.tx = nil
+	p.conn.fake.mu.Lock()
+	defer p.conn.fake.mu.Unlock()
+	data := p.conn.fake.database(p.conn.name)
+	merged := make(fakeData, len(p.dirty))
+	for name := range p.dirty {
+		cur := p.data[name]
+		if cur == nil {
+			continue
+		}
+		table := data[name]
+		if table == nil {
+			table = newFakeTable(cur.meta)
+		}
+		table, err := table.merge(p.base[name], cur)
+		if err != nil {
+			return err
+		}
+		merged[name] = table
+	}
+	for name, table := range merged {
+		data[name] = table
+	}
+	return nil
+}
+
+func (p *fakeTx) Rollback() error {
+	if p.conn.tx != p {
+		return sql.ErrTxDone
+	}
+	p.conn.tx = nil
+	return nil
+}
+
+func (p *fakeTx) snapshot() (fakeData, map[string]bool) {
+	data := make(fakeData, len(p.data))
+	for name, table := range p.data {
+		data[name] = table.clone()
+	}
+	dirty := make(map[string]bool, len(p.dirty))
+	for name := range p.dirty {
+		dirty[name] = true
+	}
+	return data, dirty
+}
+
+// database 名称为name的库,调用时需要持有锁
+func (p *FakeDB) database(name string) fakeData {
+	data := p.dbs[name]
+	if data == nil {
+		data = fakeData{}
+		p.dbs[name] = data
+	}
+	return data
+}
+
+func (p *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	stmt, err := p.fake.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	res, _, err := p.run(stmt, namedValues(args))
+	return res, err
+}
+
+func (p *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	stmt, err := p.fake.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := p.run(stmt, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return rows, nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// run 在事务或者库上执行语句
+func (p *fakeConn) run(stmt fakeStatement, args []driver.Value) (driver.Result, *fakeRows, error) {
+	if sp, ok := stmt.(*fakeSavepointStmt); ok {
+		return p.savepoint(sp)
+	}
+	if p.tx != nil {
+		return stmt.run(&fakeSession{fake: p.fake, data: p.tx.data, tx: p.tx}, args)
+	}
+	p.fake.mu.Lock()
+	defer p.fake.mu.Unlock()
+	return stmt.run(&fakeSession{fake: p.fake, data: p.fake.database(p.name)}, args)
+}
+
+// savepoint 执行事务的保存点语句
+func (p *fakeConn) savepoint(stmt *fakeSavepointStmt) (driver.Result, *fakeRows, error) {
+	tx := p.tx
+	if tx == nil {
+		return nil, nil, &mysql.MySQLError{Number: 1305, Message: "SAVEPOINT does not exist"}
+	}
+	find := func() int {
+		for i := len(tx.savepoints) - 1; i >= 0; i-- {
+			if tx.savepoints[i].name == stmt.name {
+				return i
+			}
+		}
+		return -1
+	}
+	switch stmt.kind {
+	case "savepoint":
+		data, dirty := tx.snapshot()
+		tx.savepoints = append(tx.savepoints, fakeSavepoint{name: stmt.name, data: data, dirty: dirty})
+	case "release":
+		i := find()
+		if i < 0 {
+			return nil, nil, &mysql.MySQLError{Number: 1305, Message: "SAVEPOINT " + stmt.name + " does not exist"}
+		}
+		tx.savepoints = tx.savepoints[:i]
+	case "rollback":
+		i := find()
+		if i < 0 {
+			return nil, nil, &mysql.MySQLError{Number: 1305, Message: "SAVEPOINT " + stmt.name + " does not exist"}
+		}
+		sp := tx.savepoints[i]
+		tx.data, tx.dirty = sp.data, sp.dirty
+		tx.savepoints = tx.savepoints[:i+1]
+		tx.savepoints[i].data, tx.savepoints[i].dirty = tx.snapshot()
+	}
+	return driver.RowsAffected(0), nil, nil
+}
+
+// fakeSession 执行语句使用的数据,tx不为nil时在事务中执行,否则持有锁直接修改库
+type fakeSession struct {
+	fake *FakeDB
+	data fakeData
+	tx   *fakeTx
+}
+
+// table 查找或者创建表
+func (p *fakeSession) table(name string) *fakeTable {
+	table := p.data[name]
+	if table == nil {
+		if p.tx != nil {
+			table = p.tx.pull(name)
+		} else {
+			table = newFakeTable(p.fake.findTableMeta(name))
+		}
+		p.data[name] = table
+	}
+	return table
+}
+
+// write 返回可以修改的表,修改成功后使用commit替换
+func (p *fakeSession) write(name string) *fakeTable {
+	return p.table(name).clone()
+}
+
+// commit 替换修改后的表,table为nil时删除表,事务中删除表中所有的行
+func (p *fakeSession) commit(name string, table *fakeTable) {
+	if p.tx == nil {
+		if table == nil {
+			delete(p.data, name)
+		} else {
+			p.data[name] = table
+		}
+		return
+	}
+	if table == nil {
+		table = p.table(name).clone()
+		table.rows, table.ids = nil, nil
+	}
+	p.data[name] = table
+	p.tx.dirty[name] = true
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (p *fakeStmt) Close() error {
+	return nil
+}
+
+func (p *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (p *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	stmt, err := p.conn.fake.parse(p.query)
+	if err != nil {
+		return nil, err
+	}
+	res, _, err := p.conn.run(stmt, args)
+	return res, err
+}
+
+func (p *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	stmt, err := p.conn.fake.parse(p.query)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := p.conn.run(stmt, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return rows, nil
+}
+
+// fakeResult 更新语句的结果
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (p fakeResult) LastInsertId() (int64, error) {
+	return p.lastInsertID, nil
+}
+
+func (p fakeResult) RowsAffected() (int64, error) {
+	return p.rowsAffected, nil
+}
+
+// fakeRows 查询的结果
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (p *fakeRows) Columns() []string {
+	return p.columns
+}
+
+func (p *fakeRows) Close() error {
+	return nil
+}
+
+func (p *fakeRows) Next(dest []driver.Value) error {
+	if p.pos >= len(p.rows) {
+		return io.EOF
+	}
+	copy(dest, p.rows[p.pos])
+	p.pos++
+	return nil
+}
@@ -0,0 +1,1693 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// fakeStatement FakeDB解析后的语句
+type fakeStatement interface {
+	run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error)
+}
+
+// fakeSyntaxError 语句语法错误或者不支持的语句
+func fakeSyntaxError(format string, args ...interface{}) error {
+	return &mysql.MySQLError{Number: 1064, Message: "fake db:" + fmt.Sprintf(format, args...)}
+}
+
+type fakeTokenKind int
+
+const (
+	fakeTokEOF    fakeTokenKind = iota
+	fakeTokIdent                //标识符或者关键字
+	fakeTokQuoted               //带引号的标识符
+	fakeTokString
+	fakeTokNumber
+	fakeTokParam
+	fakeTokSymbol
+)
+
+type fakeToken struct {
+	kind fakeTokenKind
+	text string
+}
+
+// tokenizeFakeSQL 词法分析
+func tokenizeFakeSQL(s string) ([]fakeToken, error) {
+	var tokens []fakeToken
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '-' && strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case ch == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, fakeSyntaxError("unterminated comment")
+			}
+			i += end + 4
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '$' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: fakeTokIdent, text: s[i:j]})
+			i = j
+		case ch == '`' || ch == '"':
+			end := strings.IndexByte(s[i+1:], ch)
+			if end < 0 {
+				return nil, fakeSyntaxError("unterminated identifier")
+			}
+			tokens = append(tokens, fakeToken{kind: fakeTokQuoted, text: s[i+1 : i+1+end]})
+			i += end + 2
+		case ch == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					b.WriteByte(s[j])
+				} else if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						b.WriteByte('\'')
+						j++
+					} else {
+						break
+					}
+				} else {
+					b.WriteByte(s[j])
+				}
+			}
+			if j >= len(s) {
+				return nil, fakeSyntaxError("unterminated string")
+			}
+			tokens = append(tokens, fakeToken{kind: fakeTokString, text: b.String()})
+			i = j + 1
+		case ch >= '0' && ch <= '9' || ch == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				(s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, fakeToken{kind: fakeTokNumber, text: s[i:j]})
+			i = j
+		case ch == '?':
+			tokens = append(tokens, fakeToken{kind: fakeTokParam, text: "?"})
+			i++
+		default:
+			if i+1 < len(s) {
+				if two := s[i : i+2]; two == "<=" || two == ">=" || two == "<>" || two == "!=" {
+					tokens = append(tokens, fakeToken{kind: fakeTokSymbol, text: two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("=<>+-*/%(),;.", rune(ch)) {
+				return nil, fakeSyntaxError("unexpected char %q", ch)
+			}
+			tokens = append(tokens, fakeToken{kind: fakeTokSymbol, text: string(ch)})
+			i++
+		}
+	}
+	return append(tokens, fakeToken{kind: fakeTokEOF}), nil
+}
+
+// parseFakeSQLValue 解析字面量,用于列的默认值
+func parseFakeSQLValue(s string) (driver.Value, error) {
+	tokens, err := tokenizeFakeSQL(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &fakeParser{tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != fakeTokEOF {
+		return nil, fakeSyntaxError("not a value:%s", s)
+	}
+	lit, ok := e.(*fakeLit)
+	if !ok {
+		return nil, fakeSyntaxError("not a value:%s", s)
+	}
+	return lit.v, nil
+}
+
+// parseFakeSQL 解析语句
+func parseFakeSQL(query string) (fakeStatement, error) {
+	tokens, err := tokenizeFakeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &fakeParser{tokens: tokens}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if t := p.peek(); t.kind != fakeTokEOF {
+		return nil, fakeSyntaxError("unexpected %q in %s", t.text, query)
+	}
+	return stmt, nil
+}
+
+// fakeParser 递归下降的语法分析
+type fakeParser struct {
+	tokens []fakeToken
+	pos    int
+	params int
+}
+
+func (p *fakeParser) peek() fakeToken {
+	return p.tokens[p.pos]
+}
+
+func (p *fakeParser) next() fakeToken {
+	t := p.tokens[p.pos]
+	if t.kind != fakeTokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword 之后的token是否依次是关键字words
+func (p *fakeParser) isKeyword(words ...string) bool {
+	for i, word := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		if t := p.tokens[p.pos+i]; t.kind != fakeTokIdent || !strings.EqualFold(t.text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *fakeParser) acceptKeyword(words ...string) bool {
+	if p.isKeyword(words...) {
+		p.pos += len(words)
+		return true
+	}
+	return false
+}
+
+func (p *fakeParser) expectKeyword(words ...string) error {
+	if !p.acceptKeyword(words...) {
+		return fakeSyntaxError("expect %s near %q", strings.Join(words, " "), p.peek().text)
+	}
+	return nil
+}
+
+func (p *fakeParser) acceptSymbol(s string) bool {
+	if t := p.peek(); t.kind == fakeTokSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *fakeParser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return fakeSyntaxError("expect %s near %q", s, p.peek().text)
+	}
+	return nil
+}
+
+// name 解析以.分隔的名称
+func (p *fakeParser) name() ([]string, error) {
+	var parts []string
+	for {
+		t := p.next()
+		if t.kind != fakeTokIdent && t.kind != fakeTokQuoted {
+			return nil, fakeSyntaxError("expect name near %q", t.text)
+		}
+		parts = append(parts, t.text)
+		if !p.acceptSymbol(".") {
+			return parts, nil
+		}
+	}
+}
+
+func (p *fakeParser) table() (string, error) {
+	parts, err := p.name()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(parts, "."), nil
+}
+
+func (p *fakeParser) column() (string, error) {
+	parts, err := p.name()
+	if err != nil {
+		return "", err
+	}
+	return parts[len(parts)-1], nil
+}
+
+func (p *fakeParser) statement() (fakeStatement, error) {
+	switch {
+	case p.acceptKeyword("SELECT"):
+		return p.selectStmt()
+	case p.acceptKeyword("INSERT"):
+		return p.insertStmt()
+	case p.acceptKeyword("UPDATE"):
+		return p.updateStmt()
+	case p.acceptKeyword("DELETE", "FROM"):
+		return p.deleteStmt()
+	case p.isKeyword("CREATE"), p.isKeyword("ALTER"):
+		p.pos = len(p.tokens) - 1
+		return &fakeNoop{}, nil
+	case p.acceptKeyword("DROP", "TABLE"):
+		p.acceptKeyword("IF", "EXISTS")
+		table, err := p.table()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeDrop{table: table}, nil
+	case p.acceptKeyword("SAVEPOINT"):
+		name, err := p.column()
+		return &fakeSavepointStmt{kind: "savepoint", name: name}, err
+	case p.acceptKeyword("RELEASE", "SAVEPOINT"):
+		name, err := p.column()
+		return &fakeSavepointStmt{kind: "release", name: name}, err
+	case p.acceptKeyword("ROLLBACK", "TO"):
+		p.acceptKeyword("SAVEPOINT")
+		name, err := p.column()
+		return &fakeSavepointStmt{kind: "rollback", name: name}, err
+	}
+	return nil, fakeSyntaxError("unsupported statement near %q", p.peek().text)
+}
+
+func (p *fakeParser) selectStmt() (fakeStatement, error) {
+	stmt := &fakeSelect{}
+	if p.acceptSymbol("*") {
+		stmt.star = true
+	} else {
+		for {
+			start := p.pos
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := fakeSelectItem{expr: e}
+			if c, ok := e.(*fakeColumn); ok {
+				item.name = c.name
+			} else {
+				var texts []string
+				for _, t := range p.tokens[start:p.pos] {
+					texts = append(texts, t.text)
+				}
+				item.name = strings.Join(texts, "")
+			}
+			if p.acceptKeyword("AS") {
+				if item.name, err = p.column(); err != nil {
+					return nil, err
+				}
+			}
+			stmt.items = append(stmt.items, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.table, err = p.table(); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.where(); err != nil {
+		return nil, err
+	}
+	if stmt.orders, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	if stmt.limit, stmt.offset, err = p.limit(); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("FOR", "UPDATE") && !p.acceptKeyword("FOR", "SHARE") {
+		p.acceptKeyword("LOCK", "IN", "SHARE", "MODE")
+	}
+	for _, item := range stmt.items {
+		if fakeHasAggregate(item.expr) {
+			stmt.aggregate = true
+		}
+	}
+	return stmt, nil
+}
+
+func (p *fakeParser) where() (fakeExpr, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	return p.expr()
+}
+
+func (p *fakeParser) orderBy() ([]fakeOrder, error) {
+	if !p.acceptKeyword("ORDER", "BY") {
+		return nil, nil
+	}
+	var orders []fakeOrder
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		order := fakeOrder{expr: e}
+		if p.acceptKeyword("DESC") {
+			order.desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		orders = append(orders, order)
+		if !p.acceptSymbol(",") {
+			return orders, nil
+		}
+	}
+}
+
+func (p *fakeParser) limit() (limit, offset fakeExpr, err error) {
+	if !p.acceptKeyword("LIMIT") {
+		return
+	}
+	if limit, err = p.primary(); err != nil {
+		return
+	}
+	if p.acceptSymbol(",") {
+		offset = limit
+		limit, err = p.primary()
+	} else if p.acceptKeyword("OFFSET") {
+		offset, err = p.primary()
+	}
+	return
+}
+
+func (p *fakeParser) assigns() ([]fakeAssign, error) {
+	var assigns []fakeAssign
+	for {
+		column, err := p.column()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		assigns = append(assigns, fakeAssign{column: column, expr: e})
+		if !p.acceptSymbol(",") {
+			return assigns, nil
+		}
+	}
+}
+
+func (p *fakeParser) insertStmt() (fakeStatement, error) {
+	stmt := &fakeInsert{ignore: p.acceptKeyword("IGNORE")}
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.table, err = p.table(); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("(") {
+		for {
+			column, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.acceptKeyword("VALUES") && !p.acceptKeyword("VALUE") {
+		return nil, fakeSyntaxError("expect VALUES near %q", p.peek().text)
+	}
+	for {
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		row, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("ON", "DUPLICATE", "KEY", "UPDATE") {
+		if stmt.updates, err = p.assigns(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *fakeParser) updateStmt() (fakeStatement, error) {
+	stmt := &fakeUpdate{}
+	var err error
+	if stmt.table, err = p.table(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	if stmt.sets, err = p.assigns(); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.where(); err != nil {
+		return nil, err
+	}
+	if stmt.orders, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	stmt.limit, _, err = p.limit()
+	return stmt, err
+}
+
+func (p *fakeParser) deleteStmt() (fakeStatement, error) {
+	stmt := &fakeDelete{}
+	var err error
+	if stmt.table, err = p.table(); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.where(); err != nil {
+		return nil, err
+	}
+	if stmt.orders, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	stmt.limit, _, err = p.limit()
+	return stmt, err
+}
+
+func (p *fakeParser) exprList() ([]fakeExpr, error) {
+	var list []fakeExpr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *fakeParser) expr() (fakeExpr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeLogic{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) and() (fakeExpr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeLogic{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) not() (fakeExpr, error) {
+	if p.acceptKeyword("NOT") {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeNot{e: e}, nil
+	}
+	return p.predicate()
+}
+
+func (p *fakeParser) predicate() (fakeExpr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &fakeIsNull{e: l, not: not}, nil
+	}
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &fakeIn{e: l, list: list, not: not}, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeLike{e: l, pattern: pattern, not: not}, nil
+	case p.acceptKeyword("BETWEEN"):
+		lo, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		hi, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeBetween{e: l, lo: lo, hi: hi, not: not}, nil
+	case not:
+		return nil, fakeSyntaxError("unexpected NOT near %q", p.peek().text)
+	}
+	if t := p.peek(); t.kind == fakeTokSymbol {
+		switch t.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.next()
+			r, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			return &fakeBinary{op: t.text, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) additive() (fakeExpr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != fakeTokSymbol || t.text != "+" && t.text != "-" {
+			return l, nil
+		}
+		p.next()
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *fakeParser) multiplicative() (fakeExpr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != fakeTokSymbol || t.text != "*" && t.text != "/" && t.text != "%" {
+			return l, nil
+		}
+		p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *fakeParser) unary() (fakeExpr, error) {
+	if p.acceptSymbol("-") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeBinary{op: "-", l: &fakeLit{v: int64(0)}, r: e}, nil
+	}
+	return p.primary()
+}
+
+func (p *fakeParser) primary() (fakeExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case fakeTokParam:
+		p.next()
+		p.params++
+		return &fakeParamExpr{index: p.params - 1}, nil
+	case fakeTokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &fakeLit{v: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fakeSyntaxError("invalid number %s", t.text)
+		}
+		return &fakeLit{v: f}, nil
+	case fakeTokString:
+		p.next()
+		return &fakeLit{v: t.text}, nil
+	case fakeTokSymbol:
+		if p.acceptSymbol("(") {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectSymbol(")")
+		}
+	case fakeTokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			p.next()
+			return &fakeLit{}, nil
+		case "TRUE":
+			p.next()
+			return &fakeLit{v: int64(1)}, nil
+		case "FALSE":
+			p.next()
+			return &fakeLit{v: int64(0)}, nil
+		}
+		if next := p.tokens[p.pos+1]; next.kind == fakeTokSymbol && next.text == "(" {
+			return p.function()
+		}
+		fallthrough
+	case fakeTokQuoted:
+		column, err := p.column()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeColumn{name: column}, nil
+	}
+	return nil, fakeSyntaxError("unexpected %q", t.text)
+}
+
+func (p *fakeParser) function() (fakeExpr, error) {
+	f := &fakeFunc{name: strings.ToUpper(p.next().text)}
+	p.next()
+	switch f.name {
+	case "COUNT", "SUM", "MAX", "MIN", "AVG", "VALUES", "COALESCE", "IFNULL", "LOWER", "UPPER", "ABS":
+	default:
+		return nil, fakeSyntaxError("unsupported function %s", f.name)
+	}
+	if p.acceptSymbol("*") {
+		if f.name != "COUNT" {
+			return nil, fakeSyntaxError("unexpected * in %s", f.name)
+		}
+		f.star = true
+	} else if !p.acceptSymbol(")") {
+		var err error
+		if f.name == "VALUES" {
+			var column string
+			if column, err = p.column(); err != nil {
+				return nil, err
+			}
+			f.args = []fakeExpr{&fakeColumn{name: column}}
+		} else if f.args, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fakeSyntaxError("missing arguments of %s", f.name)
+	}
+	if !f.star && len(f.args) != 1 && f.name != "COALESCE" && f.name != "IFNULL" {
+		return nil, fakeSyntaxError("wrong number of arguments of %s", f.name)
+	}
+	return f, p.expectSymbol(")")
+}
+
+// fakeEnv 计算表达式的环境
+type fakeEnv struct {
+	table  *fakeTable
+	row    fakeRow        //当前行
+	values fakeRow        //ON DUPLICATE KEY UPDATE中VALUES()引用的待插入行
+	group  []fakeRow      //聚合函数使用的行
+	args   []driver.Value //参数
+}
+
+// fakeExpr 表达式
+type fakeExpr interface {
+	eval(env *fakeEnv) (driver.Value, error)
+}
+
+type fakeLit struct {
+	v driver.Value
+}
+
+type fakeParamExpr struct {
+	index int
+}
+
+type fakeColumn struct {
+	name string
+}
+
+type fakeBinary struct {
+	op   string
+	l, r fakeExpr
+}
+
+type fakeLogic struct {
+	and  bool
+	l, r fakeExpr
+}
+
+type fakeNot struct {
+	e fakeExpr
+}
+
+type fakeIsNull struct {
+	e   fakeExpr
+	not bool
+}
+
+type fakeIn struct {
+	e    fakeExpr
+	list []fakeExpr
+	not  bool
+}
+
+type fakeLike struct {
+	e, pattern fakeExpr
+	not        bool
+}
+
+type fakeBetween struct {
+	e, lo, hi fakeExpr
+	not       bool
+}
+
+type fakeFunc struct {
+	name string
+	args []fakeExpr
+	star bool
+}
+
+func (p *fakeLit) eval(env *fakeEnv) (driver.Value, error) {
+	return p.v, nil
+}
+
+func (p *fakeParamExpr) eval(env *fakeEnv) (driver.Value, error) {
+	if p.index >= len(env.args) {
+		return nil, fakeSyntaxError("missing parameter %d", p.index+1)
+	}
+	return fakeNorm(env.args[p.index]), nil
+}
+
+func (p *fakeColumn) eval(env *fakeEnv) (driver.Value, error) {
+	if v, ok := env.row[p.name]; ok {
+		return v, nil
+	}
+	if env.table != nil {
+		if err := env.table.checkColumn(p.name); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *fakeBinary) eval(env *fakeEnv) (driver.Value, error) {
+	l, err := p.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.r.eval(env)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	switch p.op {
+	case "+", "-", "*", "/", "%":
+		return fakeArith(p.op, l, r), nil
+	}
+	c := fakeCompare(l, r)
+	var ret bool
+	switch p.op {
+	case "=":
+		ret = c == 0
+	case "<>", "!=":
+		ret = c != 0
+	case "<":
+		ret = c < 0
+	case "<=":
+		ret = c <= 0
+	case ">":
+		ret = c > 0
+	case ">=":
+		ret = c >= 0
+	}
+	return fakeBool(ret), nil
+}
+
+func (p *fakeLogic) eval(env *fakeEnv) (driver.Value, error) {
+	l, err := p.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	lb, lnull := fakeTruth(l)
+	if !lnull && lb != p.and {
+		return fakeBool(lb), nil
+	}
+	r, err := p.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	rb, rnull := fakeTruth(r)
+	if !rnull && rb != p.and {
+		return fakeBool(rb), nil
+	}
+	if lnull || rnull {
+		return nil, nil
+	}
+	return fakeBool(p.and), nil
+}
+
+func (p *fakeNot) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := p.e.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, null := fakeTruth(v)
+	if null {
+		return nil, nil
+	}
+	return fakeBool(!b), nil
+}
+
+func (p *fakeIsNull) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := p.e.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return fakeBool((v == nil) != p.not), nil
+}
+
+func (p *fakeIn) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := p.e.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	null := false
+	for _, e := range p.list {
+		item, err := e.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			null = true
+		} else if fakeCompare(v, item) == 0 {
+			return fakeBool(!p.not), nil
+		}
+	}
+	if null {
+		return nil, nil
+	}
+	return fakeBool(p.not), nil
+}
+
+func (p *fakeLike) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := p.e.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	pattern, err := p.pattern.eval(env)
+	if err != nil || pattern == nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	s := fakeString(pattern)
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\\' && i+1 < len(s):
+			i++
+			b.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		case ch == '%':
+			b.WriteString(".*")
+		case ch == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fakeSyntaxError("invalid pattern %s", s)
+	}
+	return fakeBool(re.MatchString(fakeString(v)) != p.not), nil
+}
+
+func (p *fakeBetween) eval(env *fakeEnv) (driver.Value, error) {
+	var values [3]driver.Value
+	for i, e := range []fakeExpr{p.e, p.lo, p.hi} {
+		v, err := e.eval(env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	in := fakeCompare(values[0], values[1]) >= 0 && fakeCompare(values[0], values[2]) <= 0
+	return fakeBool(in != p.not), nil
+}
+
+func (p *fakeFunc) eval(env *fakeEnv) (driver.Value, error) {
+	switch p.name {
+	case "VALUES":
+		if env.values == nil {
+			return nil, fakeSyntaxError("VALUES() outside ON DUPLICATE KEY UPDATE")
+		}
+		return env.values[p.args[0].(*fakeColumn).name], nil
+	case "COUNT", "SUM", "MAX", "MIN", "AVG":
+		return p.aggregate(env)
+	}
+	var values []driver.Value
+	for _, arg := range p.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	switch p.name {
+	case "COALESCE", "IFNULL":
+		for _, v := range values {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "LOWER", "UPPER":
+		if values[0] == nil {
+			return nil, nil
+		}
+		if p.name == "LOWER" {
+			return strings.ToLower(fakeString(values[0])), nil
+		}
+		return strings.ToUpper(fakeString(values[0])), nil
+	case "ABS":
+		if values[0] == nil {
+			return nil, nil
+		}
+		if fakeCompare(values[0], int64(0)) < 0 {
+			return fakeArith("-", int64(0), values[0]), nil
+		}
+		return values[0], nil
+	}
+	return nil, fakeSyntaxError("unsupported function %s", p.name)
+}
+
+// aggregate 计算聚合函数
+func (p *fakeFunc) aggregate(env *fakeEnv) (driver.Value, error) {
+	if env.group == nil {
+		return nil, &mysql.MySQLError{Number: 1111, Message: "Invalid use of group function"}
+	}
+	var count int64
+	var ret driver.Value
+	for _, row := range env.group {
+		if p.star {
+			count++
+			continue
+		}
+		v, err := p.args[0].eval(&fakeEnv{table: env.table, row: row, args: env.args})
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		count++
+		switch {
+		case ret == nil:
+			ret = v
+		case p.name == "SUM" || p.name == "AVG":
+			ret = fakeArith("+", ret, v)
+		case p.name == "MAX" && fakeCompare(v, ret) > 0, p.name == "MIN" && fakeCompare(v, ret) < 0:
+			ret = v
+		}
+	}
+	switch p.name {
+	case "COUNT":
+		return count, nil
+	case "AVG":
+		if ret == nil {
+			return nil, nil
+		}
+		return fakeArith("/", ret, count), nil
+	}
+	return ret, nil
+}
+
+// fakeHasAggregate 表达式是否包含聚合函数
+func fakeHasAggregate(e fakeExpr) bool {
+	switch x := e.(type) {
+	case *fakeFunc:
+		switch x.name {
+		case "COUNT", "SUM", "MAX", "MIN", "AVG":
+			return true
+		}
+		for _, arg := range x.args {
+			if fakeHasAggregate(arg) {
+				return true
+			}
+		}
+	case *fakeBinary:
+		return fakeHasAggregate(x.l) || fakeHasAggregate(x.r)
+	}
+	return false
+}
+
+// fakeCheckColumns 检查表达式引用的列是否存在
+func fakeCheckColumns(table *fakeTable, exprs ...fakeExpr) error {
+	for _, e := range exprs {
+		var children []fakeExpr
+		switch x := e.(type) {
+		case *fakeColumn:
+			if err := table.checkColumn(x.name); err != nil {
+				return err
+			}
+		case *fakeBinary:
+			children = []fakeExpr{x.l, x.r}
+		case *fakeLogic:
+			children = []fakeExpr{x.l, x.r}
+		case *fakeNot:
+			children = []fakeExpr{x.e}
+		case *fakeIsNull:
+			children = []fakeExpr{x.e}
+		case *fakeIn:
+			children = append([]fakeExpr{x.e}, x.list...)
+		case *fakeLike:
+			children = []fakeExpr{x.e, x.pattern}
+		case *fakeBetween:
+			children = []fakeExpr{x.e, x.lo, x.hi}
+		case *fakeFunc:
+			children = x.args
+		}
+		if err := fakeCheckColumns(table, children...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fakeNorm 将值规范化为int64,float64,string,[]byte,time.Time或者nil
+func fakeNorm(v driver.Value) driver.Value {
+	switch x := v.(type) {
+	case bool:
+		return fakeBool(x)
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		if x > math.MaxInt64 {
+			return float64(x)
+		}
+		return int64(x)
+	case float32:
+		return float64(x)
+	case []byte:
+		if x == nil {
+			return nil
+		}
+		return append([]byte{}, x...)
+	}
+	return v
+}
+
+func fakeBool(b bool) driver.Value {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+// fakeTokNumber 转换为数字
+func fakeNumber(v driver.Value) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(x)), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func fakeString(v driver.Value) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(v)
+}
+
+// fakeTruth 计算条件的值,null表示结果为NULL
+func fakeTruth(v driver.Value) (b, null bool) {
+	if v == nil {
+		return false, true
+	}
+	if _, ok := v.(time.Time); ok {
+		return true, false
+	}
+	f, _ := fakeNumber(v)
+	return f != 0, false
+}
+
+func fakeIsNumber(v driver.Value) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// fakeCompare 比较两个非NULL的值,数字按数值比较,时间按时间比较,其他按字符串比较
+func fakeCompare(a, b driver.Value) int {
+	a, b = fakeNorm(a), fakeNorm(b)
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	if fakeIsNumber(a) || fakeIsNumber(b) {
+		x, _ := fakeNumber(a)
+		y, _ := fakeNumber(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fakeString(a), fakeString(b))
+}
+
+// fakeCompareNull 排序使用的比较,NULL最小
+func fakeCompareNull(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return fakeCompare(a, b)
+}
+
+// fakeArith 算术运算,整数的加减乘及取模结果为整数
+func fakeArith(op string, a, b driver.Value) driver.Value {
+	a, b = fakeNorm(a), fakeNorm(b)
+	x, xok := a.(int64)
+	y, yok := b.(int64)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "%":
+			if y == 0 {
+				return nil
+			}
+			return x % y
+		}
+	}
+	fx, _ := fakeNumber(a)
+	fy, _ := fakeNumber(b)
+	switch op {
+	case "+":
+		return fx + fy
+	case "-":
+		return fx - fy
+	case "*":
+		return fx * fy
+	case "%":
+		if fy == 0 {
+			return nil
+		}
+		return math.Mod(fx, fy)
+	}
+	if fy == 0 {
+		return nil
+	}
+	return fx / fy
+}
+
+// fakeOrder ORDER BY的一项
+type fakeOrder struct {
+	expr fakeExpr
+	desc bool
+}
+
+// fakeAssign SET中的一项
+type fakeAssign struct {
+	column string
+	expr   fakeExpr
+}
+
+// fakeMatch 按WHERE过滤并按ORDER BY排序,没有ORDER BY时按主键排序
+func fakeMatch(table *fakeTable, where fakeExpr, orders []fakeOrder, args []driver.Value) ([]int, error) {
+	exprs := []fakeExpr{where}
+	for _, order := range orders {
+		exprs = append(exprs, order.expr)
+	}
+	if where == nil {
+		exprs = exprs[1:]
+	}
+	if err := fakeCheckColumns(table, exprs...); err != nil {
+		return nil, err
+	}
+	var matched []int
+	for i, row := range table.rows {
+		if where != nil {
+			v, err := where.eval(&fakeEnv{table: table, row: row, args: args})
+			if err != nil {
+				return nil, err
+			}
+			if b, null := fakeTruth(v); !b || null {
+				continue
+			}
+		}
+		matched = append(matched, i)
+	}
+	if table.pk != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return fakeCompareNull(table.rows[matched[i]][table.pk], table.rows[matched[j]][table.pk]) < 0
+		})
+	}
+	if len(orders) > 0 {
+		keys := make(map[int][]driver.Value, len(matched))
+		for _, i := range matched {
+			for _, order := range orders {
+				v, err := order.expr.eval(&fakeEnv{table: table, row: table.rows[i], args: args})
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = append(keys[i], v)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := keys[matched[i]], keys[matched[j]]
+			for k, order := range orders {
+				if c := fakeCompareNull(a[k], b[k]); c != 0 {
+					return c < 0 != order.desc
+				}
+			}
+			return false
+		})
+	}
+	return matched, nil
+}
+
+// fakeLimit 计算LIMIT及OFFSET
+func fakeLimit(matched []int, limit, offset fakeExpr, args []driver.Value) ([]int, error) {
+	env := &fakeEnv{args: args}
+	if offset != nil {
+		v, err := offset.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := fakeNumber(v)
+		if n >= float64(len(matched)) {
+			return nil, nil
+		}
+		if n > 0 {
+			matched = matched[int(n):]
+		}
+	}
+	if limit != nil {
+		v, err := limit.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := fakeNumber(v); n >= 0 && n < float64(len(matched)) {
+			matched = matched[:int(math.Max(n, 0))]
+		}
+	}
+	return matched, nil
+}
+
+type fakeSelectItem struct {
+	expr fakeExpr
+	name string
+}
+
+type fakeSelect struct {
+	items         []fakeSelectItem
+	star          bool
+	table         string
+	where         fakeExpr
+	orders        []fakeOrder
+	limit, offset fakeExpr
+	aggregate     bool
+}
+
+func (p *fakeSelect) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	table := s.table(p.table)
+	items := p.items
+	if p.star {
+		if table.meta == nil {
+			return nil, nil, fakeSyntaxError("SELECT * needs the entity of table %s", p.table)
+		}
+		for _, field := range table.meta.fields {
+			items = append(items, fakeSelectItem{expr: &fakeColumn{name: field.column}, name: field.column})
+		}
+	}
+	for _, item := range items {
+		if err := fakeCheckColumns(table, item.expr); err != nil {
+			return nil, nil, err
+		}
+	}
+	matched, err := fakeMatch(table, p.where, p.orders, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := &fakeRows{}
+	for _, item := range items {
+		rows.columns = append(rows.columns, item.name)
+	}
+	if p.aggregate {
+		env := &fakeEnv{table: table, row: fakeRow{}, group: []fakeRow{}, args: args}
+		for _, i := range matched {
+			env.group = append(env.group, table.rows[i])
+		}
+		if len(env.group) > 0 {
+			env.row = env.group[0]
+		}
+		row, err := fakeProject(items, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows.rows = [][]driver.Value{row}
+		matched = nil
+	}
+	if matched, err = fakeLimit(matched, p.limit, p.offset, args); err != nil {
+		return nil, nil, err
+	}
+	for _, i := range matched {
+		row, err := fakeProject(items, &fakeEnv{table: table, row: table.rows[i], args: args})
+		if err != nil {
+			return nil, nil, err
+		}
+		rows.rows = append(rows.rows, row)
+	}
+	return nil, rows, nil
+}
+
+func fakeProject(items []fakeSelectItem, env *fakeEnv) ([]driver.Value, error) {
+	row := make([]driver.Value, len(items))
+	for i, item := range items {
+		v, err := item.expr.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := v.([]byte); ok {
+			v = append([]byte{}, b...)
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+type fakeInsert struct {
+	table   string
+	columns []string
+	rows    [][]fakeExpr
+	ignore  bool
+	updates []fakeAssign
+}
+
+func (p *fakeInsert) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	table := s.write(p.table)
+	columns := p.columns
+	if columns == nil {
+		if table.meta == nil {
+			return nil, nil, fakeSyntaxError("INSERT without columns needs the entity of table %s", p.table)
+		}
+		for _, field := range table.meta.fields {
+			columns = append(columns, field.column)
+		}
+	}
+	for _, column := range columns {
+		if err := table.checkColumn(column); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, assign := range p.updates {
+		if err := fakeCheckColumns(table, &fakeColumn{name: assign.column}, assign.expr); err != nil {
+			return nil, nil, err
+		}
+	}
+	var res fakeResult
+	for _, exprs := range p.rows {
+		if len(exprs) != len(columns) {
+			return nil, nil, &mysql.MySQLError{Number: 1136, Message: "Column count doesn't match value count"}
+		}
+		values := fakeRow{}
+		for i, e := range exprs {
+			v, err := e.eval(&fakeEnv{table: table, row: fakeRow{}, args: args})
+			if err != nil {
+				return nil, nil, err
+			}
+			values[columns[i]] = v
+		}
+		generated := table.autoInc && func() bool { id, ok := fakeNorm(values[table.pk]).(int64); return !ok || id <= 0 }()
+		row := table.newRow(values)
+		i, unique := table.conflict(row, -1)
+		if i < 0 {
+			table.add(row)
+			res.rowsAffected++
+			if generated && res.lastInsertID == 0 {
+				res.lastInsertID = row[table.pk].(int64)
+			}
+			continue
+		}
+		switch {
+		case p.updates != nil:
+			old := table.rows[i]
+			updated := old.clone()
+			for _, assign := range p.updates {
+				v, err := assign.expr.eval(&fakeEnv{table: table, row: updated, values: row, args: args})
+				if err != nil {
+					return nil, nil, err
+				}
+				updated[assign.column] = v
+			}
+			if j, unique := table.conflict(updated, i); j >= 0 {
+				return nil, nil, fakeDuplicate(updated, unique)
+			}
+			if !fakeRowEqual(old, updated) {
+				table.rows[i] = updated
+				res.rowsAffected += 2
+			}
+			if table.autoInc && res.lastInsertID == 0 {
+				res.lastInsertID, _ = fakeNorm(updated[table.pk]).(int64)
+			}
+		case p.ignore:
+		default:
+			return nil, nil, fakeDuplicate(row, unique)
+		}
+	}
+	s.commit(p.table, table)
+	return res, nil, nil
+}
+
+// fakeDuplicate 唯一键冲突的错误
+func fakeDuplicate(row fakeRow, unique []string) error {
+	var values []string
+	for _, column := range unique {
+		values = append(values, fakeString(row[column]))
+	}
+	return &mysql.MySQLError{Number: 1062, Message: fmt.Sprintf("Duplicate entry '%s' for key '%s'", strings.Join(values, "-"), strings.Join(unique, ","))}
+}
+
+func fakeRowEqual(a, b fakeRow) bool {
+	for k, v := range b {
+		if w := a[k]; (v == nil) != (w == nil) || v != nil && fakeCompare(v, w) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeUpdate struct {
+	table  string
+	sets   []fakeAssign
+	where  fakeExpr
+	orders []fakeOrder
+	limit  fakeExpr
+}
+
+func (p *fakeUpdate) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	table := s.write(p.table)
+	for _, assign := range p.sets {
+		if err := fakeCheckColumns(table, &fakeColumn{name: assign.column}, assign.expr); err != nil {
+			return nil, nil, err
+		}
+	}
+	matched, err := fakeMatch(table, p.where, p.orders, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if matched, err = fakeLimit(matched, p.limit, nil, args); err != nil {
+		return nil, nil, err
+	}
+	var changed int64
+	for _, i := range matched {
+		row := table.rows[i].clone()
+		for _, assign := range p.sets {
+			v, err := assign.expr.eval(&fakeEnv{table: table, row: row, args: args})
+			if err != nil {
+				return nil, nil, err
+			}
+			row[assign.column] = v
+		}
+		if fakeRowEqual(table.rows[i], row) {
+			continue
+		}
+		if j, unique := table.conflict(row, i); j >= 0 {
+			return nil, nil, fakeDuplicate(row, unique)
+		}
+		table.rows[i] = row
+		changed++
+	}
+	s.commit(p.table, table)
+	// 与MySQL相同,返回值发生变化的行数
+	return fakeResult{rowsAffected: changed}, nil, nil
+}
+
+type fakeDelete struct {
+	table  string
+	where  fakeExpr
+	orders []fakeOrder
+	limit  fakeExpr
+}
+
+func (p *fakeDelete) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	table := s.write(p.table)
+	matched, err := fakeMatch(table, p.where, p.orders, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if matched, err = fakeLimit(matched, p.limit, nil, args); err != nil {
+		return nil, nil, err
+	}
+	deleted := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		deleted[i] = true
+	}
+	rows, ids := table.rows[:0], table.ids[:0]
+	for i, row := range table.rows {
+		if !deleted[i] {
+			rows, ids = append(rows, row), append(ids, table.ids[i])
+		}
+	}
+	table.rows, table.ids = rows, ids
+	s.commit(p.table, table)
+	return fakeResult{rowsAffected: int64(len(matched))}, nil, nil
+}
+
+// fakeNoop 忽略的语句,如CREATE TABLE
+type fakeNoop struct{}
+
+func (p *fakeNoop) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	return driver.RowsAffected(0), nil, nil
+}
+
+// fakeDrop DROP TABLE,删除表中的数据
+type fakeDrop struct {
+	table string
+}
+
+func (p *fakeDrop) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	s.commit(p.table, nil)
+	return driver.RowsAffected(0), nil, nil
+}
+
+// fakeSavepointStmt 保存点语句,由连接在事务中执行
+type fakeSavepointStmt struct {
+	kind string
+	name string
+}
+
+func (p *fakeSavepointStmt) run(s *fakeSession, args []driver.Value) (driver.Result, *fakeRows, error) {
+	return nil, nil, fakeSyntaxError("SAVEPOINT outside transaction")
+}
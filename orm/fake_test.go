@@ -0,0 +1,256 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUser struct {
+	ID        int64  `column:"id" pk:"y"`
+	Name      string `column:"name" size:"32" unique:"y"`
+	Age       int    `column:"age"`
+	Version   int64  `column:"version" version:"y"`
+	DeletedAt int64  `column:"deleted_at" softDelete:"y"`
+}
+
+func (p *fakeUser) TableName() string {
+	return "fake_user"
+}
+
+type fakeT struct {
+	errors []string
+}
+
+func (p *fakeT) Helper() {}
+
+func (p *fakeT) Errorf(format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFakeDB(t *testing.T) {
+	AddMeta(&fakeUser{})
+	fake := NewFakeDB()
+	service := NewSimpleDBService(fake.PoolFunc())
+	service.Config = &DBConfig{Schema: "test"}
+	assert.NoError(t, service.Init())
+	op, err := service.NewOp()
+	assert.NoError(t, err)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		assert.NoError(t, Add(op, &fakeUser{Name: name, Age: len(name) * 5}))
+	}
+	fake.AssertExecuted(t, "insert into fake_user (name,age,version,deleted_at)", "bob", 15, 0, 0)
+	err = Add(op, &fakeUser{Name: "bob"})
+	var mysqlErr *mysql.MySQLError
+	assert.True(t, errors.As(err, &mysqlErr))
+	assert.EqualValues(t, 1062, mysqlErr.Number)
+
+	e, err := Get(op, &fakeUser{}, int64(2))
+	assert.NoError(t, err)
+	bob := e.(*fakeUser)
+	assert.Equal(t, "bob", bob.Name)
+	bob.Age = 16
+	ok, err := Update(op, bob)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 1, bob.Version)
+	bob.Version = 0
+	_, err = Update(op, bob)
+	assert.True(t, IsStaleEntity(err))
+
+	users, err := From[*fakeUser]().Where(Gt("age", 15), Like("name", "%o%")).OrderBy("-age").Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "carol", users[0].Name)
+	assert.Equal(t, "bob", users[1].Name)
+	users, err = From[*fakeUser]().OrderBy("id").Limit(1).Offset(1).Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.EqualValues(t, 2, users[0].ID)
+	users, err = From[*fakeUser]().OrderBy("id").Offset(1).Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.EqualValues(t, 2, users[0].ID)
+	n, err := From[*fakeUser]().Where(In("name", "alice", "bob", "dave")).Count(op)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	n, err = QueryCount(op, &fakeUser{}, "*", "WHERE age BETWEEN ? AND ?", 16, 24)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	_, err = Query(op, &fakeUser{}, "WHERE no_column = 1")
+	assert.Error(t, err)
+
+	ok, err = Del(op, &fakeUser{}, int64(1))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	e, err = Get(op, &fakeUser{}, int64(1))
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+	ok, err = Restore(op, &fakeUser{}, int64(1))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	rows, err := AddOrUpdate(op, &fakeUser{Name: "alice", Age: 30})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, rows)
+	e, err = Get(op, &fakeUser{}, int64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 30, e.(*fakeUser).Age)
+	assert.EqualValues(t, 3, e.(*fakeUser).Version)
+	assert.NoError(t, AddBatch(op, []Entity{&fakeUser{Name: "dave"}, &fakeUser{Name: "erin"}}))
+	n, err = From[*fakeUser]().Count(op)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		if err := Add(op, &fakeUser{Name: "frank"}); err != nil {
+			return nil, err
+		}
+		return op.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			if err := Add(op, &fakeUser{Name: "grace"}); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("nested fail")
+		})
+	})
+	assert.Error(t, err)
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		return nil, Add(op, &fakeUser{Name: "heidi"})
+	})
+	assert.NoError(t, err)
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		return op.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			return nil, Add(op, &fakeUser{Name: "ivan"})
+		})
+	})
+	assert.NoError(t, err)
+	names := map[string]bool{}
+	users, err = From[*fakeUser]().Find(op)
+	assert.NoError(t, err)
+	for _, user := range users {
+		names[user.Name] = true
+	}
+	assert.False(t, names["frank"])
+	assert.False(t, names["grace"])
+	assert.True(t, names["heidi"])
+	assert.True(t, names["ivan"])
+	fake.AssertCommitted(t, 2)
+	fake.AssertRolledBack(t, 1)
+	fake.AssertExecuted(t, "ROLLBACK TO SAVEPOINT sp_1")
+
+	other := NewSimpleDBService(fake.PoolFunc())
+	other.Config = &DBConfig{Schema: "test"}
+	assert.NoError(t, other.Init())
+	otherOp, _ := other.NewOp()
+	n, err = From[*fakeUser]().Count(otherOp)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 7, n)
+	n, err = From[*fakeUser]().Count(fake.NewPool("empty").NewOp())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	mock := &fakeT{}
+	assert.False(t, fake.AssertExecuted(mock, "DELETE FROM fake_user"))
+	assert.True(t, fake.AssertNotExecuted(mock, "DELETE FROM fake_user"))
+	assert.False(t, fake.AssertCommitted(mock, 1))
+	assert.Len(t, mock.errors, 2)
+	fake.Reset()
+	assert.Empty(t, fake.Stmts())
+}
+
+func TestFakeSQL(t *testing.T) {
+	fake := NewFakeDB()
+	db := fake.NewPool("raw").db
+	_, err := db.Exec("INSERT INTO kv (k,v) VALUES ('a',1),('b',2),('c',NULL)")
+	assert.NoError(t, err)
+
+	var sum, cnt int64
+	assert.NoError(t, db.QueryRow("SELECT SUM(v),COUNT(v) FROM kv WHERE k <> ? OR v IS NULL", "b").Scan(&sum, &cnt))
+	assert.EqualValues(t, 1, sum)
+	assert.EqualValues(t, 1, cnt)
+
+	res, err := db.Exec("UPDATE kv SET v = COALESCE(v,0) + 10 WHERE k NOT IN ('a')")
+	assert.NoError(t, err)
+	n, _ := res.RowsAffected()
+	assert.EqualValues(t, 2, n)
+	var v int64
+	assert.NoError(t, db.QueryRow("SELECT MAX(v) FROM kv").Scan(&v))
+	assert.EqualValues(t, 12, v)
+
+	res, err = db.Exec("DELETE FROM kv WHERE NOT (v >= 10 AND k = 'c')")
+	assert.NoError(t, err)
+	n, _ = res.RowsAffected()
+	assert.EqualValues(t, 2, n)
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM kv").Scan(&cnt))
+	assert.EqualValues(t, 1, cnt)
+
+	_, err = db.Exec("SELECT k FROM kv GROUP BY k")
+	assert.Error(t, err)
+	_, err = db.Exec("DROP TABLE IF EXISTS kv")
+	assert.NoError(t, err)
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM kv").Scan(&cnt))
+	assert.EqualValues(t, 0, cnt)
+}
+
+func TestFakeTrans(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	AddMeta(&fakeUser{})
+	fake := NewFakeDB()
+	testNestedTrans(t, fake.NewPool("test"))
+
+	// 交叉的事务只合并各自修改的行
+	db := fake.NewPool("test").db
+	for _, name := range []string{"a", "b"} {
+		_, err := db.Exec("INSERT INTO fake_user (name,age) VALUES (?,?)", name, 1)
+		assert.NoError(t, err)
+	}
+	tx1, err := db.Begin()
+	assert.NoError(t, err)
+	tx2, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx1.Exec("UPDATE fake_user SET age = 10 WHERE name = 'a'")
+	assert.NoError(t, err)
+	_, err = tx1.Exec("INSERT INTO fake_user (name) VALUES ('c')")
+	assert.NoError(t, err)
+	_, err = tx2.Exec("UPDATE fake_user SET age = 20 WHERE name = 'b'")
+	assert.NoError(t, err)
+	_, err = tx2.Exec("INSERT INTO fake_user (name) VALUES ('d')")
+	assert.NoError(t, err)
+	_, err = tx2.Exec("DELETE FROM fake_user WHERE name = 'a'")
+	assert.NoError(t, err)
+	assert.NoError(t, tx2.Commit())
+	assert.NoError(t, tx1.Commit())
+
+	var names []string
+	rows, err := db.Query("SELECT name,age FROM fake_user ORDER BY id")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var name string
+		var age int
+		assert.NoError(t, rows.Scan(&name, &age))
+		names = append(names, fmt.Sprintf("%s:%d", name, age))
+	}
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []string{"b:20", "c:0", "d:0"}, names)
+
+	// 提交时唯一键冲突
+	tx1, err = db.Begin()
+	assert.NoError(t, err)
+	_, err = tx1.Exec("INSERT INTO fake_user (name) VALUES ('e')")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO fake_user (name) VALUES ('e')")
+	assert.NoError(t, err)
+	assert.Error(t, tx1.Commit())
+
+	// 返回值发生变化的行数
+	res, err := db.Exec("UPDATE fake_user SET age = 20 WHERE name IN ('b','c')")
+	assert.NoError(t, err)
+	n, _ := res.RowsAffected()
+	assert.EqualValues(t, 1, n)
+}
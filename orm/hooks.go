@@ -0,0 +1,95 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+)
+
+// BeforeInserter 插入前调用,返回错误时终止插入,Add,AddBatch,AddOrUpdate及AddOrUpdateBatch都会调用
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInserter 插入成功后调用(自增主键已经回填),返回的错误作为插入操作的错误,需要时由事务回滚;
+// AddOrUpdate及AddOrUpdateBatch在插入或者更新成功后都会调用
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdater 按实体更新(Update,UpdateExcludeColumns,UpdateReplace)前调用,返回错误时终止更新
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterLoader 从数据库查询出实体后调用,返回错误时查询返回该错误
+type AfterLoader interface {
+	AfterLoad(ctx context.Context) error
+}
+
+// BeforeDeleter 删除(包括软删除)前对调用Del,DelByCondition时传入的实体调用,返回错误时终止删除
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+var (
+	beforeInserterType = reflect.TypeOf((*BeforeInserter)(nil)).Elem()
+	afterInserterType  = reflect.TypeOf((*AfterInserter)(nil)).Elem()
+	beforeUpdaterType  = reflect.TypeOf((*BeforeUpdater)(nil)).Elem()
+	afterLoaderType    = reflect.TypeOf((*AfterLoader)(nil)).Elem()
+	beforeDeleterType  = reflect.TypeOf((*BeforeDeleter)(nil)).Elem()
+)
+
+// entityHooks 实体实现的生命周期接口,在解析元数据时确定
+type entityHooks struct {
+	beforeInsert bool
+	afterInsert  bool
+	beforeUpdate bool
+	afterLoad    bool
+	beforeDelete bool
+}
+
+func parseHooks(typ reflect.Type) entityHooks {
+	ptrType := reflect.PointerTo(typ)
+	return entityHooks{
+		beforeInsert: ptrType.Implements(beforeInserterType),
+		afterInsert:  ptrType.Implements(afterInserterType),
+		beforeUpdate: ptrType.Implements(beforeUpdaterType),
+		afterLoad:    ptrType.Implements(afterLoaderType),
+		beforeDelete: ptrType.Implements(beforeDeleterType),
+	}
+}
+
+func (p *meta) beforeInsert(ctx context.Context, entity Entity) error {
+	if !p.hooks.beforeInsert {
+		return nil
+	}
+	return entity.(BeforeInserter).BeforeInsert(ctx)
+}
+
+func (p *meta) afterInsert(ctx context.Context, entity Entity) error {
+	if !p.hooks.afterInsert {
+		return nil
+	}
+	return entity.(AfterInserter).AfterInsert(ctx)
+}
+
+func (p *meta) beforeUpdate(ctx context.Context, entity Entity) error {
+	if !p.hooks.beforeUpdate {
+		return nil
+	}
+	return entity.(BeforeUpdater).BeforeUpdate(ctx)
+}
+
+func (p *meta) afterLoad(ctx context.Context, entity Entity) error {
+	if !p.hooks.afterLoad {
+		return nil
+	}
+	return entity.(AfterLoader).AfterLoad(ctx)
+}
+
+func (p *meta) beforeDelete(ctx context.Context, entity Entity) error {
+	if !p.hooks.beforeDelete {
+		return nil
+	}
+	return entity.(BeforeDeleter).BeforeDelete(ctx)
+}
@@ -0,0 +1,174 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errHookAbort = errors.New("hook abort")
+
+type hookModel struct {
+	ID       int64  `column:"id" pk:"y"`
+	Name     string `column:"name" size:"32"`
+	Tags     string `column:"tags" size:"64"`
+	TagList  []string
+	CreateAt int64 `column:"create_at"`
+	UpdateAt int64 `column:"update_at"`
+	inserted bool
+}
+
+func (p *hookModel) TableName() string {
+	return "hook_model"
+}
+
+func (p *hookModel) BeforeInsert(ctx context.Context) error {
+	if p.Name == "" {
+		return errHookAbort
+	}
+	p.CreateAt = 1
+	p.Tags = strings.Join(p.TagList, ",")
+	return nil
+}
+
+func (p *hookModel) AfterInsert(ctx context.Context) error {
+	p.inserted = p.ID > 0
+	return nil
+}
+
+func (p *hookModel) BeforeUpdate(ctx context.Context) error {
+	if p.Name == "" {
+		return errHookAbort
+	}
+	p.UpdateAt++
+	p.Tags = strings.Join(p.TagList, ",")
+	return nil
+}
+
+func (p *hookModel) AfterLoad(ctx context.Context) error {
+	p.TagList = strings.Split(p.Tags, ",")
+	return nil
+}
+
+func (p *hookModel) BeforeDelete(ctx context.Context) error {
+	if p.Name == "keep" {
+		return errHookAbort
+	}
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&hookModel{})
+	assert.Equal(t, entityHooks{true, true, true, true, true}, findEntityMeta(&hookModel{}).hooks)
+	assert.Equal(t, entityHooks{}, parseHooks(findEntityMeta(&hookModel{}).modelType.Field(0).Type))
+
+	createTables(t, &hookModel{})
+
+	dboper := &Op{pool: dbpool}
+	hm := &hookModel{Name: "h0", TagList: []string{"a", "b"}}
+	assert.NoError(t, Add(dboper, hm))
+	assert.True(t, hm.inserted)
+	assert.EqualValues(t, 1, hm.CreateAt)
+
+	assert.Equal(t, errHookAbort, Add(dboper, &hookModel{}))
+	assert.Equal(t, errHookAbort, AddBatch(dboper, []Entity{&hookModel{Name: "h1"}, &hookModel{}}))
+	batch := []Entity{&hookModel{Name: "h1"}, &hookModel{Name: "h2"}}
+	assert.NoError(t, AddBatch(dboper, batch))
+	assert.True(t, batch[1].(*hookModel).inserted)
+
+	total, err := QueryCount(dboper, &hookModel{}, "*", "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+
+	e, err := Get(dboper, &hookModel{}, hm.ID)
+	assert.NoError(t, err)
+	loaded := e.(*hookModel)
+	assert.Equal(t, []string{"a", "b"}, loaded.TagList)
+
+	loaded.TagList = append(loaded.TagList, "c")
+	ok, err := Update(dboper, loaded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	loaded.Name = ""
+	_, err = UpdateExcludeColumns(dboper, loaded)
+	assert.Equal(t, errHookAbort, err)
+
+	l, err := QueryColumns(dboper, &hookModel{}, []string{"tags"}, "WHERE id = ?", hm.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, l[0].(*hookModel).TagList)
+
+	_, err = Del(dboper, &hookModel{Name: "keep"}, hm.ID)
+	assert.Equal(t, errHookAbort, err)
+
+	n, err := DelByCondition(dboper, &hookModel{}, "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+}
+
+type hookKV struct {
+	Key     string `column:"k" pk:"y" pkAuto:"n" size:"32"`
+	Val     int64  `column:"val"`
+	before  int
+	after   int
+	abortAt int64
+}
+
+func (p *hookKV) TableName() string {
+	return "hook_kv"
+}
+
+func (p *hookKV) BeforeInsert(ctx context.Context) error {
+	p.before++
+	return nil
+}
+
+func (p *hookKV) AfterInsert(ctx context.Context) error {
+	if p.Val == p.abortAt {
+		return errHookAbort
+	}
+	p.after++
+	return nil
+}
+
+func TestUpsertHooks(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&hookKV{})
+
+	createTables(t, &hookKV{})
+
+	dboper := &Op{pool: dbpool}
+	kv := &hookKV{Key: "a", Val: 1, abortAt: -1}
+	_, err = AddOrUpdate(dboper, kv)
+	assert.NoError(t, err)
+	kv.Val = 2
+	_, err = AddOrUpdate(dboper, kv)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kv.before)
+	assert.Equal(t, 2, kv.after)
+
+	batch := []Entity{&hookKV{Key: "a", Val: 3, abortAt: -1}, &hookKV{Key: "b", Val: 1, abortAt: -1}}
+	_, err = AddOrUpdateBatch(dboper, batch)
+	assert.NoError(t, err)
+	for _, e := range batch {
+		assert.Equal(t, 1, e.(*hookKV).before)
+		assert.Equal(t, 1, e.(*hookKV).after)
+	}
+
+	_, err = AddOrUpdate(dboper, &hookKV{Key: "c", Val: 1, abortAt: 1})
+	assert.Equal(t, errHookAbort, err)
+
+	// 拆分为多条语句时AfterInsert在同一个事务中调用,返回错误时回滚整个批次
+	dboper.SetBatchOptions(BatchOptions{MaxRows: 1})
+	_, err = AddOrUpdateBatch(dboper, []Entity{&hookKV{Key: "d", Val: 1, abortAt: -1}, &hookKV{Key: "e", Val: 2, abortAt: 2}})
+	assert.Equal(t, errHookAbort, err)
+	for _, key := range []string{"d", "e"} {
+		e, err := Get(dboper, &hookKV{}, key)
+		assert.NoError(t, err)
+		assert.Nil(t, e)
+	}
+}
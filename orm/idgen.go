@@ -0,0 +1,466 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/d0ngw/go/cache"
+	c "github.com/d0ngw/go/common"
+)
+
+// IDGenerator 主键生成器,实体的主键使用pkGen:"name"标签指定通过RegisterIDGenerator注册的生成器
+type IDGenerator interface {
+	// NextID 生成下一个id
+	NextID(ctx context.Context) (int64, error)
+}
+
+var (
+	idGeneratorsMu sync.RWMutex
+	idGenerators   = map[string]IDGenerator{}
+)
+
+// RegisterIDGenerator 注册名称为name的主键生成器,同名的生成器被替换
+func RegisterIDGenerator(name string, gen IDGenerator) {
+	idGeneratorsMu.Lock()
+	defer idGeneratorsMu.Unlock()
+	if gen == nil {
+		delete(idGenerators, name)
+		return
+	}
+	idGenerators[name] = gen
+}
+
+func findIDGenerator(name string) IDGenerator {
+	idGeneratorsMu.RLock()
+	defer idGeneratorsMu.RUnlock()
+	return idGenerators[name]
+}
+
+// fillID 主键有pkGen标签且为0时,使用生成器生成主键
+func (p *meta) fillID(ctx context.Context, ind reflect.Value) error {
+	field := p.pkField
+	if field.pkGen == "" {
+		return nil
+	}
+	fv := ind.FieldByIndex(field.index)
+	if !fv.IsZero() {
+		return nil
+	}
+	gen := findIDGenerator(field.pkGen)
+	if gen == nil {
+		return fmt.Errorf("can't find id generator %s for %s", field.pkGen, p.name)
+	}
+	id, err := gen.NextID(ctx)
+	if err != nil {
+		return fmt.Errorf("generate id for %s fail,err:%w", p.name, err)
+	}
+	switch fv.Kind() {
+	case reflect.Uint, reflect.Uint64:
+		fv.SetUint(uint64(id))
+	default:
+		fv.SetInt(id)
+	}
+	return nil
+}
+
+// GenerateID 实体的主键有pkGen标签且为0时生成主键,Add等插入操作会自动调用;
+// 按主键分片的实体在NewOpByEntity时也会自动生成
+func GenerateID(ctx context.Context, entity Entity) error {
+	modelMeta := findEntityMeta(entity)
+	_, ind, _ := extract(entity)
+	return modelMeta.fillID(ctx, ind)
+}
+
+// SnowflakeConfig snowflake生成器的配置,id由时间戳,worker id和序列号组成,时间戳占用63-WorkerBits-SequenceBits位
+type SnowflakeConfig struct {
+	Epoch        int64          //起始时间的unix毫秒数,为0时使用2020-01-01 UTC
+	WorkerBits   uint           //worker id的位数,为0时使用10
+	SequenceBits uint           //每毫秒序列号的位数,为0时使用12
+	WorkerID     int64          //worker id,设置了Lease时使用Lease的worker id
+	Lease        *WorkerIDLease //租用的worker id,租约失效后不再生成id
+}
+
+// defaultSnowflakeEpoch 2020-01-01 UTC
+const defaultSnowflakeEpoch = 1577836800000
+
+// maxClockBackward 时钟回拨时最多等待的时间
+const maxClockBackward = 10 * time.Millisecond
+
+// Snowflake snowflake算法的主键生成器
+type Snowflake struct {
+	epoch        int64
+	workerBits   uint
+	sequenceBits uint
+	workerID     int64
+	lease        *WorkerIDLease
+	mu           sync.Mutex
+	lastMillis   int64
+	sequence     int64
+}
+
+// NewSnowflake 创建snowflake生成器
+func NewSnowflake(config SnowflakeConfig) (*Snowflake, error) {
+	if config.Epoch == 0 {
+		config.Epoch = defaultSnowflakeEpoch
+	}
+	if config.WorkerBits == 0 {
+		config.WorkerBits = 10
+	}
+	if config.SequenceBits == 0 {
+		config.SequenceBits = 12
+	}
+	if config.WorkerBits+config.SequenceBits > 22 {
+		return nil, fmt.Errorf("worker bits %d + sequence bits %d must <= 22", config.WorkerBits, config.SequenceBits)
+	}
+	if config.Epoch < 0 || config.Epoch > c.UnixMills(time.Now()) {
+		return nil, fmt.Errorf("invalid epoch %d", config.Epoch)
+	}
+	if config.Lease != nil {
+		config.WorkerID = config.Lease.WorkerID()
+	}
+	if maxWorkerID := int64(1)<<config.WorkerBits - 1; config.WorkerID < 0 || config.WorkerID > maxWorkerID {
+		return nil, fmt.Errorf("invalid worker id %d,must in [0,%d]", config.WorkerID, maxWorkerID)
+	}
+	return &Snowflake{
+		epoch:        config.Epoch,
+		workerBits:   config.WorkerBits,
+		sequenceBits: config.SequenceBits,
+		workerID:     config.WorkerID,
+		lease:        config.Lease,
+	}, nil
+}
+
+// NextID implements IDGenerator.NextID
+func (p *Snowflake) NextID(ctx context.Context) (int64, error) {
+	if p.lease != nil && p.lease.Lost() {
+		return 0, fmt.Errorf("worker id %d lease lost", p.workerID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := c.UnixMills(time.Now())
+	if now < p.lastMillis {
+		backward := time.Duration(p.lastMillis-now) * time.Millisecond
+		if backward > maxClockBackward {
+			return 0, fmt.Errorf("clock moved backwards %s", backward)
+		}
+		time.Sleep(backward)
+		now = c.UnixMills(time.Now())
+		// sleep之后时钟仍可能落后,继续等待直到追上lastMillis
+		for now < p.lastMillis {
+			time.Sleep(100 * time.Microsecond)
+			now = c.UnixMills(time.Now())
+		}
+	}
+
+	maxSequence := int64(1)<<p.sequenceBits - 1
+	if now == p.lastMillis {
+		p.sequence = (p.sequence + 1) & maxSequence
+		if p.sequence == 0 {
+			// 当前毫秒的序列号用完,等待下一毫秒
+			for now <= p.lastMillis {
+				time.Sleep(100 * time.Microsecond)
+				now = c.UnixMills(time.Now())
+			}
+		}
+	} else {
+		p.sequence = 0
+	}
+	p.lastMillis = now
+
+	return (now-p.epoch)<<(p.workerBits+p.sequenceBits) | p.workerID<<p.sequenceBits | p.sequence, nil
+}
+
+// workerLocker worker id的锁
+type workerLocker interface {
+	tryLock(key string) (bool, error)
+	renew(key string) (bool, error)
+	unlock(key string) error
+}
+
+// redisWorkerLocker 使用cache.TryLock实现的锁
+type redisWorkerLocker struct {
+	paramConf   *cache.ParamConf
+	redisClient *cache.RedisClient
+}
+
+func (p *redisWorkerLocker) tryLock(key string) (bool, error) {
+	return cache.TryLock(key, p.paramConf.Expire(), p.paramConf, p.redisClient)
+}
+
+func (p *redisWorkerLocker) renew(key string) (bool, error) {
+	return p.redisClient.Expire(p.paramConf.NewParamKey(key))
+}
+
+func (p *redisWorkerLocker) unlock(key string) error {
+	return cache.UnLock(key, p.paramConf, p.redisClient)
+}
+
+// WorkerIDLease 通过锁租用的worker id,租约定期续期
+type WorkerIDLease struct {
+	key       string
+	workerID  int64
+	locker    workerLocker
+	expire    time.Duration
+	lastRenew time.Time //最后一次成功锁定或续期前的时间,只在续期时访问
+	lost      atomic.Bool
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// LeaseWorkerID 使用redis的TryLock依次尝试锁定keyPrefix+id(id从0到maxWorkerID),锁的时间为paramConf.Expire()秒,
+// 成功后每Expire()/3秒续期一次;续期失败且无法重新锁定,或者距最后一次成功续期已经超过Expire()秒时租约失效;
+// 续期使用EXPIRE,只能判断key是否存在,无法发现锁过期后被其他进程重新锁定,因此续期出错时不会超过Expire()秒继续使用该worker id
+func LeaseWorkerID(keyPrefix string, maxWorkerID int64, paramConf *cache.ParamConf, redisClient *cache.RedisClient) (*WorkerIDLease, error) {
+	if paramConf == nil || redisClient == nil || paramConf.Expire() <= 0 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	expire := time.Duration(paramConf.Expire()) * time.Second
+	return leaseWorkerID(keyPrefix, maxWorkerID, &redisWorkerLocker{paramConf: paramConf, redisClient: redisClient}, expire/3, expire)
+}
+
+func leaseWorkerID(keyPrefix string, maxWorkerID int64, locker workerLocker, renewInterval, expire time.Duration) (*WorkerIDLease, error) {
+	for id := int64(0); id <= maxWorkerID; id++ {
+		key := keyPrefix + strconv.FormatInt(id, 10)
+		now := time.Now()
+		locked, err := locker.tryLock(key)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			continue
+		}
+		lease := &WorkerIDLease{key: key, workerID: id, locker: locker, expire: expire, lastRenew: now, stop: make(chan struct{})}
+		if renewInterval > 0 {
+			go lease.run(renewInterval)
+		}
+		c.Infof("lease worker id %d with key %s", id, key)
+		return lease, nil
+	}
+	return nil, fmt.Errorf("no available worker id in [0,%d]", maxWorkerID)
+}
+
+// WorkerID 租用的worker id
+func (p *WorkerIDLease) WorkerID() int64 {
+	return p.workerID
+}
+
+// Lost 租约是否已经失效
+func (p *WorkerIDLease) Lost() bool {
+	return p.lost.Load()
+}
+
+func (p *WorkerIDLease) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !p.renew() {
+				return
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// renew 续期,返回租约是否仍然有效
+func (p *WorkerIDLease) renew() bool {
+	now := time.Now()
+	// 锁可能已经过期并被其他进程锁定
+	if p.expire > 0 && now.Sub(p.lastRenew) >= p.expire {
+		return p.lose()
+	}
+	renewed, err := p.locker.renew(p.key)
+	if err != nil {
+		// 暂时的错误在下次续期时重试
+		c.Warnf("renew worker id %d fail,err:%v", p.workerID, err)
+		return true
+	}
+	if renewed {
+		p.lastRenew = now
+		return true
+	}
+	// 锁已经过期,尝试重新锁定
+	if locked, err := p.locker.tryLock(p.key); err == nil && locked {
+		p.lastRenew = now
+		return true
+	}
+	return p.lose()
+}
+
+// lose 标记租约失效
+func (p *WorkerIDLease) lose() bool {
+	p.lost.Store(true)
+	c.Errorf("worker id %d lease lost", p.workerID)
+	return false
+}
+
+// Release 停止续期并释放worker id
+func (p *WorkerIDLease) Release() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	if p.lost.Swap(true) {
+		return nil
+	}
+	return p.locker.unlock(p.key)
+}
+
+// DefaultIDSegmentTable 默认号段表的表名
+const DefaultIDSegmentTable = "orm_id_segments"
+
+// IDSegment 号段表中的一行,记录业务标签已经分配的最大id
+type IDSegment struct {
+	Tag       string `column:"tag" pk:"y" pkAuto:"n" size:"128"`
+	MaxID     int64  `column:"max_id"`
+	UpdatedAt int64  `column:"updated_at"`
+}
+
+// TableName implements Entity.TableName
+func (p *IDSegment) TableName() string {
+	return DefaultIDSegmentTable
+}
+
+var idSegmentMeta = MetaOf(&IDSegment{}).(*meta)
+
+// segment 已经分配的号段(cur,max]
+type segment struct {
+	cur int64
+	max int64
+}
+
+// SegmentGenerator 号段模式的主键生成器,每次从号段表中分配step个id,用完前异步加载下一个号段
+type SegmentGenerator struct {
+	pool    *Pool
+	table   string
+	tag     string
+	step    int64
+	once    sync.Once
+	initErr error
+	mu      sync.Mutex
+	current *segment
+	next    *segment
+	loading bool
+}
+
+// NewSegmentGenerator 创建业务标签为tag的号段生成器,table为空时使用DefaultIDSegmentTable,表不存在时自动创建
+func NewSegmentGenerator(pool *Pool, table, tag string, step int64) (*SegmentGenerator, error) {
+	if pool == nil || tag == "" || step <= 0 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	if table == "" {
+		table = DefaultIDSegmentTable
+	}
+	return &SegmentGenerator{pool: pool, table: table, tag: tag, step: step}, nil
+}
+
+func (p *SegmentGenerator) ensureTable(ctx context.Context) error {
+	p.once.Do(func() {
+		stmts, err := createTableSQL(idSegmentMeta, p.table, p.pool.Dialect())
+		if err != nil {
+			p.initErr = err
+			return
+		}
+		executor := p.pool.NewOp().executor()
+		for _, stmt := range stmts {
+			if _, err = exec(ctx, executor, stmt, nil); err != nil {
+				p.initErr = err
+				return
+			}
+		}
+	})
+	return p.initErr
+}
+
+// NextID implements IDGenerator.NextID
+func (p *SegmentGenerator) NextID(ctx context.Context) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil || p.current.cur >= p.current.max {
+		if p.next != nil {
+			p.current, p.next = p.next, nil
+		} else {
+			seg, err := p.load(ctx)
+			if err != nil {
+				return 0, err
+			}
+			p.current = seg
+		}
+	}
+	p.current.cur++
+	id := p.current.cur
+
+	// 当前号段剩余不足10%时预加载下一个号段
+	if p.next == nil && !p.loading && (p.current.max-p.current.cur)*10 < p.step {
+		p.loading = true
+		go p.prefetch()
+	}
+	return id, nil
+}
+
+func (p *SegmentGenerator) prefetch() {
+	seg, err := p.load(context.Background())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loading = false
+	if err != nil {
+		c.Warnf("prefetch id segment %s fail,err:%v", p.tag, err)
+		return
+	}
+	p.next = seg
+}
+
+// load 在事务中将tag的max_id增加step,返回新分配的号段
+func (p *SegmentGenerator) load(ctx context.Context) (*segment, error) {
+	if err := p.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	op := p.pool.NewOp()
+	ret, err := op.DoInTransCtx(ctx, nil, func(tx *sql.Tx) (interface{}, error) {
+		executor := op.executor()
+		now := c.UnixMills(time.Now())
+		// tag不存在时插入,否则max_id增加step;使用一条语句,并发加载新的tag时不会主键冲突
+		maxColumn := executor.quote("max_id")
+		assignments := []string{maxColumn + "=" + p.table + "." + maxColumn + "+?", executor.quote("updated_at") + "=?"}
+		upsert, err := executor.dialect.Upsert([]string{idSegmentMeta.pkField.column}, assignments)
+		if err != nil {
+			return nil, err
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?,?,?)", p.table, executor.columns(idSegmentMeta.fields)) + upsert
+		if _, err = exec(ctx, executor, insertSQL, []interface{}{p.tag, p.step, now, p.step, now}); err != nil {
+			return nil, err
+		}
+
+		querySQL := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", executor.quote("max_id"), p.table, executor.quote("tag"))
+		rows, err := query(ctx, executor, querySQL, []interface{}{p.tag})
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err = rows.Err(); err == nil {
+				err = fmt.Errorf("can't find id segment %s", p.tag)
+			}
+			return nil, err
+		}
+		var maxID int64
+		if err = rows.Scan(&maxID); err != nil {
+			return nil, err
+		}
+		return &segment{cur: maxID - p.step, max: maxID}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load id segment %s fail,err:%w", p.tag, err)
+	}
+	return ret.(*segment), nil
+}
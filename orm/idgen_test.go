@@ -0,0 +1,276 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type genModel struct {
+	ID   int64  `column:"id" pk:"y" pkGen:"test_gen"`
+	Name string `column:"name"`
+}
+
+func (p *genModel) TableName() string {
+	return "gen_model"
+}
+
+type badGenModel struct {
+	ID string `column:"id" pk:"y" pkGen:"test_gen"`
+}
+
+func (p *badGenModel) TableName() string {
+	return "bad_gen_model"
+}
+
+type counterGen struct {
+	mu sync.Mutex
+	id int64
+}
+
+func (p *counterGen) NextID(ctx context.Context) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.id += 100
+	return p.id, nil
+}
+
+func TestSnowflake(t *testing.T) {
+	sf, err := NewSnowflake(SnowflakeConfig{WorkerBits: 4, SequenceBits: 8, WorkerID: 5})
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var last int64
+	ids := map[int64]struct{}{}
+	for i := 0; i < 5000; i++ {
+		id, err := sf.NextID(ctx)
+		assert.NoError(t, err)
+		assert.True(t, id > last)
+		assert.EqualValues(t, 5, (id>>8)&0xf)
+		ids[id] = struct{}{}
+		last = id
+	}
+	assert.Len(t, ids, 5000)
+
+	// 时钟回拨时等待追上上次的时间,不会生成更小的id
+	last = time.Now().UnixMilli() + 5
+	sf.lastMillis = last
+	id, err := sf.NextID(ctx)
+	assert.NoError(t, err)
+	assert.True(t, id>>12+sf.epoch >= last)
+
+	_, err = NewSnowflake(SnowflakeConfig{WorkerBits: 4, WorkerID: 16})
+	assert.Error(t, err)
+	_, err = NewSnowflake(SnowflakeConfig{WorkerBits: 12, SequenceBits: 12})
+	assert.Error(t, err)
+}
+
+type fakeLocker struct {
+	mu     sync.Mutex
+	locked map[string]bool
+	deny   bool
+	fail   bool
+}
+
+func (p *fakeLocker) tryLock(key string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.locked[key] || p.deny {
+		return false, nil
+	}
+	p.locked[key] = true
+	return true, nil
+}
+
+func (p *fakeLocker) renew(key string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail {
+		return false, errors.New("renew fail")
+	}
+	return p.locked[key], nil
+}
+
+func (p *fakeLocker) unlock(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.locked, key)
+	return nil
+}
+
+func TestWorkerIDLease(t *testing.T) {
+	locker := &fakeLocker{locked: map[string]bool{"w_0": true}}
+	lease, err := leaseWorkerID("w_", 2, locker, 0, time.Minute)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, lease.WorkerID())
+
+	sf, err := NewSnowflake(SnowflakeConfig{Lease: lease})
+	assert.NoError(t, err)
+	_, err = sf.NextID(context.Background())
+	assert.NoError(t, err)
+
+	lease2, err := leaseWorkerID("w_", 2, locker, 0, time.Minute)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, lease2.WorkerID())
+	_, err = leaseWorkerID("w_", 2, locker, 0, time.Minute)
+	assert.Error(t, err)
+
+	// 锁过期后重新锁定
+	locker.unlock("w_1")
+	assert.True(t, lease.renew())
+	assert.True(t, locker.locked["w_1"])
+	assert.False(t, lease.Lost())
+
+	assert.NoError(t, lease2.Release())
+	assert.True(t, lease2.Lost())
+	assert.False(t, locker.locked["w_2"])
+
+	// 续期出错超过过期时间后租约失效
+	lease3, err := leaseWorkerID("w_", 2, locker, 0, time.Minute)
+	assert.NoError(t, err)
+	locker.fail = true
+	assert.True(t, lease3.renew())
+	assert.False(t, lease3.Lost())
+	lease3.lastRenew = time.Now().Add(-time.Minute)
+	assert.False(t, lease3.renew())
+	assert.True(t, lease3.Lost())
+	assert.True(t, locker.locked["w_2"])
+	locker.fail = false
+
+	// 锁过期且无法重新锁定时租约失效
+	locker.unlock("w_1")
+	locker.deny = true
+	assert.False(t, lease.renew())
+	assert.True(t, lease.Lost())
+	_, err = sf.NextID(context.Background())
+	assert.Error(t, err)
+}
+
+// waitPrefetch 等待异步预加载结束,避免删表后后台事务仍在执行
+func waitPrefetch(gens ...*SegmentGenerator) {
+	for _, gen := range gens {
+		for {
+			gen.mu.Lock()
+			loading := gen.loading
+			gen.mu.Unlock()
+			if !loading {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestSegmentGenerator(t *testing.T) {
+	defer dbpool.db.Exec(DropTableSQL("test_id_segments"))
+
+	gen, err := NewSegmentGenerator(dbpool, "test_id_segments", "order", 10)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var last int64
+	for i := 0; i < 25; i++ {
+		id, err := gen.NextID(ctx)
+		assert.NoError(t, err)
+		assert.True(t, id > last, "id:%d,last:%d", id, last)
+		last = id
+	}
+
+	gen2, err := NewSegmentGenerator(dbpool, "test_id_segments", "order", 10)
+	assert.NoError(t, err)
+	id, err := gen2.NextID(ctx)
+	assert.NoError(t, err)
+	assert.True(t, id > last)
+
+	other, err := NewSegmentGenerator(dbpool, "test_id_segments", "user", 10)
+	assert.NoError(t, err)
+	id, err = other.NextID(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, id)
+	waitPrefetch(gen, gen2, other)
+}
+
+// segmentRaceInterceptor 第一次插入号段表前,由另一个生成器完成同一个tag的首次加载
+type segmentRaceInterceptor struct {
+	other *SegmentGenerator
+	fired bool
+	id    int64
+	err   error
+}
+
+func (p *segmentRaceInterceptor) Before(ctx context.Context, stmt *Stmt) context.Context {
+	if !p.fired && stmt.Table == "test_id_segments" && strings.HasPrefix(stmt.SQL, "INSERT") {
+		p.fired = true
+		p.id, p.err = p.other.NextID(context.Background())
+	}
+	return ctx
+}
+
+func (p *segmentRaceInterceptor) After(ctx context.Context, stmt *Stmt) {}
+
+func TestSegmentGeneratorConcurrentLoad(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&IDSegment{})
+	fake := NewFakeDB()
+	fake.AddTable(&IDSegment{}, "test_id_segments")
+
+	other, err := NewSegmentGenerator(fake.NewPool("idgen"), "test_id_segments", "order", 10)
+	assert.NoError(t, err)
+	race := &segmentRaceInterceptor{other: other}
+	pool := fake.NewPool("idgen")
+	pool.Use(race)
+	gen, err := NewSegmentGenerator(pool, "test_id_segments", "order", 10)
+	assert.NoError(t, err)
+
+	// 两个进程同时首次加载同一个tag,分配到不重叠的号段
+	id, err := gen.NextID(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, race.fired)
+	assert.NoError(t, race.err)
+	assert.EqualValues(t, 1, race.id)
+	assert.EqualValues(t, 11, id)
+	waitPrefetch(gen, other)
+}
+
+func TestPkGen(t *testing.T) {
+	AddMeta(&genModel{})
+	createTables(t, &genModel{})
+
+	op := &Op{pool: dbpool}
+	m := &genModel{Name: "a"}
+	err = Add(op, m)
+	assert.Error(t, err)
+
+	RegisterIDGenerator("test_gen", &counterGen{})
+	defer RegisterIDGenerator("test_gen", nil)
+
+	assert.NoError(t, Add(op, m))
+	assert.EqualValues(t, 100, m.ID)
+
+	m2 := &genModel{ID: 7, Name: "b"}
+	assert.NoError(t, Add(op, m2))
+	assert.EqualValues(t, 7, m2.ID)
+
+	batch := []Entity{&genModel{Name: "c"}, &genModel{Name: "d"}}
+	err = AddBatch(op, batch)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 200, batch[0].(*genModel).ID)
+	assert.EqualValues(t, 300, batch[1].(*genModel).ID)
+
+	e, err := Get(op, &genModel{}, int64(300))
+	assert.NoError(t, err)
+	assert.Equal(t, "d", e.(*genModel).Name)
+
+	m3 := &genModel{}
+	assert.NoError(t, GenerateID(context.Background(), m3))
+	assert.EqualValues(t, 400, m3.ID)
+
+	assert.Panics(t, func() {
+		MetaOf(&badGenModel{})
+	})
+}
@@ -0,0 +1,321 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// StmtKind 拦截的操作类型
+type StmtKind string
+
+const (
+	// StmtExec 执行更新语句
+	StmtExec StmtKind = "exec"
+	// StmtQuery 执行查询语句
+	StmtQuery StmtKind = "query"
+	// StmtBegin 开始事务
+	StmtBegin StmtKind = "begin"
+	// StmtCommit 提交事务
+	StmtCommit StmtKind = "commit"
+	// StmtRollback 回滚事务
+	StmtRollback StmtKind = "rollback"
+)
+
+// Stmt 拦截器收到的语句信息,Duration,Rows及Err在调用After前设置
+type Stmt struct {
+	Pool     string        //连接池名称
+	Table    string        //从语句中解析的表名,无法解析时为空
+	Kind     StmtKind      //操作类型
+	SQL      string        //语句,Before中可以修改
+	Args     []interface{} //参数
+	Start    time.Time     //开始时间
+	Duration time.Duration //执行时间,查询语句包括读取结果的时间
+	Rows     int64         //更新语句影响的行数或者查询语句读取的行数
+	Err      error         //执行的错误
+}
+
+// Interceptor 语句拦截器,多个拦截器按添加的顺序调用Before,按相反的顺序调用After
+type Interceptor interface {
+	// Before 执行前调用,返回的ctx用于执行语句及调用After
+	Before(ctx context.Context, stmt *Stmt) context.Context
+	// After 执行完成后调用,查询语句在关闭结果时调用
+	After(ctx context.Context, stmt *Stmt)
+}
+
+var globalInterceptors atomic.Pointer[[]Interceptor]
+
+// UseInterceptors 添加对所有连接池生效的拦截器,在连接池的拦截器之前调用
+func UseInterceptors(interceptors ...Interceptor) {
+	appendInterceptors(&globalInterceptors, interceptors)
+}
+
+// Use 添加只对该连接池生效的拦截器
+func (p *Pool) Use(interceptors ...Interceptor) {
+	appendInterceptors(&p.interceptors, interceptors)
+}
+
+func appendInterceptors(dest *atomic.Pointer[[]Interceptor], interceptors []Interceptor) {
+	for {
+		old := dest.Load()
+		var list []Interceptor
+		if old != nil {
+			list = append(list, *old...)
+		}
+		list = append(list, interceptors...)
+		if dest.CompareAndSwap(old, &list) {
+			return
+		}
+	}
+}
+
+// interceptorChain 连接池生效的所有拦截器
+func (p *Pool) interceptorChain() []Interceptor {
+	global, own := globalInterceptors.Load(), p.interceptors.Load()
+	switch {
+	case global == nil && own == nil:
+		return nil
+	case own == nil:
+		return *global
+	case global == nil:
+		return *own
+	}
+	return append(append(make([]Interceptor, 0, len(*global)+len(*own)), *global...), *own...)
+}
+
+// intercept 使用拦截器执行事务操作f
+func (p *Pool) intercept(ctx context.Context, kind StmtKind, f func(ctx context.Context) error) error {
+	chain := p.interceptorChain()
+	if len(chain) == 0 {
+		return f(ctx)
+	}
+	stmt := &Stmt{Pool: p.name, Kind: kind, SQL: strings.ToUpper(string(kind)), Start: time.Now()}
+	ctx = beforeStmt(ctx, chain, stmt)
+	err := f(ctx)
+	afterStmt(ctx, chain, stmt, err)
+	return err
+}
+
+func beforeStmt(ctx context.Context, chain []Interceptor, stmt *Stmt) context.Context {
+	for _, interceptor := range chain {
+		ctx = interceptor.Before(ctx, stmt)
+	}
+	stmt.Start = time.Now()
+	return ctx
+}
+
+func afterStmt(ctx context.Context, chain []Interceptor, stmt *Stmt, err error) {
+	stmt.Duration = time.Since(stmt.Start)
+	stmt.Err = err
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].After(ctx, stmt)
+	}
+}
+
+var stmtTableRegexp = regexp.MustCompile("(?is)^\\s*(?:SELECT\\b.*?\\bFROM|INSERT\\s+(?:IGNORE\\s+)?INTO|REPLACE\\s+INTO|UPDATE|DELETE\\s+FROM|CREATE\\s+TABLE(?:\\s+IF\\s+NOT\\s+EXISTS)?|DROP\\s+TABLE(?:\\s+IF\\s+EXISTS)?|ALTER\\s+TABLE)\\s+[`\"]?([\\w.]+)")
+
+// stmtTable 解析语句操作的表名
+func stmtTable(stmt string) string {
+	if m := stmtTableRegexp.FindStringSubmatch(stmt); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// stmtRows 查询结果,关闭时调用拦截器的After
+type stmtRows struct {
+	*sql.Rows
+	ctx   context.Context
+	chain []Interceptor
+	stmt  *Stmt
+	done  bool
+}
+
+// Next 读取下一行并计数
+func (p *stmtRows) Next() bool {
+	if !p.Rows.Next() {
+		return false
+	}
+	if p.stmt != nil {
+		p.stmt.Rows++
+	}
+	return true
+}
+
+// Close 关闭结果
+func (p *stmtRows) Close() error {
+	err := p.Rows.Close()
+	if p.stmt != nil && !p.done {
+		p.done = true
+		stmtErr := p.Rows.Err()
+		if stmtErr == nil {
+			stmtErr = err
+		}
+		afterStmt(p.ctx, p.chain, p.stmt, stmtErr)
+	}
+	return err
+}
+
+// SlowLogInterceptor 慢查询日志,使用common.Logf记录执行时间不小于Threshold的语句
+type SlowLogInterceptor struct {
+	Threshold time.Duration //阈值
+	Level     c.LogLevel    //日志级别
+	LogArgs   bool          //是否记录参数
+}
+
+// NewSlowLogInterceptor 创建使用Warn级别记录执行时间不小于threshold的慢查询日志拦截器
+func NewSlowLogInterceptor(threshold time.Duration) *SlowLogInterceptor {
+	return &SlowLogInterceptor{Threshold: threshold, Level: c.Warn}
+}
+
+// Before implements Interceptor.Before
+func (p *SlowLogInterceptor) Before(ctx context.Context, stmt *Stmt) context.Context {
+	return ctx
+}
+
+// After implements Interceptor.After
+func (p *SlowLogInterceptor) After(ctx context.Context, stmt *Stmt) {
+	if stmt.Duration < p.Threshold {
+		return
+	}
+	if p.LogArgs {
+		c.Logf(p.Level, "slow sql,pool:%s,table:%s,duration:%s,rows:%d,err:%v,sql:%s,args:%v", stmt.Pool, stmt.Table, stmt.Duration, stmt.Rows, stmt.Err, stmt.SQL, stmt.Args)
+		return
+	}
+	c.Logf(p.Level, "slow sql,pool:%s,table:%s,duration:%s,rows:%d,err:%v,sql:%s", stmt.Pool, stmt.Table, stmt.Duration, stmt.Rows, stmt.Err, stmt.SQL)
+}
+
+// DefaultLatencyBuckets 延迟直方图默认的桶,单位为秒
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsKey 统计的维度
+type metricsKey struct {
+	pool  string
+	table string
+	kind  StmtKind
+}
+
+// latencySeries 一个维度的延迟直方图及错误数
+type latencySeries struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+	errors  uint64
+}
+
+// MetricsInterceptor 在进程内按连接池,表及操作类型统计延迟直方图和错误数,可以导出为Prometheus文本格式
+type MetricsInterceptor struct {
+	namespace string
+	buckets   []float64
+	mu        sync.Mutex
+	series    map[metricsKey]*latencySeries
+}
+
+// NewMetricsInterceptor 创建指标拦截器,namespace为指标名称的前缀,为空时使用orm;buckets为空时使用DefaultLatencyBuckets
+func NewMetricsInterceptor(namespace string, buckets ...float64) *MetricsInterceptor {
+	if namespace == "" {
+		namespace = "orm"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &MetricsInterceptor{namespace: namespace, buckets: buckets, series: map[metricsKey]*latencySeries{}}
+}
+
+// Before implements Interceptor.Before
+func (p *MetricsInterceptor) Before(ctx context.Context, stmt *Stmt) context.Context {
+	return ctx
+}
+
+// After implements Interceptor.After
+func (p *MetricsInterceptor) After(ctx context.Context, stmt *Stmt) {
+	key := metricsKey{pool: stmt.Pool, table: stmt.Table, kind: stmt.Kind}
+	seconds := stmt.Duration.Seconds()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	series := p.series[key]
+	if series == nil {
+		series = &latencySeries{buckets: make([]uint64, len(p.buckets))}
+		p.series[key] = series
+	}
+	for i, bound := range p.buckets {
+		if seconds <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += seconds
+	if stmt.Err != nil {
+		series.errors++
+	}
+}
+
+// WritePrometheus 以Prometheus文本格式输出<namespace>_stmt_duration_seconds直方图及<namespace>_stmt_errors_total计数
+func (p *MetricsInterceptor) WritePrometheus(w io.Writer) error {
+	p.mu.Lock()
+	keys := make([]metricsKey, 0, len(p.series))
+	snapshot := make(map[metricsKey]latencySeries, len(p.series))
+	for key, series := range p.series {
+		keys = append(keys, key)
+		snapshot[key] = latencySeries{buckets: append([]uint64(nil), series.buckets...), count: series.count, sum: series.sum, errors: series.errors}
+	}
+	p.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.pool != b.pool {
+			return a.pool < b.pool
+		}
+		if a.table != b.table {
+			return a.table < b.table
+		}
+		return a.kind < b.kind
+	})
+
+	var b strings.Builder
+	duration := p.namespace + "_stmt_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Latency of sql statements and transactions.\n# TYPE %s histogram\n", duration, duration)
+	for _, key := range keys {
+		series, labels := snapshot[key], metricsLabels(key)
+		for i, bound := range p.buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", duration, labels, strconv.FormatFloat(bound, 'g', -1, 64), series.buckets[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", duration, labels, series.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", duration, labels, strconv.FormatFloat(series.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", duration, labels, series.count)
+	}
+	errors := p.namespace + "_stmt_errors_total"
+	fmt.Fprintf(&b, "# HELP %s Errors of sql statements and transactions.\n# TYPE %s counter\n", errors, errors)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s{%s} %d\n", errors, metricsLabels(key), snapshot[key].errors)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP 输出Prometheus文本格式的指标
+func (p *MetricsInterceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := p.WritePrometheus(w); err != nil {
+		c.Errorf("write metrics fail,err:%v", err)
+	}
+}
+
+var labelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func metricsLabels(key metricsKey) string {
+	return fmt.Sprintf("pool=\"%s\",table=\"%s\",kind=\"%s\"", labelReplacer.Replace(key.pool), labelReplacer.Replace(key.table), key.kind)
+}
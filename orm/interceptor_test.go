@@ -0,0 +1,120 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type interceptModel struct {
+	ID   int64  `column:"id" pk:"y" pkAuto:"n"`
+	Name string `column:"name"`
+}
+
+func (p *interceptModel) TableName() string {
+	return "intercept_model"
+}
+
+type ctxKey string
+
+type recordInterceptor struct {
+	mu    sync.Mutex
+	name  string
+	order *[]string
+	stmts []Stmt
+}
+
+func (p *recordInterceptor) Before(ctx context.Context, stmt *Stmt) context.Context {
+	*p.order = append(*p.order, "before:"+p.name)
+	return context.WithValue(ctx, ctxKey(p.name), true)
+}
+
+func (p *recordInterceptor) After(ctx context.Context, stmt *Stmt) {
+	*p.order = append(*p.order, "after:"+p.name)
+	if ctx.Value(ctxKey(p.name)) != true {
+		panic("lost context")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stmts = append(p.stmts, *stmt)
+}
+
+func TestStmtTable(t *testing.T) {
+	for stmt, table := range map[string]string{
+		"SELECT `id`,`name` FROM t_user WHERE id = ?":        "t_user",
+		"select count(*)\nfrom `t_user`":                     "t_user",
+		"INSERT INTO t_user (`id`) VALUES(?)":                "t_user",
+		"INSERT IGNORE INTO t_user (`id`) VALUES(?)":         "t_user",
+		"UPDATE \"t_user\" SET name=?":                       "t_user",
+		"DELETE FROM t_user WHERE id = ?":                    "t_user",
+		"CREATE TABLE IF NOT EXISTS t_user (id INT)":         "t_user",
+		"DROP TABLE IF EXISTS t_user":                        "t_user",
+		"SAVEPOINT sp_1":                                     "",
+		"SELECT * FROM (SELECT id FROM t_user) AS t":         "t_user",
+		"  SELECT name FROM test.t_user ORDER BY id LIMIT 1": "test.t_user",
+	} {
+		assert.Equal(t, table, stmtTable(stmt), stmt)
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	AddMeta(&interceptModel{})
+	createTables(t, &interceptModel{})
+
+	pool := NewPool(dbpool.db, dbpool.Dialect())
+	pool.name = "p0"
+	var order []string
+	global := &recordInterceptor{name: "global", order: &order}
+	local := &recordInterceptor{name: "local", order: &order}
+	UseInterceptors(global)
+	defer globalInterceptors.Store(nil)
+	metrics := NewMetricsInterceptor("")
+	pool.Use(local, metrics, NewSlowLogInterceptor(time.Hour))
+
+	op := pool.NewOp()
+	assert.NoError(t, Add(op, &interceptModel{ID: 1, Name: "a"}))
+	assert.Equal(t, []string{"before:global", "before:local", "after:local", "after:global"}, order)
+	assert.Len(t, local.stmts, 1)
+	stmt := local.stmts[0]
+	assert.Equal(t, "p0", stmt.Pool)
+	assert.Equal(t, "intercept_model", stmt.Table)
+	assert.Equal(t, StmtExec, stmt.Kind)
+	assert.EqualValues(t, 1, stmt.Rows)
+	assert.Equal(t, []interface{}{int64(1), "a"}, stmt.Args)
+	assert.True(t, stmt.Duration > 0)
+	assert.NoError(t, stmt.Err)
+
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		return nil, Add(op, &interceptModel{ID: 2, Name: "b"})
+	})
+	assert.NoError(t, err)
+	entities, err := Query(op, &interceptModel{}, "ORDER BY id")
+	assert.NoError(t, err)
+	assert.Len(t, entities, 2)
+	_, err = Query(op, &interceptModel{}, "WHERE no_column = 1")
+	assert.Error(t, err)
+
+	var kinds []StmtKind
+	for _, stmt := range local.stmts {
+		kinds = append(kinds, stmt.Kind)
+	}
+	assert.Equal(t, []StmtKind{StmtExec, StmtBegin, StmtExec, StmtCommit, StmtQuery, StmtQuery}, kinds)
+	assert.EqualValues(t, 2, local.stmts[4].Rows)
+	assert.Error(t, local.stmts[5].Err)
+	assert.Len(t, global.stmts, len(local.stmts))
+
+	var b strings.Builder
+	assert.NoError(t, metrics.WritePrometheus(&b))
+	out := b.String()
+	assert.Contains(t, out, "# TYPE orm_stmt_duration_seconds histogram\n")
+	assert.Contains(t, out, `orm_stmt_duration_seconds_count{pool="p0",table="intercept_model",kind="exec"} 2`)
+	assert.Contains(t, out, `orm_stmt_duration_seconds_bucket{pool="p0",table="intercept_model",kind="query",le="+Inf"} 2`)
+	assert.Contains(t, out, `orm_stmt_duration_seconds_count{pool="p0",table="",kind="commit"} 1`)
+	assert.Contains(t, out, `orm_stmt_errors_total{pool="p0",table="intercept_model",kind="query"} 1`)
+	assert.Contains(t, out, `orm_stmt_errors_total{pool="p0",table="intercept_model",kind="exec"} 0`)
+}
@@ -0,0 +1,106 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// errStopIterate 用于提前结束遍历
+var errStopIterate = errors.New("stop iterate")
+
+// Iterate 根据条件逐行遍历实体,不包含软删除的记录;与Query不同,结果不会全部加载到内存中,f返回错误时结束遍历并返回该错误
+func Iterate(op *Op, entity Entity, condition string, params []interface{}, f func(Entity) error) error {
+	return IterateCtx(op.Context(), op, entity, condition, params, f)
+}
+
+// IterateCtx 使用ctx根据条件逐行遍历实体;遍历期间连接一直被占用,在事务中遍历时f不能再使用该事务执行语句
+func IterateCtx(ctx context.Context, op *Op, entity Entity, condition string, params []interface{}, f func(Entity) error) error {
+	modelMeta := findEntityMeta(entity)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.iterateFunc(ctx, op.readExecutor(ctx), entity, condition, params, f)
+}
+
+// IterateT 根据条件逐行遍历T,用于for range,出错时最后一次迭代返回错误
+func IterateT[T Entity](op *Op, condition string, params ...interface{}) iter.Seq2[T, error] {
+	return IterateTCtx[T](op.Context(), op, condition, params...)
+}
+
+// IterateTCtx 使用ctx根据条件逐行遍历T
+func IterateTCtx[T Entity](ctx context.Context, op *Op, condition string, params ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		err := IterateCtx(ctx, op, newEntity[T](), condition, params, func(e Entity) error {
+			if !yield(e.(T), nil) {
+				return errStopIterate
+			}
+			return nil
+		})
+		if err != nil && err != errStopIterate {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// IterateByPK 按主键顺序分批遍历实体,参见IterateByPKCtx
+func IterateByPK(op *Op, entity Entity, batchSize int, condition string, params []interface{}, f func([]Entity) error) error {
+	return IterateByPKCtx(op.Context(), op, entity, batchSize, condition, params, f)
+}
+
+// IterateByPKCtx 使用ctx按主键顺序(keyset分页)每次查询batchSize条实体并调用f,直到遍历完整个表;
+// condition为附加的过滤条件,不包含WHERE,如"status = ?",为空时遍历所有记录;每批使用单独的语句,f中可以执行其他操作
+func IterateByPKCtx(ctx context.Context, op *Op, entity Entity, batchSize int, condition string, params []interface{}, f func([]Entity) error) error {
+	if batchSize <= 0 {
+		return NewDBErrorf(nil, "invalid batch size %d", batchSize)
+	}
+	modelMeta := findEntityMeta(entity)
+	pkColumn := op.Dialect().Quote(modelMeta.pkField.column)
+	tail := " ORDER BY " + pkColumn
+	if limit := op.Dialect().Limit(batchSize, 0); limit != "" {
+		tail += " " + limit
+	}
+
+	var lastKey interface{}
+	for {
+		where, args := condition, append([]interface{}{}, params...)
+		if lastKey != nil {
+			if where != "" {
+				where = "(" + where + ") AND "
+			}
+			where += pkColumn + " > ?"
+			args = append(args, lastKey)
+		}
+		if where != "" {
+			where = "WHERE " + where
+		}
+
+		entities, err := QueryCtx(ctx, op, entity, where+tail, args...)
+		if err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return nil
+		}
+		if err = f(entities); err != nil {
+			return err
+		}
+		if len(entities) < batchSize {
+			return nil
+		}
+		_, ind, _ := extract(entities[len(entities)-1])
+		lastKey = ind.FieldByIndex(modelMeta.pkField.index).Interface()
+	}
+}
+
+// IterateByPKT 按主键顺序分批遍历T,参见IterateByPKCtx
+func IterateByPKT[T Entity](op *Op, batchSize int, condition string, params []interface{}, f func([]T) error) error {
+	return IterateByPKTCtx(op.Context(), op, batchSize, condition, params, f)
+}
+
+// IterateByPKTCtx 使用ctx按主键顺序分批遍历T
+func IterateByPKTCtx[T Entity](ctx context.Context, op *Op, batchSize int, condition string, params []interface{}, f func([]T) error) error {
+	return IterateByPKCtx(ctx, op, newEntity[T](), batchSize, condition, params, func(entities []Entity) error {
+		return f(toTyped[T](entities))
+	})
+}
@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type iterModel struct {
+	ID   int64 `column:"id" pk:"y" pkAuto:"n"`
+	Kind int64 `column:"kind"`
+}
+
+func (p *iterModel) TableName() string {
+	return "iter_model"
+}
+
+func TestIterate(t *testing.T) {
+	AddMeta(&iterModel{})
+	createTables(t, &iterModel{})
+
+	op := &Op{pool: dbpool}
+	var entities []Entity
+	for i := int64(1); i <= 10; i++ {
+		entities = append(entities, &iterModel{ID: i, Kind: i % 2})
+	}
+	assert.NoError(t, AddBatch(op, entities))
+
+	var ids []int64
+	err = Iterate(op, &iterModel{}, "WHERE kind = ? ORDER BY id", []interface{}{1}, func(e Entity) error {
+		ids = append(ids, e.(*iterModel).ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 3, 5, 7, 9}, ids)
+
+	stop := fmt.Errorf("stop")
+	count := 0
+	err = Iterate(op, &iterModel{}, "", nil, func(e Entity) error {
+		count++
+		if count == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 2, count)
+
+	ids = ids[:0]
+	for m, err := range IterateT[*iterModel](op, "ORDER BY id DESC") {
+		assert.NoError(t, err)
+		ids = append(ids, m.ID)
+		if len(ids) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int64{10, 9, 8}, ids)
+
+	for _, err := range IterateT[*iterModel](op, "WHERE no_column = 1") {
+		assert.Error(t, err)
+	}
+
+	var batches [][]int64
+	err = IterateByPKT(op, 3, "", nil, func(ms []*iterModel) error {
+		var batch []int64
+		for _, m := range ms {
+			batch = append(batch, m.ID)
+		}
+		batches = append(batches, batch)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]int64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10}}, batches)
+
+	batches = batches[:0]
+	err = IterateByPK(op, &iterModel{}, 2, "kind = ?", []interface{}{0}, func(es []Entity) error {
+		var batch []int64
+		for _, e := range es {
+			batch = append(batch, e.(*iterModel).ID)
+		}
+		batches = append(batches, batch)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]int64{{2, 4}, {6, 8}, {10}}, batches)
+
+	assert.Error(t, IterateByPK(op, &iterModel{}, 0, "", nil, func([]Entity) error { return nil }))
+}
@@ -0,0 +1,337 @@
+package orm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// TablePlaceholder 迁移语句中表名的占位符
+const TablePlaceholder = "{{table}}"
+
+// DefaultMigrationTable 默认记录迁移版本的表名
+const DefaultMigrationTable = "orm_migrations"
+
+// Migration 一个版本的数据库迁移
+type Migration struct {
+	Version int64    //版本号,必须大于0且唯一
+	Name    string   //名称
+	Up      []string //升级的语句
+	Down    []string //回滚的语句
+	Entity  Entity   //不为空时,语句中的{{table}}替换为实体的表名,分片时对实体的每个分表执行
+	Rule    string   //实体的分片规则名称,为空时使用默认规则
+}
+
+// Checksum 迁移的校验和,由Name和Up语句计算,已执行的迁移被修改时校验失败
+func (p *Migration) Checksum() string {
+	h := sha256.New()
+	h.Write([]byte(p.Name))
+	for _, stmt := range p.Up {
+		h.Write([]byte{0})
+		h.Write([]byte(stmt))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// statements 将语句中的{{table}}替换为tables中的每个表名
+func (p *Migration) statements(stmts []string, tables []string) []string {
+	if p.Entity == nil {
+		return stmts
+	}
+	ret := make([]string, 0, len(stmts)*len(tables))
+	for _, table := range tables {
+		for _, stmt := range stmts {
+			ret = append(ret, strings.ReplaceAll(stmt, TablePlaceholder, table))
+		}
+	}
+	return ret
+}
+
+// CreateTableMigration 创建实体表的迁移,Down为删除表
+func CreateTableMigration(version int64, entity Entity, dialect Dialect) (*Migration, error) {
+	m, err := schemaMeta(entity)
+	if err != nil {
+		return nil, err
+	}
+	up, err := createTableSQL(m, TablePlaceholder, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migration{
+		Version: version,
+		Name:    "create table " + entity.TableName(),
+		Up:      up,
+		Down:    []string{DropTableSQL(TablePlaceholder)},
+		Entity:  entity,
+	}, nil
+}
+
+// AppliedMigration 已经执行的迁移,多个分片可能使用同一个数据库,因此以分片名称和版本号作为唯一键
+type AppliedMigration struct {
+	ID        int64  `column:"id" pk:"y"`
+	Shard     string `column:"shard" size:"64" unique:"uk_shard_version"`
+	Version   int64  `column:"version" unique:"uk_shard_version"`
+	Name      string `column:"name" size:"255"`
+	Checksum  string `column:"checksum" size:"64"`
+	AppliedAt int64  `column:"applied_at"`
+}
+
+// TableName implements Entity.TableName
+func (p *AppliedMigration) TableName() string {
+	return DefaultMigrationTable
+}
+
+var appliedMigrationMeta = MetaOf(&AppliedMigration{}).(*meta)
+
+// Migrator 按版本执行数据库迁移,每个数据库中使用Table记录已经执行的版本
+type Migrator struct {
+	Table      string //记录迁移版本的表名,为空时使用DefaultMigrationTable
+	migrations []*Migration
+}
+
+// NewMigrator 创建Migrator
+func NewMigrator(migrations ...*Migration) (*Migrator, error) {
+	versions := map[int64]struct{}{}
+	sorted := make([]*Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m == nil || m.Version <= 0 {
+			return nil, fmt.Errorf("invalid migration %v", m)
+		}
+		if _, ok := versions[m.Version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		versions[m.Version] = struct{}{}
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Migrator{migrations: sorted}, nil
+}
+
+func (p *Migrator) table() string {
+	if p.Table != "" {
+		return p.Table
+	}
+	return DefaultMigrationTable
+}
+
+// migrationTables 返回迁移在连接池中需要处理的表
+type migrationTables func(m *Migration) ([]string, error)
+
+// Up 在pool中执行所有未执行的迁移,关联实体的迁移使用实体的表名
+func (p *Migrator) Up(ctx context.Context, pool *Pool) error {
+	return p.up(ctx, pool.NewOp(), entityTables)
+}
+
+// Down 在pool中回滚所有版本大于version的迁移
+func (p *Migrator) Down(ctx context.Context, pool *Pool, version int64) error {
+	return p.down(ctx, pool.NewOp(), version, entityTables)
+}
+
+// UpShards 在service的所有连接池中执行未执行的迁移,关联实体的迁移对实体的每个分表执行
+func (p *Migrator) UpShards(ctx context.Context, service ShardDBService) error {
+	return p.eachShard(service, func(op *Op, tables migrationTables) error {
+		return p.up(ctx, op, tables)
+	})
+}
+
+// DownShards 在service的所有连接池中回滚版本大于version的迁移
+func (p *Migrator) DownShards(ctx context.Context, service ShardDBService, version int64) error {
+	return p.eachShard(service, func(op *Op, tables migrationTables) error {
+		return p.down(ctx, op, version, tables)
+	})
+}
+
+// Applied 查询pool中已经执行的迁移
+func (p *Migrator) Applied(ctx context.Context, pool *Pool) ([]*AppliedMigration, error) {
+	op := pool.NewOp()
+	if err := p.ensureTable(ctx, op); err != nil {
+		return nil, err
+	}
+	return p.applied(ctx, op)
+}
+
+func entityTables(m *Migration) ([]string, error) {
+	if m.Entity == nil {
+		return nil, nil
+	}
+	table, err := tblName(m.Entity)
+	if err != nil {
+		return nil, err
+	}
+	return []string{table}, nil
+}
+
+func (p *Migrator) eachShard(service ShardDBService, f func(op *Op, tables migrationTables) error) error {
+	for _, poolName := range service.PoolNames() {
+		op, err := service.NewOpByShardName(poolName)
+		if err != nil {
+			return err
+		}
+		tables := func(m *Migration) ([]string, error) {
+			if m.Entity == nil {
+				return nil, nil
+			}
+			shardTables, err := service.shardTables(m.Entity, m.Rule)
+			if err != nil {
+				return nil, err
+			}
+			return shardTables[poolName], nil
+		}
+		if err = f(op, tables); err != nil {
+			return fmt.Errorf("migrate pool %s fail,err:%w", poolName, err)
+		}
+	}
+	return nil
+}
+
+func (p *Migrator) ensureTable(ctx context.Context, op *Op) error {
+	stmts, err := createTableSQL(appliedMigrationMeta, p.table(), op.Dialect())
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err = exec(ctx, op.executor(), stmt, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Migrator) applied(ctx context.Context, op *Op) ([]*AppliedMigration, error) {
+	executor := op.executor()
+	querySQL := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? ORDER BY %s", executor.columns(appliedMigrationMeta.fields), p.table(), executor.quote("shard"), executor.quote("version"))
+	rows, err := query(ctx, executor, querySQL, []interface{}{op.PoolName()})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []*AppliedMigration
+	for rows.Next() {
+		m := &AppliedMigration{}
+		if err = rows.Scan(&m.ID, &m.Shard, &m.Version, &m.Name, &m.Checksum, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// verify 校验已经执行的迁移是否被修改
+func (p *Migrator) verify(applied []*AppliedMigration) (map[int64]*AppliedMigration, error) {
+	definitions := map[int64]*Migration{}
+	for _, m := range p.migrations {
+		definitions[m.Version] = m
+	}
+	ret := map[int64]*AppliedMigration{}
+	for _, a := range applied {
+		ret[a.Version] = a
+		m := definitions[a.Version]
+		if m == nil {
+			c.Warnf("applied migration %d %s not found", a.Version, a.Name)
+			continue
+		}
+		if checksum := m.Checksum(); checksum != a.Checksum {
+			return nil, fmt.Errorf("checksum mismatch for migration %d %s,applied:%s,current:%s", a.Version, a.Name, a.Checksum, checksum)
+		}
+	}
+	return ret, nil
+}
+
+func (p *Migrator) run(ctx context.Context, op *Op, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := exec(ctx, op.executor(), stmt, nil); err != nil {
+			return fmt.Errorf("exec %s fail,err:%w", stmt, err)
+		}
+	}
+	return nil
+}
+
+func (p *Migrator) up(ctx context.Context, op *Op, tables migrationTables) error {
+	if err := p.ensureTable(ctx, op); err != nil {
+		return err
+	}
+	applied, err := p.applied(ctx, op)
+	if err != nil {
+		return err
+	}
+	appliedVersions, err := p.verify(applied)
+	if err != nil {
+		return err
+	}
+
+	executor := op.executor()
+	insertFields := filterFields(exceptIDPred, appliedMigrationMeta.fields)
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES(?,?,?,?,?)", p.table(), executor.columns(insertFields))
+	for _, m := range p.migrations {
+		if _, ok := appliedVersions[m.Version]; ok {
+			continue
+		}
+		mtables, err := tables(m)
+		if err != nil {
+			return err
+		}
+		if err = p.run(ctx, op, m.statements(m.Up, mtables)); err != nil {
+			return fmt.Errorf("migrate up %d %s fail,err:%w", m.Version, m.Name, err)
+		}
+		if _, err = exec(ctx, executor, insertSQL, []interface{}{op.PoolName(), m.Version, m.Name, m.Checksum(), c.UnixMills(time.Now())}); err != nil {
+			return err
+		}
+		c.Infof("migrate up %d %s on %s", m.Version, m.Name, op.PoolName())
+	}
+	return nil
+}
+
+func (p *Migrator) down(ctx context.Context, op *Op, version int64, tables migrationTables) error {
+	if err := p.ensureTable(ctx, op); err != nil {
+		return err
+	}
+	applied, err := p.applied(ctx, op)
+	if err != nil {
+		return err
+	}
+	if _, err = p.verify(applied); err != nil {
+		return err
+	}
+
+	definitions := map[int64]*Migration{}
+	for _, m := range p.migrations {
+		definitions[m.Version] = m
+	}
+
+	executor := op.executor()
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", p.table(), executor.quote("id"))
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		if a.Version <= version {
+			break
+		}
+		m := definitions[a.Version]
+		if m == nil {
+			return fmt.Errorf("can't find migration %d %s to rollback", a.Version, a.Name)
+		}
+		mtables, err := tables(m)
+		if err != nil {
+			return err
+		}
+		if err = p.run(ctx, op, m.statements(m.Down, mtables)); err != nil {
+			return fmt.Errorf("migrate down %d %s fail,err:%w", m.Version, m.Name, err)
+		}
+		if _, err = exec(ctx, executor, deleteSQL, []interface{}{a.ID}); err != nil {
+			return err
+		}
+		c.Infof("migrate down %d %s on %s", m.Version, m.Name, op.PoolName())
+	}
+	return nil
+}
@@ -34,15 +34,24 @@ func NewMySQLDBPool(config *DBConfig) (*Pool, error) {
 		}
 	}
 
-	db, err := sql.Open("mysql", connectURL)
+	db, err := sql.Open(config.driverName(MySQLDialect), connectURL)
 	if err != nil {
 		log.Println("Error on initializing database connection,", err.Error())
 		return nil, &DBError{"Can't open connection", err}
 	}
 
 	c.Infof("db max idle connections:%d,max open connections:%d,charset:%s,ext:%v", config.MaxIdle, config.MaxConn, charset, config.Ext)
+	setupDBLimits(db, config)
+	if err = setupCodecs(config); err != nil {
+		db.Close()
+		return nil, NewDBError(err, "Invalid config")
+	}
+	return withReplicas(NewPool(db, MySQLDialect), config, NewMySQLDBPool)
+}
+
+// setupDBLimits 设置连接数及连接的生命周期
+func setupDBLimits(db *sql.DB, config *DBConfig) {
 	db.SetMaxIdleConns(config.MaxIdle)
 	db.SetMaxOpenConns(config.MaxConn)
 	db.SetConnMaxLifetime(time.Duration(config.MaxTimeSecond) * time.Second)
-	return &Pool{db: db}, nil
 }
@@ -6,6 +6,9 @@ import (
 )
 
 func TestMysqlCreateor(t *testing.T) {
+	if dbpool.Dialect() != MySQLDialect {
+		t.Skip("mysql only")
+	}
 	dbp, err := NewMySQLDBPool(&config)
 	if err != nil {
 		t.Errorf("Create fail %s", err.Error())
@@ -1,10 +1,13 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 
 	c "github.com/d0ngw/go/common"
 )
@@ -25,7 +28,15 @@ type Op struct {
 	txDone         bool           //事务是否结束
 	rollbackOnly   bool           //是否只回滚
 	transDepth     int            //调用的深度
+	savepoints     int            //嵌套事务中保存点的深度
+	versions       []savedVersion //事务中更新成功的实体的原版本号,回滚时恢复
 	sharDBSerevcie ShardDBService //分片服务
+	ctx            context.Context
+	timeout        time.Duration //每条语句的超时时间,<=0表示不限制
+	batch          BatchOptions  //批量写入的参数
+	txRetry        TxRetryPolicy //事务的重试策略
+	forcePrimary   bool          //读操作是否强制使用主库
+	wrote          bool          //是否已经在主库上执行过语句,之后的读操作使用主库
 }
 
 // DB sql.DB
@@ -43,6 +54,98 @@ func (p *Op) PoolName() string {
 	return p.pool.name
 }
 
+// Context 返回默认的上下文,未设置时为context.Background()
+func (p *Op) Context() context.Context {
+	if p.ctx != nil {
+		return p.ctx
+	}
+	return context.Background()
+}
+
+// SetContext 设置默认的上下文,不带ctx的操作都使用该上下文
+func (p *Op) SetContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+// SetTimeout 设置每条语句的超时时间,<=0表示不限制
+func (p *Op) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+// Timeout 每条语句的超时时间
+func (p *Op) Timeout() time.Duration {
+	return p.timeout
+}
+
+// SetBatchOptions 设置批量写入的参数,未设置的项使用DefaultBatchOptions
+func (p *Op) SetBatchOptions(opts BatchOptions) {
+	p.batch = opts
+}
+
+// BatchOptions 批量写入的参数
+func (p *Op) BatchOptions() BatchOptions {
+	opts := p.batch
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = DefaultBatchOptions.MaxRows
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultBatchOptions.MaxBytes
+	}
+	return opts
+}
+
+// SetTxRetryPolicy 设置DoInTrans的重试策略,未设置的项使用DefaultTxRetryPolicy
+func (p *Op) SetTxRetryPolicy(policy TxRetryPolicy) {
+	p.txRetry = policy
+}
+
+// TxRetryPolicy DoInTrans的重试策略
+func (p *Op) TxRetryPolicy() TxRetryPolicy {
+	return p.txRetry.withDefault()
+}
+
+// SetForcePrimary 设置读操作是否强制使用主库;没有设置时,Op在主库执行过写操作或者在事务中时也使用主库
+func (p *Op) SetForcePrimary(force bool) {
+	p.forcePrimary = force
+}
+
+// stmtContext 为一条语句构建上下文
+func (p *Op) stmtContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = p.Context()
+	}
+	if p.timeout > 0 {
+		return context.WithTimeout(ctx, p.timeout)
+	}
+	return ctx, func() {}
+}
+
+// Dialect 数据库方言
+func (p *Op) Dialect() Dialect {
+	return p.pool.Dialect()
+}
+
+// executor 返回在主库执行语句的对象,在事务中使用sql.Tx,否则使用sql.DB;之后的读操作也使用主库
+func (p *Op) executor() *sqlExecutor {
+	p.wrote = true
+	return p.primaryExecutor()
+}
+
+func (p *Op) primaryExecutor() *sqlExecutor {
+	if p.tx != nil {
+		return &sqlExecutor{runner: p.tx, dialect: p.Dialect(), pool: p.pool, op: p}
+	}
+	return &sqlExecutor{runner: p.DB(), dialect: p.Dialect(), pool: p.pool}
+}
+
+// readExecutor 读操作的执行对象,在事务中,执行过写操作或者强制使用主库时使用主库,否则使用从库
+func (p *Op) readExecutor(ctx context.Context) *sqlExecutor {
+	if p.tx != nil || p.wrote || p.forcePrimary || p.pool.replicas == nil || isForcePrimary(ctx) {
+		return p.primaryExecutor()
+	}
+	return &sqlExecutor{runner: p.pool.readDB(), dialect: p.Dialect(), pool: p.pool}
+}
+
 // SetupTableShard use op pool setup entity table shard
 func (p *Op) SetupTableShard(entity Entity, ruleName string) error {
 	if p.sharDBSerevcie == nil {
@@ -62,6 +165,32 @@ func (p *Op) close() {
 	p.tx = nil
 	p.rollbackOnly = false
 	p.transDepth = 0
+	p.savepoints = 0
+	p.versions = nil
+}
+
+// savedVersion 实体版本号字段及更新前的值
+type savedVersion struct {
+	field reflect.Value
+	value reflect.Value
+}
+
+// saveVersion 在事务中记录版本号字段更新前的值
+func (p *Op) saveVersion(field reflect.Value) {
+	if p.tx == nil {
+		return
+	}
+	value := reflect.New(field.Type()).Elem()
+	value.Set(field)
+	p.versions = append(p.versions, savedVersion{field: field, value: value})
+}
+
+// restoreVersions 回滚时将第from次之后记录的版本号恢复为更新前的值
+func (p *Op) restoreVersions(from int) {
+	for i := len(p.versions) - 1; i >= from; i-- {
+		p.versions[i].field.Set(p.versions[i].value)
+	}
+	p.versions = p.versions[:from]
 }
 
 //检查事务的状态
@@ -100,24 +229,42 @@ func (p *Op) finishTrans() error {
 	}
 	defer p.close()
 	p.txDone = true
+	tx := p.tx
 	if p.rollbackOnly {
-		return p.tx.Rollback()
+		p.restoreVersions(0)
+		return p.pool.intercept(p.Context(), StmtRollback, func(context.Context) error {
+			return tx.Rollback()
+		})
 	}
-	return p.tx.Commit()
+	return p.pool.intercept(p.Context(), StmtCommit, func(context.Context) error {
+		return tx.Commit()
+	})
 }
 
 // BeginTx 开始事务,支持简单的嵌套调用,如果已经开始了事务,则直接返回成功
 func (p *Op) BeginTx() (err error) {
+	return p.BeginTxCtx(p.Context(), nil)
+}
+
+// BeginTxCtx 使用ctx和opts开始事务,如果已经开始了事务,则直接返回成功,opts被忽略;
+// ctx被取消时事务会被回滚
+func (p *Op) BeginTxCtx(ctx context.Context, opts *sql.TxOptions) (err error) {
 	p.incrTransDepth()
 	if p.tx != nil {
 		return nil //事务已经开启
 	}
-	if tx, err := p.DB().Begin(); err == nil {
-		p.tx = tx
-		p.txDone = false
-		return nil
+	var tx *sql.Tx
+	err = p.pool.intercept(ctx, StmtBegin, func(ctx context.Context) (err error) {
+		tx, err = p.DB().BeginTx(ctx, opts)
+		return
+	})
+	if err != nil {
+		p.transDepth = 0
+		return err
 	}
-	return err
+	p.tx = tx
+	p.txDone = false
+	return nil
 }
 
 // Commit 提交事务
@@ -141,9 +288,36 @@ func (p *Op) IsRollbackOnly() bool {
 	return p.rollbackOnly
 }
 
-// DoInTrans 在事务中执行
+// DoInTrans 在事务中执行,已经开始了事务时加入该事务(PropagationRequired)
 func (p *Op) DoInTrans(peration OpTxFunc) (rt interface{}, err error) {
-	if err := p.BeginTx(); err != nil {
+	return p.DoInTransCtx(p.Context(), nil, peration)
+}
+
+// DoInTransCtx 使用ctx和opts在事务中执行;开始新的事务时,失败的事务按照TxRetryPolicy回滚后重新执行
+func (p *Op) DoInTransCtx(ctx context.Context, opts *sql.TxOptions, peration OpTxFunc) (rt interface{}, err error) {
+	policy := p.TxRetryPolicy()
+	if p.tx != nil || policy.MaxAttempts <= 1 {
+		return p.doInTrans(ctx, opts, peration)
+	}
+	for attempt := 1; ; attempt++ {
+		rt, err = p.doInTrans(ctx, opts, peration)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			return
+		}
+		delay := policy.backoff(attempt)
+		c.Warnf("Retry transaction after %v,attempt:%d,err:%v", delay, attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *Op) doInTrans(ctx context.Context, opts *sql.TxOptions, peration OpTxFunc) (rt interface{}, err error) {
+	if err := p.BeginTxCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	var succ = false
@@ -169,6 +343,98 @@ func (p *Op) DoInTrans(peration OpTxFunc) (rt interface{}, err error) {
 	return
 }
 
+// Propagation 事务的传播方式
+type Propagation int
+
+const (
+	// PropagationRequired 已经开始了事务时加入该事务,内层失败会导致整个事务回滚,DoInTrans使用该方式
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew 总是使用新的事务(新的连接),已经开始的事务被挂起,在新事务结束后恢复
+	PropagationRequiresNew
+	// PropagationNested 已经开始了事务时使用SAVEPOINT,内层失败只回滚到保存点,不影响外层事务;没有事务时同PropagationRequired
+	PropagationNested
+)
+
+// DoInTransWith 使用传播方式propagation在事务中执行
+func (p *Op) DoInTransWith(propagation Propagation, peration OpTxFunc) (rt interface{}, err error) {
+	return p.DoInTransWithCtx(p.Context(), nil, propagation, peration)
+}
+
+// DoInTransWithCtx 使用ctx,opts和传播方式propagation在事务中执行,加入已有事务时opts被忽略
+func (p *Op) DoInTransWithCtx(ctx context.Context, opts *sql.TxOptions, propagation Propagation, peration OpTxFunc) (rt interface{}, err error) {
+	if p.tx == nil {
+		return p.DoInTransCtx(ctx, opts, peration)
+	}
+	switch propagation {
+	case PropagationRequired:
+		return p.DoInTransCtx(ctx, opts, peration)
+	case PropagationRequiresNew:
+		return p.doInNewTrans(ctx, opts, peration)
+	case PropagationNested:
+		return p.doInNestedTrans(ctx, peration)
+	}
+	return nil, NewDBErrorf(nil, "Invalid propagation %d", propagation)
+}
+
+// doInNewTrans 挂起当前的事务,在新的事务中执行
+func (p *Op) doInNewTrans(ctx context.Context, opts *sql.TxOptions, peration OpTxFunc) (rt interface{}, err error) {
+	tx, txDone, rollbackOnly, transDepth, savepoints, versions := p.tx, p.txDone, p.rollbackOnly, p.transDepth, p.savepoints, p.versions
+	p.tx, p.txDone, p.rollbackOnly, p.transDepth, p.savepoints, p.versions = nil, false, false, 0, 0, nil
+	defer func() {
+		p.tx, p.txDone, p.rollbackOnly, p.transDepth, p.savepoints, p.versions = tx, txDone, rollbackOnly, transDepth, savepoints, versions
+	}()
+	return p.DoInTransCtx(ctx, opts, peration)
+}
+
+// doInNestedTrans 在当前事务的保存点中执行,失败时回滚到保存点,并恢复外层事务的rollbackOnly
+func (p *Op) doInNestedTrans(ctx context.Context, peration OpTxFunc) (rt interface{}, err error) {
+	if err = p.checkTransStatus(); err != nil {
+		return nil, err
+	}
+	p.savepoints++
+	savepoint := "sp_" + strconv.Itoa(p.savepoints)
+	executor := p.primaryExecutor()
+	if _, err = exec(ctx, executor, "SAVEPOINT "+savepoint, nil); err != nil {
+		p.savepoints--
+		return nil, err
+	}
+
+	var (
+		succ         = false
+		rollbackOnly = p.rollbackOnly
+		versions     = len(p.versions)
+	)
+	defer func() {
+		p.savepoints--
+		if succ {
+			if _, releaseErr := exec(ctx, executor, "RELEASE SAVEPOINT "+savepoint, nil); releaseErr != nil {
+				c.Errorf("Release savepoint %s err:%v", savepoint, releaseErr)
+				rt = nil
+				err = releaseErr
+			}
+			return
+		}
+		if _, rollbackErr := exec(ctx, executor, "ROLLBACK TO SAVEPOINT "+savepoint, nil); rollbackErr != nil {
+			c.Errorf("Rollback to savepoint %s err:%v", savepoint, rollbackErr)
+			p.SetRollbackOnly(true)
+			if err == nil {
+				rt = nil
+				err = rollbackErr
+			}
+			return
+		}
+		p.rollbackOnly = rollbackOnly
+		p.restoreVersions(versions)
+	}()
+	rt, err = peration(p.tx)
+	if err != nil {
+		c.Errorf("Nested operation fail:%v", err)
+	} else {
+		succ = true
+	}
+	return
+}
+
 //查找实体对应的模型元
 func findEntityMeta(entity Entity) *meta {
 	_, _, typ := extract(entity)
@@ -181,107 +447,126 @@ func findEntityMeta(entity Entity) *meta {
 
 // Add 添加实体
 func Add(op *Op, entity Entity) error {
+	return AddCtx(op.Context(), op, entity)
+}
+
+// AddCtx 使用ctx添加实体
+func AddCtx(ctx context.Context, op *Op, entity Entity) error {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.insertFunc(op.tx, entity)
-	}
-	return modelMeta.insertFunc(op.DB(), entity)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.insertFunc(ctx, op.executor(), entity)
 }
 
-// Update 更新实体
+// Update 更新实体,实体有软删除字段时不更新已删除的记录,使用Unscoped可以包含
 func Update(op *Op, entity Entity) (bool, error) {
+	return UpdateCtx(op.Context(), op, entity)
+}
+
+// UpdateCtx 使用ctx更新实体
+func UpdateCtx(ctx context.Context, op *Op, entity Entity) (bool, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		bvalue, err := modelMeta.updateFunc(op.tx, entity)
-		if err != nil {
-			return false, err
-		}
-		return reflect.ValueOf(bvalue).Bool(), nil
-	}
-	return modelMeta.updateFunc(op.DB(), entity)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.updateFunc(ctx, op.executor(), entity)
 }
 
 // UpdateReplace 更新实体
 func UpdateReplace(op *Op, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error) {
+	return UpdateReplaceCtx(op.Context(), op, entity, replColumns, excludeColumns)
+}
+
+// UpdateReplaceCtx 使用ctx更新实体
+func UpdateReplaceCtx(ctx context.Context, op *Op, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		bvalue, err := modelMeta.updateReplaceFunc(op.tx, entity, replColumns, excludeColumns)
-		if err != nil {
-			return false, err
-		}
-		return reflect.ValueOf(bvalue).Bool(), nil
-	}
-	return modelMeta.updateReplaceFunc(op.DB(), entity, replColumns, excludeColumns)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.updateReplaceFunc(ctx, op.executor(), entity, replColumns, excludeColumns)
 }
 
 // UpdateExcludeColumns 更新除columns之外的字段
 func UpdateExcludeColumns(op *Op, entity Entity, columns ...string) (bool, error) {
+	return UpdateExcludeColumnsCtx(op.Context(), op, entity, columns...)
+}
+
+// UpdateExcludeColumnsCtx 使用ctx更新除columns之外的字段
+func UpdateExcludeColumnsCtx(ctx context.Context, op *Op, entity Entity, columns ...string) (bool, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		bvalue, err := modelMeta.updateExcludeColumnsFunc(op.tx, entity, columns...)
-		if err != nil {
-			return false, err
-		}
-		return reflect.ValueOf(bvalue).Bool(), nil
-	}
-	return modelMeta.updateExcludeColumnsFunc(op.DB(), entity, columns...)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.updateExcludeColumnsFunc(ctx, op.executor(), entity, columns...)
 }
 
-// UpdateColumns 更新列
+// UpdateColumns 按条件更新列,实体有autoUpdateTime字段且columns中没有设置该列时同时更新为当前时间,使用NoAutoUpdateTime可以排除
 func UpdateColumns(op *Op, entity Entity, columns string, condition string, params ...interface{}) (int64, error) {
+	return UpdateColumnsCtx(op.Context(), op, entity, columns, condition, params...)
+}
+
+// UpdateColumnsCtx 使用ctx更新列
+func UpdateColumnsCtx(ctx context.Context, op *Op, entity Entity, columns string, condition string, params ...interface{}) (int64, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.updateColumnsFunc(op.tx, entity, columns, condition, params)
-	}
-	return modelMeta.updateColumnsFunc(op.DB(), entity, columns, condition, params)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.updateColumnsFunc(ctx, op.executor(), entity, columns, condition, params)
 }
 
-// Get 根据ID查询实体
+// Get 根据ID查询实体,不包含软删除的记录
 func Get(op *Op, entity Entity, id interface{}) (Entity, error) {
+	return GetCtx(op.Context(), op, entity, id)
+}
+
+// GetCtx 使用ctx根据ID查询实体
+func GetCtx(ctx context.Context, op *Op, entity Entity, id interface{}) (Entity, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		e, err := modelMeta.getFunc(op.tx, entity, id)
-		if e == nil || err != nil {
-			return nil, err
-		}
-		return e.(Entity), nil
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	e, err := modelMeta.getFunc(ctx, op.readExecutor(ctx), entity, id)
+	if e == nil || err != nil {
+		return nil, err
 	}
-	return modelMeta.getFunc(op.DB(), entity, id)
+	return e, nil
 }
 
-// Query 根据条件查询实体
+// Query 根据条件查询实体,不包含软删除的记录
 func Query(op *Op, entity Entity, condition string, params ...interface{}) ([]Entity, error) {
+	return QueryCtx(op.Context(), op, entity, condition, params...)
+}
+
+// QueryCtx 使用ctx根据条件查询实体
+func QueryCtx(ctx context.Context, op *Op, entity Entity, condition string, params ...interface{}) ([]Entity, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.entityQueryFunc(op.tx, entity, condition, params)
-	}
-	return modelMeta.entityQueryFunc(op.DB(), entity, condition, params)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.entityQueryFunc(ctx, op.readExecutor(ctx), entity, condition, params)
 }
 
 // QueryColumns 根据条件查询columns指定的字段
 func QueryColumns(op *Op, entity Entity, columns []string, condition string, params ...interface{}) ([]Entity, error) {
+	return QueryColumnsCtx(op.Context(), op, entity, columns, condition, params...)
+}
+
+// QueryColumnsCtx 使用ctx根据条件查询columns指定的字段
+func QueryColumnsCtx(ctx context.Context, op *Op, entity Entity, columns []string, condition string, params ...interface{}) ([]Entity, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.entityQueryColumnFunc(op.tx, entity, columns, condition, params)
-	}
-	return modelMeta.entityQueryColumnFunc(op.DB(), entity, columns, condition, params)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.entityQueryColumnFunc(ctx, op.readExecutor(ctx), entity, columns, condition, params)
 }
 
 type count struct {
 	Count int64
 }
 
-// QueryCount 根据条件查询条数
+// QueryCount 根据条件查询条数,不包含软删除的记录
 func QueryCount(op *Op, entity Entity, column string, condition string, params ...interface{}) (num int64, err error) {
-	modelMeta := findEntityMeta(entity)
+	return QueryCountCtx(op.Context(), op, entity, column, condition, params...)
+}
+
+// QueryCountCtx 使用ctx根据条件查询条数
+func QueryCountCtx(ctx context.Context, op *Op, entity Entity, column string, condition string, params ...interface{}) (num int64, err error) {
 	columns := []string{"count(" + column + ")"}
 	var counts []*count
-	if op.tx != nil {
-		err = modelMeta.clumnsQueryFunc(op.tx, entity, &counts, columns, condition, params)
-	} else {
-		err = modelMeta.clumnsQueryFunc(op.DB(), entity, &counts, columns, condition, params)
-	}
-	if err != nil {
+	if err = QueryColumnsForDestSliceCtx(ctx, op, entity, &counts, columns, condition, params...); err != nil {
 		return
 	}
 	if len(counts) > 0 {
@@ -292,41 +577,110 @@ func QueryCount(op *Op, entity Entity, column string, condition string, params .
 
 // QueryColumnsForDestSlice 根据条件查询数据,结果保存到destSlicePtr
 func QueryColumnsForDestSlice(op *Op, entity Entity, destSlicePtr interface{}, columns []string, condition string, params ...interface{}) (err error) {
+	return QueryColumnsForDestSliceCtx(op.Context(), op, entity, destSlicePtr, columns, condition, params...)
+}
+
+// QueryColumnsForDestSliceCtx 使用ctx根据条件查询数据,结果保存到destSlicePtr
+func QueryColumnsForDestSliceCtx(ctx context.Context, op *Op, entity Entity, destSlicePtr interface{}, columns []string, condition string, params ...interface{}) (err error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		err = modelMeta.clumnsQueryFunc(op.tx, entity, destSlicePtr, columns, condition, params)
-	} else {
-		err = modelMeta.clumnsQueryFunc(op.DB(), entity, destSlicePtr, columns, condition, params)
-	}
-	if err != nil {
-		return
-	}
-	return
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.clumnsQueryFunc(ctx, op.readExecutor(ctx), entity, destSlicePtr, columns, condition, params)
 }
 
-// Del 根据ID删除实体
+// Del 根据ID删除实体,实体有软删除字段时为软删除,同时更新乐观锁的版本号及autoUpdateTime字段
 func Del(op *Op, entity Entity, id interface{}) (bool, error) {
+	return DelCtx(op.Context(), op, entity, id)
+}
+
+// DelCtx 使用ctx根据ID删除实体
+func DelCtx(ctx context.Context, op *Op, entity Entity, id interface{}) (bool, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.delEFunc(op.tx, entity, id)
-	}
-	return modelMeta.delEFunc(op.DB(), entity, id)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.delEFunc(ctx, op.executor(), entity, id)
 }
 
-// DelByCondition 根据条件删除
+// DelByCondition 根据条件删除,实体有软删除字段时为软删除
 func DelByCondition(op *Op, entity Entity, condition string, params ...interface{}) (int64, error) {
+	return DelByConditionCtx(op.Context(), op, entity, condition, params...)
+}
+
+// DelByConditionCtx 使用ctx根据条件删除
+func DelByConditionCtx(ctx context.Context, op *Op, entity Entity, condition string, params ...interface{}) (int64, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.delFunc(op.tx, entity, condition, params)
-	}
-	return modelMeta.delFunc(op.DB(), entity, condition, params)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.delFunc(ctx, op.executor(), entity, condition, params)
+}
+
+// HardDel 根据ID物理删除实体,包括已经软删除的记录
+func HardDel(op *Op, entity Entity, id interface{}) (bool, error) {
+	return HardDelCtx(op.Context(), op, entity, id)
+}
+
+// HardDelCtx 使用ctx根据ID物理删除实体
+func HardDelCtx(ctx context.Context, op *Op, entity Entity, id interface{}) (bool, error) {
+	return DelCtx(Unscoped(ctx), op, entity, id)
 }
 
-// AddOrUpdate 添加或者更新实体(如果id已经存在),只支持MySql
+// HardDelByCondition 根据条件物理删除,包括已经软删除的记录
+func HardDelByCondition(op *Op, entity Entity, condition string, params ...interface{}) (int64, error) {
+	return HardDelByConditionCtx(op.Context(), op, entity, condition, params...)
+}
+
+// HardDelByConditionCtx 使用ctx根据条件物理删除
+func HardDelByConditionCtx(ctx context.Context, op *Op, entity Entity, condition string, params ...interface{}) (int64, error) {
+	return DelByConditionCtx(Unscoped(ctx), op, entity, condition, params...)
+}
+
+// Restore 根据ID恢复软删除的实体
+func Restore(op *Op, entity Entity, id interface{}) (bool, error) {
+	return RestoreCtx(op.Context(), op, entity, id)
+}
+
+// RestoreCtx 使用ctx根据ID恢复软删除的实体
+func RestoreCtx(ctx context.Context, op *Op, entity Entity, id interface{}) (bool, error) {
+	modelMeta := findEntityMeta(entity)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.restoreFunc(ctx, op.executor(), entity, id)
+}
+
+// AddOrUpdate 添加或者更新实体(如果id已经存在),主键不是自增时按主键判断冲突,否则按第一个unique索引判断,
+// mysql在任何唯一键冲突时都会更新;postgres及sqlite在没有可用的唯一键时返回错误.
+// 更新时不检查乐观锁的版本,版本号在原有的值上加1
 func AddOrUpdate(op *Op, entity Entity) (int64, error) {
+	return AddOrUpdateCtx(op.Context(), op, entity)
+}
+
+// AddOrUpdateCtx 使用ctx添加或者更新实体(如果id已经存在)
+func AddOrUpdateCtx(ctx context.Context, op *Op, entity Entity) (int64, error) {
 	modelMeta := findEntityMeta(entity)
-	if op.tx != nil {
-		return modelMeta.insertOrUpdateFunc(op.tx, entity)
-	}
-	return modelMeta.insertOrUpdateFunc(op.DB(), entity)
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	return modelMeta.insertOrUpdateFunc(ctx, op.executor(), entity)
+}
+
+// AddBatch 批量添加实体,entities必须是同一类型;按表名分组,并按BatchOptions拆分为多条多行INSERT语句,
+// 拆分为多条语句且op不在事务中时,在新的事务中执行.自增主键会回填到实体中,mysql要求auto_increment_increment为1
+func AddBatch(op *Op, entities []Entity) error {
+	return AddBatchCtx(op.Context(), op, entities)
+}
+
+// AddBatchCtx 使用ctx批量添加实体
+func AddBatchCtx(ctx context.Context, op *Op, entities []Entity) error {
+	_, err := addBatch(ctx, op, entities, false)
+	return err
+}
+
+// AddOrUpdateBatch 批量添加或者更新实体(如果id已经存在),返回影响的记录数,自增主键不会回填;
+// 拆分为多条语句且op不在事务中时,在新的事务中执行
+func AddOrUpdateBatch(op *Op, entities []Entity) (int64, error) {
+	return AddOrUpdateBatchCtx(op.Context(), op, entities)
+}
+
+// AddOrUpdateBatchCtx 使用ctx批量添加或者更新实体
+func AddOrUpdateBatchCtx(ctx context.Context, op *Op, entities []Entity) (int64, error) {
+	return addBatch(ctx, op, entities, true)
 }
@@ -1,11 +1,13 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 // ReplColumn  replace column
@@ -14,18 +16,19 @@ type ReplColumn struct {
 	ParamVal interface{}
 }
 
-type entityInsertFunc func(executor interface{}, entity Entity) error
-type entityUpdateFunc func(executor interface{}, entity Entity) (bool, error)
-type entityUpdateReplaceColumnsFunc func(executor interface{}, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error)
-type entityUpdateExcludeColumnsFunc func(executor interface{}, entity Entity, columns ...string) (bool, error)
-type entityUpdateColumnFunc func(executor interface{}, entity Entity, columns string, contition string, params []interface{}) (int64, error)
-type entityQueryFunc func(executor interface{}, entity Entity, condition string, params []interface{}) ([]Entity, error)
-type entityQueryColumnFunc func(executor interface{}, entity Entity, columns []string, condition string, params []interface{}) ([]Entity, error)
-type queryColumnsFunc func(executor interface{}, entity Entity, destStruct interface{}, columns []string, condition string, params []interface{}) error
-type entityGetFunc func(executor interface{}, entity Entity, id interface{}) (Entity, error)
-type entityDeleteFunc func(executor interface{}, entity Entity, condition string, params []interface{}) (int64, error)
-type entityDeleteByIDFunc func(executor interface{}, entity Entity, id interface{}) (bool, error)
-type entityInsertOrUpdateFunc func(executor interface{}, entity Entity) (int64, error)
+type entityInsertFunc func(ctx context.Context, executor *sqlExecutor, entity Entity) error
+type entityUpdateFunc func(ctx context.Context, executor *sqlExecutor, entity Entity) (bool, error)
+type entityUpdateReplaceColumnsFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error)
+type entityUpdateExcludeColumnsFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, columns ...string) (bool, error)
+type entityUpdateColumnFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, columns string, contition string, params []interface{}) (int64, error)
+type entityQueryFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}) ([]Entity, error)
+type entityIterateFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}, f func(Entity) error) error
+type entityQueryColumnFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, columns []string, condition string, params []interface{}) ([]Entity, error)
+type queryColumnsFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, destStruct interface{}, columns []string, condition string, params []interface{}) error
+type entityGetFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (Entity, error)
+type entityDeleteFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}) (int64, error)
+type entityDeleteByIDFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (bool, error)
+type entityInsertOrUpdateFunc func(ctx context.Context, executor *sqlExecutor, entity Entity) (int64, error)
 
 func toSlice(s string, count int) []string {
 	slice := make([]string, 0, count)
@@ -51,8 +54,101 @@ var noIDPred = func(field *metaField) bool {
 	return true
 }
 
+// 除了主键和乐观锁版本的过滤函数
+var noIDVersionPred = func(field *metaField) bool {
+	return noIDPred(field) && !field.version
+}
+
+// 主键冲突时更新的字段,不包括主键,乐观锁版本及创建时间
+var upsertUpdatePred = func(field *metaField) bool {
+	return noIDVersionPred(field) && !field.autoCreate
+}
+
+// upsertConflictColumns 插入时判断冲突的唯一键:主键不是自增时使用主键,否则使用第一个unique索引的列;
+// 自增主键不在插入的列中,不会发生冲突
+func upsertConflictColumns(modelInfo *meta) []string {
+	if !modelInfo.pkField.pkAuto {
+		return []string{modelInfo.pkField.column}
+	}
+	var (
+		name    string
+		columns []string
+	)
+	for _, field := range modelInfo.fields {
+		unique := field.schema.unique
+		if unique == "" {
+			continue
+		}
+		if strings.ToLower(unique) == "y" {
+			unique = "uk_" + field.column
+		}
+		if name == "" {
+			name = unique
+		}
+		if unique == name {
+			columns = append(columns, field.column)
+		}
+	}
+	return columns
+}
+
+// upsertAssignments 冲突时更新columns的赋值语句,value为列的值
+func upsertAssignments(executor *sqlExecutor, columns []string, value func(column string) string) []string {
+	assignments := make([]string, 0, len(columns))
+	for _, column := range columns {
+		assignments = append(assignments, executor.quote(column)+"="+value(column))
+	}
+	return assignments
+}
+
+func upsertParam(column string) string {
+	return "?"
+}
+
+// upsertSetVersion 使用乐观锁时冲突的行的版本号在原有的值上加1,postgres需要使用表名区分原有的行与待插入的行
+func upsertSetVersion(modelInfo *meta, executor *sqlExecutor, tname string, assignments []string) []string {
+	if field := modelInfo.versionField; field != nil {
+		column := executor.quote(field.column)
+		assignments = append(assignments, column+"="+tname+"."+column+"+1")
+	}
+	return assignments
+}
+
+// sqlRunner sql.DB和sql.Tx执行语句的公共接口
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sqlExecutor 执行语句的对象,runner为sql.DB或者sql.Tx
+type sqlExecutor struct {
+	runner  sqlRunner
+	dialect Dialect
+	pool    *Pool //为nil时不使用拦截器
+	op      *Op   //事务中执行语句的Op,用于回滚时恢复实体的版本号
+}
+
+// quote 为标识符加上方言的引号
+func (p *sqlExecutor) quote(identifier string) string {
+	return p.dialect.Quote(identifier)
+}
+
+// columns 字段对应的列,以逗号分隔
+func (p *sqlExecutor) columns(fields []*metaField) string {
+	return buildColumns(func(field *metaField) string {
+		return p.quote(field.column)
+	}, fields)
+}
+
+// setColumns 字段对应的更新语句,如col1=?,col2=?
+func (p *sqlExecutor) setColumns(fields []*metaField) string {
+	return buildColumns(func(field *metaField) string {
+		return p.quote(field.column) + "=?"
+	}, fields)
+}
+
 // 检查实体参数
-func checkEntity(modelInfo *meta, entity Entity, tx interface{}) (ind reflect.Value) {
+func checkEntity(modelInfo *meta, entity Entity, executor *sqlExecutor) (ind reflect.Value) {
 	val, ind, typ := extract(entity)
 	if val.Kind() != reflect.Ptr {
 		panic(NewDBErrorf(nil, "Expect ptr ,but it's %s,type:%s", val.Kind(), typ))
@@ -60,39 +156,63 @@ func checkEntity(modelInfo *meta, entity Entity, tx interface{}) (ind reflect.Va
 	if typ != modelInfo.modelType {
 		panic(NewDBErrorf(nil, "Not same model type %v and %v", typ, modelInfo.modelType))
 	}
-	if tx == nil {
+	if executor == nil || executor.runner == nil {
 		panic(NewDBError(nil, "Not in Trans"))
 	}
 	return
 }
 
-func exec(executor interface{}, execSQL string, args []interface{}) (rs sql.Result, err error) {
-	if tx, ok := executor.(*sql.Tx); ok {
-		rs, err = tx.Exec(execSQL, args...)
-	} else if db, ok := executor.(*sql.DB); ok {
-		rs, err = db.Exec(execSQL, args...)
-	} else {
-		panic(NewDBErrorf(nil, "Not a valid executor:%T", executor))
+// interceptorChain 执行语句使用的拦截器
+func (p *sqlExecutor) interceptorChain() []Interceptor {
+	if p.pool == nil {
+		return nil
 	}
-	return
+	return p.pool.interceptorChain()
 }
 
-func query(executor interface{}, execSQL string, args []interface{}) (rows *sql.Rows, err error) {
-	if tx, ok := executor.(*sql.Tx); ok {
-		rows, err = tx.Query(execSQL, args...)
-	} else if db, ok := executor.(*sql.DB); ok {
-		rows, err = db.Query(execSQL, args...)
-	} else {
-		panic(NewDBErrorf(nil, "Not a valid executor:%T", executor))
+// newStmt 创建拦截器使用的语句信息
+func (p *sqlExecutor) newStmt(kind StmtKind, execSQL string, args []interface{}) *Stmt {
+	return &Stmt{Pool: p.pool.name, Table: stmtTable(execSQL), Kind: kind, SQL: execSQL, Args: args}
+}
+
+func exec(ctx context.Context, executor *sqlExecutor, execSQL string, args []interface{}) (rs sql.Result, err error) {
+	chain := executor.interceptorChain()
+	if len(chain) == 0 {
+		return executor.runner.ExecContext(ctx, executor.dialect.Rebind(execSQL), args...)
+	}
+	stmt := executor.newStmt(StmtExec, execSQL, args)
+	ctx = beforeStmt(ctx, chain, stmt)
+	rs, err = executor.runner.ExecContext(ctx, executor.dialect.Rebind(stmt.SQL), stmt.Args...)
+	if err == nil {
+		stmt.Rows, _ = rs.RowsAffected()
 	}
+	afterStmt(ctx, chain, stmt, err)
 	return
 }
 
+func query(ctx context.Context, executor *sqlExecutor, execSQL string, args []interface{}) (*stmtRows, error) {
+	chain := executor.interceptorChain()
+	if len(chain) == 0 {
+		rows, err := executor.runner.QueryContext(ctx, executor.dialect.Rebind(execSQL), args...)
+		if err != nil {
+			return nil, err
+		}
+		return &stmtRows{Rows: rows}, nil
+	}
+	stmt := executor.newStmt(StmtQuery, execSQL, args)
+	ctx = beforeStmt(ctx, chain, stmt)
+	rows, err := executor.runner.QueryContext(ctx, executor.dialect.Rebind(stmt.SQL), stmt.Args...)
+	if err != nil {
+		afterStmt(ctx, chain, stmt, err)
+		return nil, err
+	}
+	return &stmtRows{Rows: rows, ctx: ctx, chain: chain, stmt: stmt}, nil
+}
+
 func buildParamValues(ind reflect.Value, fields []*metaField) []interface{} {
 	paramValues := make([]interface{}, 0, len(fields))
 	for _, field := range fields {
-		fv := ind.FieldByIndex(field.index).Interface()
-		paramValues = append(paramValues, fv)
+		paramValues = append(paramValues, fieldParam(ind, field))
 	}
 	return paramValues
 }
@@ -100,75 +220,112 @@ func buildParamValues(ind reflect.Value, fields []*metaField) []interface{} {
 // 构建实体模型的插入函数
 func createInsertFunc(modelInfo *meta) entityInsertFunc {
 	insertFields := filterFields(exceptIDPred, modelInfo.fields)
-	columns := buildColumns(func(field *metaField) string {
-		return field.column
-	}, insertFields)
 	params := strings.Join(toSlice("?", len(insertFields)), ",")
 
-	return func(executor interface{}, entity Entity) error {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity) error {
 		ind := checkEntity(modelInfo, entity, executor)
+		if err := modelInfo.beforeInsert(ctx, entity); err != nil {
+			return err
+		}
+		if err := modelInfo.fillID(ctx, ind); err != nil {
+			return err
+		}
+		modelInfo.fillInsertTime(ind)
 		paramValues := buildParamValues(ind, insertFields)
 		tname, err := tblName(entity)
 		if err != nil {
 			return err
 		}
-		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES(%s)", tname, columns, params)
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES(%s)", tname, executor.columns(insertFields), params)
 
-		rs, err := exec(executor, insertSQL, paramValues)
+		if modelInfo.pkField.pkAuto {
+			if returning := executor.dialect.Returning(modelInfo.pkField.column); returning != "" {
+				id, err := insertReturningID(ctx, executor, insertSQL+returning, paramValues)
+				if err != nil {
+					return err
+				}
+				setAutoID(ind.FieldByIndex(modelInfo.pkField.index), id)
+				return modelInfo.afterInsert(ctx, entity)
+			}
+		}
+
+		rs, err := exec(ctx, executor, insertSQL, paramValues)
 		if err != nil {
 			return err
 		}
 
 		if modelInfo.pkField.pkAuto {
 			if id, err := rs.LastInsertId(); err == nil {
-				ind.FieldByIndex(modelInfo.pkField.index).SetInt(id)
+				setAutoID(ind.FieldByIndex(modelInfo.pkField.index), id)
 			} else {
 				return err
 			}
 		}
-		return nil
+		return modelInfo.afterInsert(ctx, entity)
+	}
+}
+
+// setAutoID 回填自增主键,主键可以是有符号或者无符号的整数
+func setAutoID(fv reflect.Value, id int64) {
+	if fv.CanUint() {
+		fv.SetUint(uint64(id))
+	} else {
+		fv.SetInt(id)
 	}
 }
 
+// insertReturningID 执行带有RETURNING的插入语句,返回自增主键
+func insertReturningID(ctx context.Context, executor *sqlExecutor, insertSQL string, args []interface{}) (id int64, err error) {
+	rows, err := query(ctx, executor, insertSQL, args)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+	if err = rows.Scan(&id); err != nil {
+		return
+	}
+	err = rows.Err()
+	return
+}
+
 // 构建实体模型的更新函数
 func createUpdateFunc(modelInfo *meta) entityUpdateFunc {
-	updateFields := filterFields(noIDPred, modelInfo.fields)
-	columns := buildColumns(func(field *metaField) string {
-		return field.column + "=?"
-	}, updateFields)
+	updateFields := filterFields(noIDVersionPred, modelInfo.fields)
 
-	return func(executor interface{}, entity Entity) (bool, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity) (bool, error) {
 		ind := checkEntity(modelInfo, entity, executor)
-		id := ind.FieldByIndex(modelInfo.pkField.index).Interface()
+		if err := modelInfo.beforeUpdate(ctx, entity); err != nil {
+			return false, err
+		}
+		modelInfo.fillUpdateTime(ind)
+		where, whereParams := updateWhere(ctx, modelInfo, executor, ind)
 		paramValues := buildParamValues(ind, updateFields)
-		paramValues = append(paramValues, id)
+		paramValues = append(paramValues, whereParams...)
 
 		tname, err := tblName(entity)
 		if err != nil {
 			return false, err
 		}
 
-		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s = %s", tname, columns, modelInfo.pkField.column, "?")
-		rs, err := exec(executor, updateSQL, paramValues)
+		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s", tname, updateSetVersion(modelInfo, executor, executor.setColumns(updateFields)), where)
+		rs, err := exec(ctx, executor, updateSQL, paramValues)
 		if err != nil {
 			return false, err
 		}
-		//检查更新的记录数
-		rows, err := rs.RowsAffected()
-		if err == nil {
-			if rows != 1 {
-				return false, nil
-			}
-			return true, nil
-		}
-		return false, err
+		return checkUpdated(executor, modelInfo, ind, rs)
 	}
 }
 
 func createUpdateExcludeColmnsFunc(modelInfo *meta) entityUpdateExcludeColumnsFunc {
-	fields := filterFields(noIDPred, modelInfo.fields)
+	fields := filterFields(noIDVersionPred, modelInfo.fields)
 
-	return func(executor interface{}, entity Entity, excludeColumns ...string) (bool, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, excludeColumns ...string) (bool, error) {
 		updateFields := fields
 		if len(excludeColumns) > 0 {
 			var excludeColumnsMap = map[string]struct{}{}
@@ -190,40 +347,32 @@ func createUpdateExcludeColmnsFunc(modelInfo *meta) entityUpdateExcludeColumnsFu
 			}
 		}
 
-		columns := buildColumns(func(field *metaField) string {
-			return field.column + "=?"
-		}, updateFields)
-
 		ind := checkEntity(modelInfo, entity, executor)
-		id := ind.FieldByIndex(modelInfo.pkField.index).Interface()
+		if err := modelInfo.beforeUpdate(ctx, entity); err != nil {
+			return false, err
+		}
+		modelInfo.fillUpdateTime(ind)
+		where, whereParams := updateWhere(ctx, modelInfo, executor, ind)
 		paramValues := buildParamValues(ind, updateFields)
-		paramValues = append(paramValues, id)
+		paramValues = append(paramValues, whereParams...)
 
 		tname, err := tblName(entity)
 		if err != nil {
 			return false, err
 		}
 
-		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s = %s", tname, columns, modelInfo.pkField.column, "?")
-		rs, err := exec(executor, updateSQL, paramValues)
+		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s", tname, updateSetVersion(modelInfo, executor, executor.setColumns(updateFields)), where)
+		rs, err := exec(ctx, executor, updateSQL, paramValues)
 		if err != nil {
 			return false, err
 		}
-		//检查更新的记录数
-		rows, err := rs.RowsAffected()
-		if err == nil {
-			if rows != 1 {
-				return false, nil
-			}
-			return true, nil
-		}
-		return false, err
+		return checkUpdated(executor, modelInfo, ind, rs)
 	}
 }
 
 // 构建实体模型的指定类名的更新函数
 func createUpdateColumnsFunc(modelInfo *meta) entityUpdateColumnFunc {
-	return func(executor interface{}, entity Entity, columns string, condition string, params []interface{}) (int64, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, columns string, condition string, params []interface{}) (int64, error) {
 		checkEntity(modelInfo, entity, executor)
 		if len(columns) == 0 {
 			panic(NewDBError(nil, "Can't update empty columns"))
@@ -233,13 +382,14 @@ func createUpdateColumnsFunc(modelInfo *meta) entityUpdateColumnFunc {
 		if err != nil {
 			return 0, err
 		}
+		columns, params = modelInfo.bumpUpdateTime(ctx, executor, columns, params)
 		updateSQL := fmt.Sprintf("UPDATE %s SET %s ", tname, columns)
 		if len(condition) > 0 {
 			updateSQL += condition
 
 		}
 
-		rs, err := exec(executor, updateSQL, params)
+		rs, err := exec(ctx, executor, updateSQL, params)
 		if err != nil {
 			return 0, err
 		}
@@ -253,46 +403,59 @@ func createUpdateColumnsFunc(modelInfo *meta) entityUpdateColumnFunc {
 	}
 }
 
-// 构建查询函数
-func createQueryFunc(modelInfo *meta) entityQueryFunc {
-	columns := buildColumns(func(field *metaField) string {
-		return "`" + field.column + "`"
-	}, modelInfo.fields)
-
-	return func(executor interface{}, entity Entity, condition string, params []interface{}) ([]Entity, error) {
+// 构建逐行遍历的查询函数
+func createIterateFunc(modelInfo *meta) entityIterateFunc {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}, f func(Entity) error) error {
 		ind := checkEntity(modelInfo, entity, executor)
 		tname, err := tblName(entity)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		querySQL := fmt.Sprintf("SELECT %s FROM %s ", columns, tname)
+		querySQL := fmt.Sprintf("SELECT %s FROM %s ", executor.columns(modelInfo.fields), tname)
+		condition = modelInfo.scope(ctx, executor, condition)
 		if len(condition) > 0 {
 			querySQL += condition
 		}
 
-		rows, err := query(executor, querySQL, params)
+		rows, err := query(ctx, executor, querySQL, params)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		defer rows.Close()
 
-		var rt = make([]Entity, 0, 10)
 		for rows.Next() {
 			ptrValue := reflect.New(ind.Type())
 			ptrValueInd := reflect.Indirect(ptrValue)
 			ptrValueSlice := make([]interface{}, 0, len(modelInfo.fields))
 			for _, field := range modelInfo.fields {
-				fv := ptrValueInd.FieldByIndex(field.index).Addr().Interface()
+				fv := fieldDest(ptrValueInd, field)
 				ptrValueSlice = append(ptrValueSlice, fv)
 			}
-			if err := rows.Scan(ptrValueSlice...); err == nil {
-				rt = append(rt, ptrValue.Interface().(Entity))
-			} else {
-				return nil, err
+			if err := rows.Scan(ptrValueSlice...); err != nil {
+				return err
+			}
+			loaded := ptrValue.Interface().(Entity)
+			if err := modelInfo.afterLoad(ctx, loaded); err != nil {
+				return err
+			}
+			if err := f(loaded); err != nil {
+				return err
 			}
 		}
-		if err := rows.Err(); err != nil {
+		return rows.Err()
+	}
+}
+
+// 构建查询函数
+func createQueryFunc(modelInfo *meta) entityQueryFunc {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}) ([]Entity, error) {
+		var rt = make([]Entity, 0, 10)
+		err := modelInfo.iterateFunc(ctx, executor, entity, condition, params, func(loaded Entity) error {
+			rt = append(rt, loaded)
+			return nil
+		})
+		if err != nil {
 			return nil, err
 		}
 		return rt, nil
@@ -301,7 +464,7 @@ func createQueryFunc(modelInfo *meta) entityQueryFunc {
 
 // 构建查询函数
 func createQueryColumnFunc(modelInfo *meta) entityQueryColumnFunc {
-	return func(executor interface{}, entity Entity, columns []string, condition string, params []interface{}) ([]Entity, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, columns []string, condition string, params []interface{}) ([]Entity, error) {
 		ind := checkEntity(modelInfo, entity, executor)
 		fields := make([]*metaField, 0, len(columns))
 		for _, column := range columns {
@@ -316,11 +479,12 @@ func createQueryColumnFunc(modelInfo *meta) entityQueryColumnFunc {
 		}
 
 		querySQL := fmt.Sprintf("SELECT %s FROM %s ", strings.Join(columns, ","), tname)
+		condition = modelInfo.scope(ctx, executor, condition)
 		if len(condition) > 0 {
 			querySQL += condition
 		}
 
-		rows, err := query(executor, querySQL, params)
+		rows, err := query(ctx, executor, querySQL, params)
 		if err != nil {
 			return nil, err
 		}
@@ -332,15 +496,18 @@ func createQueryColumnFunc(modelInfo *meta) entityQueryColumnFunc {
 			ptrValueInd := reflect.Indirect(ptrValue)
 			ptrValueSlice := make([]interface{}, 0, len(modelInfo.fields))
 			for _, field := range fields {
-				fv := ptrValueInd.FieldByIndex(field.index).Addr().Interface()
+				fv := fieldDest(ptrValueInd, field)
 				ptrValueSlice = append(ptrValueSlice, fv)
 			}
 
-			if err := rows.Scan(ptrValueSlice...); err == nil {
-				rt = append(rt, ptrValue.Interface().(Entity))
-			} else {
+			if err := rows.Scan(ptrValueSlice...); err != nil {
 				return nil, err
 			}
+			loaded := ptrValue.Interface().(Entity)
+			if err := modelInfo.afterLoad(ctx, loaded); err != nil {
+				return nil, err
+			}
+			rt = append(rt, loaded)
 		}
 		if err := rows.Err(); err != nil {
 			return nil, err
@@ -351,7 +518,7 @@ func createQueryColumnFunc(modelInfo *meta) entityQueryColumnFunc {
 
 // 构建查询函数
 func createQueryColumnsFunc(modelInfo *meta) queryColumnsFunc {
-	return func(executor interface{}, entity Entity, destStructs interface{}, columns []string, condition string, params []interface{}) error {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, destStructs interface{}, columns []string, condition string, params []interface{}) error {
 		if destStructs == nil {
 			return errors.New("dest must not be nil")
 		}
@@ -382,11 +549,12 @@ func createQueryColumnsFunc(modelInfo *meta) queryColumnsFunc {
 		}
 
 		querySQL := fmt.Sprintf("SELECT %s FROM %s ", strings.Join(columns, ","), tname)
+		condition = modelInfo.scope(ctx, executor, condition)
 		if len(condition) > 0 {
 			querySQL += condition
 		}
 
-		rows, err := query(executor, querySQL, params)
+		rows, err := query(ctx, executor, querySQL, params)
 		if err != nil {
 			return err
 		}
@@ -417,18 +585,29 @@ func createQueryColumnsFunc(modelInfo *meta) queryColumnsFunc {
 
 // 构建删除函数
 func createDelFunc(modelInfo *meta) entityDeleteFunc {
-	return func(executor interface{}, entity Entity, condition string, params []interface{}) (int64, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, condition string, params []interface{}) (int64, error) {
 		checkEntity(modelInfo, entity, executor)
+		if err := modelInfo.beforeDelete(ctx, entity); err != nil {
+			return 0, err
+		}
 		tname, err := tblName(entity)
 		if err != nil {
 			return 0, err
 		}
 		delSQL := fmt.Sprintf("DELETE FROM %s ", tname)
+		if field := modelInfo.softDeleteField; field != nil && !isUnscoped(ctx) {
+			// 软删除,同时更新乐观锁的版本号及更新时间
+			columns := executor.quote(field.column) + "=?"
+			params = append([]interface{}{field.deletedValue(time.Now())}, params...)
+			columns, params = modelInfo.bumpUpdateTime(ctx, executor, columns, params)
+			delSQL = fmt.Sprintf("UPDATE %s SET %s ", tname, updateSetVersion(modelInfo, executor, columns))
+			condition = modelInfo.scope(ctx, executor, condition)
+		}
 		if len(condition) > 0 {
 			delSQL += condition
 		}
 
-		rs, err := exec(executor, delSQL, params)
+		rs, err := exec(ctx, executor, delSQL, params)
 		if err != nil {
 			return 0, err
 		}
@@ -443,19 +622,25 @@ func createDelFunc(modelInfo *meta) entityDeleteFunc {
 
 func createInsertOrUpdateFunc(modelInfo *meta) entityInsertOrUpdateFunc {
 	insertFields := filterFields(exceptIDPred, modelInfo.fields)
-	columns := buildColumns(func(field *metaField) string {
-		return field.column
-	}, insertFields)
-
 	insertParams := strings.Join(toSlice("?", len(insertFields)), ",")
 
-	updateFields := filterFields(noIDPred, modelInfo.fields)
-	updateColumns := buildColumns(func(field *metaField) string {
-		return field.column + "=?"
-	}, updateFields)
+	updateFields := filterFields(upsertUpdatePred, modelInfo.fields)
+	updateColumns := make([]string, 0, len(updateFields))
+	for _, field := range updateFields {
+		updateColumns = append(updateColumns, field.column)
+	}
+	conflictColumns := upsertConflictColumns(modelInfo)
 
-	return func(executor interface{}, entity Entity) (int64, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity) (int64, error) {
 		ind := checkEntity(modelInfo, entity, executor)
+		if err := modelInfo.beforeInsert(ctx, entity); err != nil {
+			return 0, err
+		}
+		if err := modelInfo.fillID(ctx, ind); err != nil {
+			return 0, err
+		}
+		modelInfo.fillInsertTime(ind)
+		modelInfo.fillUpdateTime(ind)
 		paramValues := buildParamValues(ind, insertFields)
 		updateParamValues := buildParamValues(ind, updateFields)
 		allParamValues := append(paramValues, updateParamValues...)
@@ -463,19 +648,26 @@ func createInsertOrUpdateFunc(modelInfo *meta) entityInsertOrUpdateFunc {
 		if err != nil {
 			return 0, err
 		}
-		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES(%s) ON DUPLICATE KEY UPDATE %s", tname, columns, insertParams, updateColumns)
+		upsert, err := executor.dialect.Upsert(conflictColumns, upsertSetVersion(modelInfo, executor, tname, upsertAssignments(executor, updateColumns, upsertParam)))
+		if err != nil {
+			return 0, err
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES(%s)", tname, executor.columns(insertFields), insertParams) + upsert
 
-		rs, err := exec(executor, insertSQL, allParamValues)
+		rs, err := exec(ctx, executor, insertSQL, allParamValues)
 		if err != nil {
 			return 0, err
 		}
 
 		//检查更新的记录数
 		rows, err := rs.RowsAffected()
-		if err == nil {
-			return rows, nil
+		if err != nil {
+			return 0, err
 		}
-		return 0, err
+		if err = modelInfo.afterInsert(ctx, entity); err != nil {
+			return rows, err
+		}
+		return rows, nil
 	}
 }
 
@@ -512,17 +704,24 @@ func buildColumns(f func(*metaField) string, fileds []*metaField) (ret string) {
 }
 
 func createUpdateReplaceFunc(modelInfo *meta) entityUpdateReplaceColumnsFunc {
-	updateFields := filterFields(noIDPred, modelInfo.fields)
+	updateFields := filterFields(noIDVersionPred, modelInfo.fields)
 
-	return func(executor interface{}, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error) {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, replColumns map[string]ReplColumn, excludeColumns map[string]struct{}) (bool, error) {
 		for k, v := range replColumns {
 			if v.Repl == "" {
 				return false, fmt.Errorf("empty repl column %s", k)
 			}
+			if modelInfo.versionField != nil && k == modelInfo.versionField.column {
+				return false, fmt.Errorf("can't replace version column %s", k)
+			}
 		}
 
 		ind := checkEntity(modelInfo, entity, executor)
-		id := ind.FieldByIndex(modelInfo.pkField.index).Interface()
+		if err := modelInfo.beforeUpdate(ctx, entity); err != nil {
+			return false, err
+		}
+		modelInfo.fillUpdateTime(ind)
+		where, whereParams := updateWhere(ctx, modelInfo, executor, ind)
 		columns := make([]string, 0, len(updateFields))
 		paramValues := buildParamValues(ind, updateFields)
 
@@ -541,7 +740,7 @@ func createUpdateReplaceFunc(modelInfo *meta) entityUpdateReplaceColumnsFunc {
 				continue
 			}
 			if repl, ok := replColumns[column]; ok {
-				columns = append(columns, column+"="+repl.Repl)
+				columns = append(columns, executor.quote(column)+"="+repl.Repl)
 				if strings.Contains(repl.Repl, "?") {
 					paramValues[i] = repl.ParamVal
 				} else {
@@ -549,7 +748,7 @@ func createUpdateReplaceFunc(modelInfo *meta) entityUpdateReplaceColumnsFunc {
 				}
 				replCount++
 			} else {
-				columns = append(columns, column+"=?")
+				columns = append(columns, executor.quote(column)+"=?")
 			}
 		}
 
@@ -567,25 +766,70 @@ func createUpdateReplaceFunc(modelInfo *meta) entityUpdateReplaceColumnsFunc {
 			paramValues = tempParam
 		}
 
-		paramValues = append(paramValues, id)
+		paramValues = append(paramValues, whereParams...)
 		tname, err := tblName(entity)
 		if err != nil {
 			return false, err
 		}
 
-		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s = %s", tname, strings.Join(columns, ","), modelInfo.pkField.column, "?")
-		rs, err := exec(executor, updateSQL, paramValues)
+		updateSQL := fmt.Sprintf("UPDATE %s SET %s where %s", tname, updateSetVersion(modelInfo, executor, strings.Join(columns, ",")), where)
+		rs, err := exec(ctx, executor, updateSQL, paramValues)
 		if err != nil {
 			return false, err
 		}
-		//检查更新的记录数
-		rows, err := rs.RowsAffected()
-		if err == nil {
-			if rows != 1 {
-				return false, nil
-			}
-			return true, nil
+		return checkUpdated(executor, modelInfo, ind, rs)
+	}
+}
+
+// updateSetVersion 使用乐观锁时在SET语句之后追加版本号加1
+func updateSetVersion(modelInfo *meta, executor *sqlExecutor, set string) string {
+	if field := modelInfo.versionField; field != nil {
+		column := executor.quote(field.column)
+		if set != "" {
+			set += ","
 		}
+		set += column + "=" + column + "+1"
+	}
+	return set
+}
+
+// updateWhere 按主键更新的条件,使用乐观锁时加上版本号的条件,使用软删除时排除已删除的记录
+func updateWhere(ctx context.Context, modelInfo *meta, executor *sqlExecutor, ind reflect.Value) (string, []interface{}) {
+	where := executor.quote(modelInfo.pkField.column) + " = ?"
+	params := []interface{}{ind.FieldByIndex(modelInfo.pkField.index).Interface()}
+	if field := modelInfo.versionField; field != nil {
+		where += " AND " + executor.quote(field.column) + " = ?"
+		params = append(params, ind.FieldByIndex(field.index).Interface())
+	}
+	if field := modelInfo.softDeleteField; field != nil && !isUnscoped(ctx) {
+		where += " AND " + field.notDeleted(executor)
+	}
+	return where, params
+}
+
+// checkUpdated 检查按主键更新的记录数,使用乐观锁时没有更新记录返回ErrStaleEntity,更新成功后实体的版本号加1,
+// 在事务中时记录原来的版本号,事务回滚后恢复
+func checkUpdated(executor *sqlExecutor, modelInfo *meta, ind reflect.Value, rs sql.Result) (bool, error) {
+	rows, err := rs.RowsAffected()
+	if err != nil {
 		return false, err
 	}
+	field := modelInfo.versionField
+	if field == nil {
+		return rows == 1, nil
+	}
+	version := ind.FieldByIndex(field.index)
+	if rows == 0 {
+		return false, NewDBErrorf(ErrStaleEntity, "%s id:%v version:%v", modelInfo.name, ind.FieldByIndex(modelInfo.pkField.index).Interface(), version.Interface())
+	}
+	if executor.op != nil {
+		executor.op.saveVersion(version)
+	}
+	switch version.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		version.SetInt(version.Int() + 1)
+	default:
+		version.SetUint(version.Uint() + 1)
+	}
+	return rows == 1, nil
 }
@@ -2,10 +2,13 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
 	c "github.com/d0ngw/go/common"
@@ -68,6 +71,11 @@ var (
 type meta struct {
 	name                     string
 	pkField                  *metaField
+	versionField             *metaField //乐观锁的版本字段
+	softDeleteField          *metaField //软删除的字段
+	createTimeField          *metaField //自动设置创建时间的字段
+	updateTimeField          *metaField //自动设置更新时间的字段
+	hooks                    entityHooks
 	fields                   []*metaField
 	columnFields             map[string]*metaField
 	modelType                reflect.Type
@@ -77,12 +85,17 @@ type meta struct {
 	updateExcludeColumnsFunc entityUpdateExcludeColumnsFunc
 	updateColumnsFunc        entityUpdateColumnFunc
 	entityQueryFunc          entityQueryFunc
+	iterateFunc              entityIterateFunc
 	entityQueryColumnFunc    entityQueryColumnFunc
 	clumnsQueryFunc          queryColumnsFunc
 	getFunc                  entityGetFunc
 	delFunc                  entityDeleteFunc
 	delEFunc                 entityDeleteByIDFunc
 	insertOrUpdateFunc       entityInsertOrUpdateFunc
+	batchRowFunc             entityBatchRowFunc
+	batchInsertFunc          entityBatchInsertFunc
+	restoreFunc              entityRestoreFunc
+	relations                map[string]*metaRelation //关联关系,字段名称->关联
 }
 
 // Name implements Meta.Name
@@ -118,8 +131,27 @@ type metaField struct {
 	column      string              //表列名
 	pk          bool                //是否主键
 	pkAuto      bool                //如果是主键,是否是自增的id
+	pkGen       string              //如果是主键,生成主键的IDGenerator名称
+	version     bool                //是否是乐观锁的版本字段
+	softDelete  bool                //是否是软删除的字段
+	autoCreate  bool                //是否自动设置创建时间
+	autoUpdate  bool                //是否自动设置更新时间
+	assignExpr  *regexp.Regexp      //匹配UPDATE语句中对该列赋值的表达式
 	index       []int               //索引
 	structField reflect.StructField //StructField
+	codec       Codec               //列的编解码器
+	schema      columnSchema        //建表使用的列定义
+}
+
+// columnSchema 由type,size,nullable,index,unique,default等tag定义的列信息,用于生成建表语句
+type columnSchema struct {
+	sqlType    string //列的类型,为空时根据字段类型推断
+	size       int    //列的长度,用于字符串类型
+	nullable   string //是否允许为NULL,y/n,为空时根据字段类型推断
+	index      string //索引名称,相同名称的列组成联合索引
+	unique     string //唯一索引名称,相同名称的列组成联合唯一索引
+	defaultVal string //默认值,原样拼接到DEFAULT之后
+	hasDefault bool   //是否有默认值
 }
 
 func (f *metaField) String() string {
@@ -178,6 +210,7 @@ func (reg *metaReg) regMeta(m *meta) error {
 var (
 	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
 	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	entityType  = reflect.TypeOf((*Entity)(nil)).Elem()
 )
 
 func parseMeta(model Entity) (*meta, error) {
@@ -197,10 +230,11 @@ func parseMeta(model Entity) (*meta, error) {
 
 	fieldCount := ind.NumField()
 	fields := make([]*metaField, 0, fieldCount)
-	mInfo := &meta{name: fullName, modelType: typ}
+	mInfo := &meta{name: fullName, modelType: typ, hooks: parseHooks(typ)}
 	var pkField *metaField
+	var relations []*metaRelation
 
-	fields = parseFields(nil, ind, typ, &pkField, fields)
+	fields = parseFields(nil, ind, typ, &pkField, &relations, fields)
 	if pkField == nil {
 		panic(NewDBErrorf(nil, "Can't find pk column for %s,found fields:%v", typ, fields))
 	} else {
@@ -219,6 +253,39 @@ func parseMeta(model Entity) (*meta, error) {
 		} else {
 			dupColumn[field.column] = struct{}{}
 		}
+		if field.version {
+			if mInfo.versionField != nil {
+				panic(NewDBErrorf(nil, "Duplicate version column for %s.%s and %s", typ, mInfo.versionField.name, field.name))
+			}
+			mInfo.versionField = field
+		}
+		if field.softDelete {
+			if mInfo.softDeleteField != nil {
+				panic(NewDBErrorf(nil, "Duplicate soft delete column for %s.%s and %s", typ, mInfo.softDeleteField.name, field.name))
+			}
+			mInfo.softDeleteField = field
+		}
+		if field.autoCreate {
+			if mInfo.createTimeField != nil {
+				panic(NewDBErrorf(nil, "Duplicate autoCreateTime column for %s.%s and %s", typ, mInfo.createTimeField.name, field.name))
+			}
+			mInfo.createTimeField = field
+		}
+		if field.autoUpdate {
+			if mInfo.updateTimeField != nil {
+				panic(NewDBErrorf(nil, "Duplicate autoUpdateTime column for %s.%s and %s", typ, mInfo.updateTimeField.name, field.name))
+			}
+			mInfo.updateTimeField = field
+		}
+	}
+
+	mInfo.relations = map[string]*metaRelation{}
+	for _, rel := range relations {
+		if _, ok := dupName[rel.name]; ok {
+			panic(fmt.Errorf("Duplicate field name %s", rel.name))
+		}
+		dupName[rel.name] = struct{}{}
+		mInfo.relations[rel.name] = rel
 	}
 
 	mInfo.fields = fields
@@ -227,24 +294,27 @@ func parseMeta(model Entity) (*meta, error) {
 	mInfo.updateReplaceFunc = createUpdateReplaceFunc(mInfo)
 	mInfo.updateExcludeColumnsFunc = createUpdateExcludeColmnsFunc(mInfo)
 	mInfo.updateColumnsFunc = createUpdateColumnsFunc(mInfo)
+	mInfo.iterateFunc = createIterateFunc(mInfo)
 	mInfo.entityQueryFunc = createQueryFunc(mInfo)
 	mInfo.entityQueryColumnFunc = createQueryColumnFunc(mInfo)
 	mInfo.clumnsQueryFunc = createQueryColumnsFunc(mInfo)
 	mInfo.insertOrUpdateFunc = createInsertOrUpdateFunc(mInfo)
+	mInfo.batchRowFunc, mInfo.batchInsertFunc = createBatchFuncs(mInfo)
+	mInfo.restoreFunc = createRestoreFunc(mInfo)
 	mInfo.delFunc = createDelFunc(mInfo)
-	mInfo.getFunc = func(executor interface{}, entity Entity, id interface{}) (e Entity, err error) {
+	mInfo.getFunc = func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (e Entity, err error) {
 		e = nil
 		var l []Entity
-		if l, err = mInfo.entityQueryFunc(executor, entity, " WHERE "+mInfo.pkField.column+" = ?", []interface{}{id}); err == nil {
+		if l, err = mInfo.entityQueryFunc(ctx, executor, entity, " WHERE "+executor.quote(mInfo.pkField.column)+" = ?", []interface{}{id}); err == nil {
 			if len(l) == 1 {
 				e = l[0]
 			}
 		}
 		return
 	}
-	mInfo.delEFunc = func(executor interface{}, entity Entity, id interface{}) (r bool, err error) {
+	mInfo.delEFunc = func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (r bool, err error) {
 		var l int64
-		if l, err = mInfo.delFunc(executor, entity, " WHERE "+mInfo.pkField.column+" = ?", []interface{}{id}); err == nil {
+		if l, err = mInfo.delFunc(ctx, executor, entity, " WHERE "+executor.quote(mInfo.pkField.column)+" = ?", []interface{}{id}); err == nil {
 			if l == 1 {
 				r = true
 			}
@@ -261,28 +331,51 @@ func parseMeta(model Entity) (*meta, error) {
 	return mInfo, nil
 }
 
-func parseFields(index []int, ind reflect.Value, typ reflect.Type, pkField **metaField, fields []*metaField) []*metaField {
+func parseFields(index []int, ind reflect.Value, typ reflect.Type, pkField **metaField, relations *[]*metaRelation, fields []*metaField) []*metaField {
 	for i := 0; i < ind.NumField(); i++ {
 		field := typ.Field(i)
 		if field.PkgPath != "" {
 			continue
 		}
 
+		if relTag, ok := field.Tag.Lookup("rel"); ok {
+			newIndex := make([]int, len(index))
+			copy(newIndex, index)
+			rel, err := parseRelation(append(newIndex, i), field, relTag)
+			if err != nil {
+				panic(NewDBErrorf(err, "Invalid rel tag for %s.%s", typ, field.Name))
+			}
+			*relations = append(*relations, rel)
+			continue
+		}
+
 		stFieldType := field.Type
 		ptrStFieldType := reflect.PtrTo(stFieldType)
 		isScannerAndValuer := (ptrStFieldType.Implements(scannerType) || stFieldType.Implements(scannerType)) && (ptrStFieldType.Implements(valuerType) || stFieldType.Implements(valuerType))
 
+		var codec Codec
+		if codecName := field.Tag.Get("codec"); codecName != "" {
+			if codec = findCodec(codecName); codec == nil {
+				panic(NewDBErrorf(nil, "Can't find codec %s for %s.%s", codecName, typ, field.Name))
+			}
+			if _, ok := codec.(*aesCodec); ok && stFieldType.Kind() != reflect.String && !(stFieldType.Kind() == reflect.Slice && stFieldType.Elem().Kind() == reflect.Uint8) {
+				panic(NewDBErrorf(nil, "aes codec field %s.%s must be string or []byte", typ, field.Name))
+			}
+			// 使用codec编解码的字段可以是任意类型
+			isScannerAndValuer = true
+		}
+
 		if field.Type.Kind() == reflect.Ptr && !isScannerAndValuer {
 			panic(NewDBErrorf(nil, "unsupported field type,%s is poniter,only scanner and valuer can be pointer", field.Name))
 		}
-		if stFieldType.Kind() == reflect.Struct && !isScannerAndValuer {
+		if stFieldType.Kind() == reflect.Struct && !isScannerAndValuer && stFieldType != timeType {
 			if !field.Anonymous {
 				panic(NewDBErrorf(nil, "field %s is struct it must be anonymous", field.Name))
 			}
 
 			newIndex := make([]int, len(index))
 			copy(newIndex, index)
-			fields = parseFields(append(newIndex, i), ind.Field(i), stFieldType, pkField, fields)
+			fields = parseFields(append(newIndex, i), ind.Field(i), stFieldType, pkField, relations, fields)
 			continue
 		}
 
@@ -298,6 +391,33 @@ func parseFields(index []int, ind reflect.Value, typ reflect.Type, pkField **met
 
 		pk := strings.ToLower(tag.Get("pk"))
 		pkAuto := strings.ToLower(tag.Get("pkAuto"))
+		version := strings.ToLower(tag.Get("version")) == "y"
+		if version {
+			switch field.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				panic(NewDBErrorf(nil, "version field %s.%s must be integer", typ, field.Name))
+			}
+			if pk == "y" {
+				panic(NewDBErrorf(nil, "version field %s.%s can't be pk", typ, field.Name))
+			}
+		}
+		pkGen := tag.Get("pkGen")
+		if pkGen != "" {
+			if pk != "y" {
+				panic(NewDBErrorf(nil, "pkGen field %s.%s must be pk", typ, field.Name))
+			}
+			switch field.Type.Kind() {
+			case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			default:
+				panic(NewDBErrorf(nil, "pkGen field %s.%s must be int64", typ, field.Name))
+			}
+		}
+		schema, err := parseColumnSchema(tag)
+		if err != nil {
+			panic(NewDBErrorf(err, "Invalid schema tag for %s.%s", typ, field.Name))
+		}
 
 		newIndex := make([]int, len(index))
 		copy(newIndex, index)
@@ -306,9 +426,35 @@ func parseFields(index []int, ind reflect.Value, typ reflect.Type, pkField **met
 			name:        field.Name,
 			column:      column,
 			pk:          pk == "y",
-			pkAuto:      pk == "y" && !(pkAuto == "n"),
+			pkAuto:      pk == "y" && !(pkAuto == "n") && pkGen == "",
+			pkGen:       pkGen,
+			version:     version,
+			softDelete:  strings.ToLower(tag.Get("softDelete")) == "y",
 			index:       fieldIndex,
-			structField: field}
+			structField: field,
+			codec:       codec,
+			schema:      schema}
+		mField.autoCreate = strings.ToLower(tag.Get("autoCreateTime")) == "y"
+		mField.autoUpdate = strings.ToLower(tag.Get("autoUpdateTime")) == "y"
+		if mField.autoCreate || mField.autoUpdate {
+			if mField.pk || mField.version || mField.softDelete || (mField.autoCreate && mField.autoUpdate) {
+				panic(NewDBErrorf(nil, "auto time field %s.%s can't be pk,version,soft delete or both autoCreateTime and autoUpdateTime", typ, field.Name))
+			}
+			if err = checkAutoTimeField(mField); err != nil {
+				panic(NewDBErrorf(err, "Invalid auto time field %s.%s", typ, field.Name))
+			}
+			if mField.autoUpdate {
+				mField.assignExpr = assignExpr(column)
+			}
+		}
+		if mField.softDelete {
+			if mField.pk || mField.version {
+				panic(NewDBErrorf(nil, "soft delete field %s.%s can't be pk or version", typ, field.Name))
+			}
+			if err = checkSoftDeleteField(mField); err != nil {
+				panic(NewDBErrorf(err, "Invalid soft delete field %s.%s", typ, field.Name))
+			}
+		}
 
 		if mField.pk {
 			if *pkField == nil {
@@ -322,6 +468,23 @@ func parseFields(index []int, ind reflect.Value, typ reflect.Type, pkField **met
 	return fields
 }
 
+func parseColumnSchema(tag reflect.StructTag) (schema columnSchema, err error) {
+	schema.sqlType = tag.Get("type")
+	if size, ok := tag.Lookup("size"); ok {
+		if schema.size, err = strconv.Atoi(size); err != nil || schema.size <= 0 {
+			return schema, fmt.Errorf("invalid size %s", size)
+		}
+	}
+	schema.nullable = strings.ToLower(tag.Get("nullable"))
+	if schema.nullable != "" && schema.nullable != "y" && schema.nullable != "n" {
+		return schema, fmt.Errorf("invalid nullable %s", schema.nullable)
+	}
+	schema.index = tag.Get("index")
+	schema.unique = tag.Get("unique")
+	schema.defaultVal, schema.hasDefault = tag.Lookup("default")
+	return
+}
+
 func extract(model Entity) (val reflect.Value, ind reflect.Value, typ reflect.Type) {
 	return c.ExtractRefTuple(model)
 }
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -115,7 +116,8 @@ func TestUpdate(t *testing.T) {
 		}
 		rt, err = Update(dboper, &tm2)
 		checkError(err, true, t, "Update"+fmt.Sprintf("%d", tm2.ID))
-		if rt {
+		// sqlite返回的是匹配的行数,没有修改的行也计算在内
+		if rt && dbpool.Dialect() == MySQLDialect {
 			t.Error("No change,but Updated ", err, tm2.ID, rt)
 		}
 		e, err := Get(dboper, &tm, tm.ID)
@@ -327,3 +329,235 @@ func TestUpdateReplace(t *testing.T) {
 		t.Error("Update fail", err, tm.ID, rt)
 	}
 }
+
+func TestCtx(t *testing.T) {
+	defaultMetaReg.clean()
+	tm := tmodel{Name: sql.NullString{String: "d0ngw", Valid: true}}
+	_, err = defaultMetaReg.regModel(&tm)
+
+	dboper := &Op{pool: dbpool}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = AddCtx(ctx, dboper, &tm)
+	assert.Error(t, err)
+
+	err = AddCtx(context.Background(), dboper, &tm)
+	assert.NoError(t, err)
+
+	dboper.SetTimeout(time.Second)
+	e, err := GetCtx(context.Background(), dboper, &tm, tm.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, e)
+
+	_, err = dboper.DoInTransCtx(context.Background(), &sql.TxOptions{ReadOnly: true}, func(tx *sql.Tx) (interface{}, error) {
+		total, err := QueryCount(dboper, &tm, "id", "WHERE id = ?", tm.ID)
+		assert.EqualValues(t, 1, total)
+		return nil, err
+	})
+	assert.NoError(t, err)
+
+	rt, err := DelCtx(context.Background(), dboper, &tm, tm.ID)
+	assert.NoError(t, err)
+	assert.True(t, rt)
+}
+
+type versionModel struct {
+	ID      int64  `column:"id" pk:"y"`
+	Name    string `column:"name" size:"32"`
+	Version int64  `column:"version" version:"y"`
+}
+
+func (p *versionModel) TableName() string {
+	return "version_model"
+}
+
+func TestOptimisticLock(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&versionModel{})
+	assert.Equal(t, "version", findEntityMeta(&versionModel{}).versionField.column)
+
+	createTables(t, &versionModel{})
+
+	dboper := &Op{pool: dbpool}
+	vm := &versionModel{Name: "v0"}
+	assert.NoError(t, Add(dboper, vm))
+
+	stale := *vm
+	vm.Name = "v1"
+	ok, err := Update(dboper, vm)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 1, vm.Version)
+
+	stale.Name = "stale"
+	ok, err = Update(dboper, &stale)
+	assert.False(t, ok)
+	assert.True(t, IsStaleEntity(err))
+	assert.EqualValues(t, 0, stale.Version)
+
+	_, err = UpdateExcludeColumns(dboper, &stale)
+	assert.True(t, IsStaleEntity(err))
+
+	_, err = UpdateReplace(dboper, &stale, map[string]ReplColumn{"version": {Repl: "0"}}, nil)
+	assert.Error(t, err)
+
+	vm.Name = "v2"
+	ok, err = UpdateReplace(dboper, vm, map[string]ReplColumn{"name": {Repl: "?", ParamVal: "v2"}}, nil)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, vm.Version)
+
+	attempts := 0
+	err = RetryOnStale(3, func() error {
+		attempts++
+		e, err := Get(dboper, &versionModel{}, vm.ID)
+		if err != nil {
+			return err
+		}
+		latest := e.(*versionModel)
+		if attempts == 1 {
+			// 模拟并发修改
+			_, err = UpdateExcludeColumns(dboper, vm)
+			assert.NoError(t, err)
+		}
+		latest.Name = "retry"
+		_, err = Update(dboper, latest)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	e, err := Get(dboper, &versionModel{}, vm.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "retry", e.(*versionModel).Name)
+	assert.EqualValues(t, 4, e.(*versionModel).Version)
+
+	err = RetryOnStale(2, func() error {
+		_, err := Update(dboper, &stale)
+		return err
+	})
+	assert.True(t, IsStaleEntity(err))
+}
+
+type versionKV struct {
+	Key     string `column:"k" pk:"y" pkAuto:"n" size:"32"`
+	Name    string `column:"name" size:"32"`
+	Version int64  `column:"version" version:"y"`
+}
+
+func (p *versionKV) TableName() string {
+	return "version_kv"
+}
+
+func TestOptimisticLockUpsert(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&versionKV{})
+
+	createTables(t, &versionKV{})
+
+	dboper := &Op{pool: dbpool}
+	kv := &versionKV{Key: "a", Name: "v0"}
+	assert.NoError(t, Add(dboper, kv))
+	for i := 0; i < 2; i++ {
+		_, err = Update(dboper, kv)
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, kv.Version)
+
+	// 使用旧的版本号写入时,版本号不会回退
+	_, err = AddOrUpdate(dboper, &versionKV{Key: "a", Name: "stale"})
+	assert.NoError(t, err)
+	e, err := Get(dboper, &versionKV{}, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", e.(*versionKV).Name)
+	assert.EqualValues(t, 3, e.(*versionKV).Version)
+
+	_, err = AddOrUpdateBatch(dboper, []Entity{&versionKV{Key: "a", Name: "batch"}, &versionKV{Key: "b", Name: "b"}})
+	assert.NoError(t, err)
+	e, err = Get(dboper, &versionKV{}, "a")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, e.(*versionKV).Version)
+	e, err = Get(dboper, &versionKV{}, "b")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, e.(*versionKV).Version)
+
+	// 持有旧版本的实体不能再更新
+	kv.Name = "v3"
+	_, err = Update(dboper, kv)
+	assert.True(t, IsStaleEntity(err))
+}
+
+func TestNestedTrans(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	testNestedTrans(t, dbpool)
+}
+
+// testNestedTrans 在pool上测试事务的传播行为
+func testNestedTrans(t *testing.T, pool *Pool) {
+	dboper := &Op{pool: pool}
+	newModel := func(name string) *tmodel {
+		return &tmodel{Name: sql.NullString{String: name, Valid: true}}
+	}
+	countName := func(name string) int64 {
+		total, err := QueryCount(&Op{pool: pool}, &tmodel{}, "*", "WHERE name = ?", name)
+		assert.NoError(t, err)
+		return total
+	}
+	errInner := fmt.Errorf("inner fail")
+
+	_, err := dboper.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		if err := Add(dboper, newModel("nested_outer")); err != nil {
+			return nil, err
+		}
+		_, err := dboper.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			if err := Add(dboper, newModel("nested_inner")); err != nil {
+				return nil, err
+			}
+			_, err := dboper.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+				return nil, errInner
+			})
+			assert.True(t, dboper.IsRollbackOnly())
+			return nil, err
+		})
+		assert.Equal(t, errInner, err)
+		assert.False(t, dboper.IsRollbackOnly())
+
+		_, err = dboper.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			return nil, Add(dboper, newModel("nested_ok"))
+		})
+		assert.NoError(t, err)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, countName("nested_outer"))
+	assert.EqualValues(t, 0, countName("nested_inner"))
+	assert.EqualValues(t, 1, countName("nested_ok"))
+
+	_, err = dboper.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		outerTx := dboper.tx
+		_, err := dboper.DoInTransWith(PropagationRequiresNew, func(tx *sql.Tx) (interface{}, error) {
+			assert.NotEqual(t, outerTx, tx)
+			return nil, Add(dboper, newModel("requires_new"))
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, outerTx, dboper.tx)
+		return nil, Add(dboper, newModel("requires_new_outer"))
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, countName("requires_new"))
+	assert.EqualValues(t, 1, countName("requires_new_outer"))
+
+	_, err = dboper.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+		return nil, Add(dboper, newModel("nested_no_outer"))
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, countName("nested_no_outer"))
+	assert.Nil(t, dboper.tx)
+
+	_, err = DelByCondition(dboper, &tmodel{}, "WHERE name LIKE ?", "nested%")
+	assert.NoError(t, err)
+	_, err = DelByCondition(dboper, &tmodel{}, "WHERE name LIKE ?", "requires_new%")
+	assert.NoError(t, err)
+}
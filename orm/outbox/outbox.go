@@ -0,0 +1,111 @@
+// Package outbox 事务发件箱:在业务事务中将事件写入发件箱表,由Relay读取后分发给Publisher,保证事件不丢失.
+//
+// 事件至少分发一次(at-least-once),分发成功但是标记失败时会重复分发,接收方需要使用Message.ID去重;
+// Key相同的消息按照写入的顺序分发,前面的消息分发失败时,后面的消息等待其成功或者被标记为失败.
+//
+// 写入的顺序由自增的消息ID决定,ID在插入时分配,而不是在事务提交时:同一个Key的消息在并发的事务中写入时,
+// ID较小的消息可能后提交.Relay在消息写入Relay.KeyDelay之后才分发,期间ID较小的消息提交后先分发;
+// 写入消息的事务执行超过KeyDelay时不保证顺序.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+	"github.com/d0ngw/go/orm"
+)
+
+// Table 发件箱的表名
+const Table = "orm_outbox"
+
+// Status 消息的状态
+type Status int
+
+const (
+	// StatusPending 等待分发
+	StatusPending Status = iota
+	// StatusDelivered 已经分发
+	StatusDelivered
+	// StatusFailed 分发的次数超过Relay.MaxAttempts,不再分发
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusDelivered:
+		return "delivered"
+	case StatusFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("status(%d)", int(s))
+}
+
+// Message 发件箱中的消息
+type Message struct {
+	ID          int64  `column:"id" pk:"y"`
+	Topic       string `column:"topic" size:"128"`
+	Key         string `column:"msg_key" size:"128" index:"y"` //分发顺序的key,为空时不保证顺序
+	Payload     []byte `column:"payload" nullable:"n"`
+	Status      Status `column:"status" index:"idx_status"`
+	Attempts    int    `column:"attempts"`               //已经分发的次数
+	NextAt      int64  `column:"next_at"`                //下次可以分发的时间(毫秒),分发时设置为占用的截止时间
+	LastError   string `column:"last_error" size:"1024"` //最后一次分发失败的原因
+	CreatedAt   int64  `column:"created_at"`
+	DeliveredAt int64  `column:"delivered_at"`
+}
+
+// TableName implements orm.Entity.TableName
+func (p *Message) TableName() string {
+	return Table
+}
+
+func init() {
+	orm.AddMeta(&Message{})
+}
+
+// CreateTableSQL 生成发件箱的建表语句
+func CreateTableSQL(dialect orm.Dialect) ([]string, error) {
+	return orm.CreateTableSQL(&Message{}, dialect)
+}
+
+// CreateTableMigration 创建发件箱表的迁移
+func CreateTableMigration(version int64, dialect orm.Dialect) (*orm.Migration, error) {
+	return orm.CreateTableMigration(version, &Message{}, dialect)
+}
+
+// Enqueue 使用op写入topic的消息,op在事务中时与事务一起提交或者回滚
+func Enqueue(op *orm.Op, topic string, payload []byte) (*Message, error) {
+	msg := &Message{Topic: topic, Payload: payload}
+	if err := EnqueueMessageCtx(op.Context(), op, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// EnqueueMessage 使用op写入消息,需要设置Topic,Key不为空时按照写入的顺序分发
+func EnqueueMessage(op *orm.Op, msg *Message) error {
+	return EnqueueMessageCtx(op.Context(), op, msg)
+}
+
+// EnqueueMessageCtx 使用ctx和op写入消息
+func EnqueueMessageCtx(ctx context.Context, op *orm.Op, msg *Message) error {
+	if msg == nil || msg.Topic == "" {
+		return fmt.Errorf("invalid message,need topic")
+	}
+	now := c.UnixMills(time.Now())
+	msg.ID = 0
+	msg.Status = StatusPending
+	msg.Attempts = 0
+	msg.NextAt = now
+	msg.LastError = ""
+	msg.CreatedAt = now
+	msg.DeliveredAt = 0
+	if msg.Payload == nil {
+		msg.Payload = []byte{}
+	}
+	return orm.AddCtx(ctx, op, msg)
+}
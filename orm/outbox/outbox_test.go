@@ -0,0 +1,251 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d0ngw/go/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+func newService(t *testing.T) (*orm.FakeDB, *orm.SimpleDBService) {
+	fake := orm.NewFakeDB()
+	service := orm.NewSimpleDBService(fake.PoolFunc())
+	service.Config = &orm.DBConfig{Schema: "outbox"}
+	assert.NoError(t, service.Init())
+	return fake, service
+}
+
+func pending(t *testing.T, op *orm.Op) []*Message {
+	msgs, err := orm.From[*Message]().Where(orm.Eq("status", StatusPending)).OrderBy("id").Find(op)
+	assert.NoError(t, err)
+	return msgs
+}
+
+func TestEnqueue(t *testing.T) {
+	fake, service := newService(t)
+	op, err := service.NewOp()
+	assert.NoError(t, err)
+
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		if _, err := Enqueue(op, "user.created", []byte(`{"id":1}`)); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("rollback")
+	})
+	assert.Error(t, err)
+	assert.Empty(t, pending(t, op))
+
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		return nil, EnqueueMessage(op, &Message{Topic: "user.updated", Key: "user:1", Payload: []byte(`{"id":1}`)})
+	})
+	assert.NoError(t, err)
+	msgs := pending(t, op)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "user.updated", msgs[0].Topic)
+	assert.Equal(t, "user:1", msgs[0].Key)
+	assert.Equal(t, `{"id":1}`, string(msgs[0].Payload))
+	assert.True(t, msgs[0].CreatedAt > 0)
+	fake.AssertCommitted(t, 1)
+
+	assert.Error(t, EnqueueMessage(op, &Message{}))
+	stmts, err := CreateTableSQL(orm.MySQLDialect)
+	assert.NoError(t, err)
+	assert.Contains(t, stmts[0], "CREATE TABLE IF NOT EXISTS orm_outbox")
+}
+
+func TestRelay(t *testing.T) {
+	_, service := newService(t)
+	op, _ := service.NewOp()
+	for _, msg := range []*Message{
+		{Topic: "order", Key: "a", Payload: []byte("a1")},
+		{Topic: "order", Key: "a", Payload: []byte("a2")},
+		{Topic: "order", Key: "b", Payload: []byte("b1")},
+		{Topic: "order", Payload: []byte("n1")},
+	} {
+		assert.NoError(t, EnqueueMessage(op, msg))
+	}
+
+	var (
+		mu        sync.Mutex
+		published []string
+		fail      = map[string]int{"a1": 1}
+	)
+	relay := NewRelay("outbox", service)
+	relay.RetryDelay = 20 * time.Millisecond
+	relay.Retention = time.Millisecond
+	relay.KeyDelay = -1
+	relay.Register("order", PublisherFunc(func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		payload := string(msg.Payload)
+		if fail[payload] > 0 {
+			fail[payload]--
+			return errors.New("publish fail")
+		}
+		published = append(published, payload)
+		return nil
+	}))
+	assert.NoError(t, relay.Init())
+
+	ctx := context.Background()
+	n, err := relay.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"b1", "n1"}, published)
+	msgs := pending(t, op)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, 1, msgs[0].Attempts)
+	assert.Equal(t, "publish fail", msgs[0].LastError)
+
+	// a1等待重试,a2需要在a1之后分发
+	n, err = relay.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	time.Sleep(30 * time.Millisecond)
+	n, err = relay.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"b1", "n1", "a1", "a2"}, published)
+	assert.Empty(t, pending(t, op))
+
+	// 被其他Relay占用的消息
+	assert.NoError(t, EnqueueMessage(op, &Message{Topic: "order", Key: "c", Payload: []byte("c1")}))
+	assert.NoError(t, EnqueueMessage(op, &Message{Topic: "order", Key: "c", Payload: []byte("c2")}))
+	msgs = pending(t, op)
+	_, err = orm.From[*Message]().Set("next_at", msgs[0].NextAt+time.Minute.Milliseconds()).Where(orm.Eq("id", msgs[0].ID)).Update(op)
+	assert.NoError(t, err)
+	n, err = relay.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, pending(t, op), 2)
+
+	time.Sleep(5 * time.Millisecond)
+	deleted, err := relay.Cleanup(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, deleted)
+}
+
+func TestRelayMaxAttempts(t *testing.T) {
+	_, service := newService(t)
+	op, _ := service.NewOp()
+	assert.NoError(t, EnqueueMessage(op, &Message{Topic: "unknown", Key: "k", Payload: []byte("u1")}))
+	assert.NoError(t, EnqueueMessage(op, &Message{Topic: "known", Key: "k", Payload: []byte("k1")}))
+
+	var published []string
+	relay := NewRelay("outbox", service)
+	relay.RetryDelay = time.Millisecond
+	relay.MaxAttempts = 2
+	relay.KeyDelay = -1
+	relay.Register("known", PublisherFunc(func(ctx context.Context, msg *Message) error {
+		published = append(published, string(msg.Payload))
+		return nil
+	}))
+	assert.NoError(t, relay.Init())
+
+	for i := 0; i < 3; i++ {
+		_, err := relay.Dispatch(context.Background())
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"k1"}, published)
+	msgs, err := orm.From[*Message]().Where(orm.Eq("status", StatusFailed)).Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 2, msgs[0].Attempts)
+	assert.Equal(t, "no publisher for topic unknown", msgs[0].LastError)
+}
+
+func TestRelayKeyDelay(t *testing.T) {
+	_, service := newService(t)
+	op, _ := service.NewOp()
+	txOp, _ := service.NewOp()
+
+	var published []string
+	relay := NewRelay("outbox", service)
+	relay.KeyDelay = 50 * time.Millisecond
+	relay.Register("order", PublisherFunc(func(ctx context.Context, msg *Message) error {
+		published = append(published, string(msg.Payload))
+		return nil
+	}))
+	assert.NoError(t, relay.Init())
+
+	// a1的事务先写入但后提交,a2在a1提交之前已经可见
+	ctx := context.Background()
+	_, err := txOp.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		if err := EnqueueMessage(txOp, &Message{Topic: "order", Key: "a", Payload: []byte("a1")}); err != nil {
+			return nil, err
+		}
+		if err := EnqueueMessage(op, &Message{Topic: "order", Key: "a", Payload: []byte("a2")}); err != nil {
+			return nil, err
+		}
+		assert.NoError(t, EnqueueMessage(op, &Message{Topic: "order", Payload: []byte("n1")}))
+		n, err := relay.Dispatch(ctx)
+		assert.Equal(t, 1, n)
+		return nil, err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"n1"}, published)
+
+	time.Sleep(60 * time.Millisecond)
+	n, err := relay.Dispatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"n1", "a1", "a2"}, published)
+}
+
+func TestRelayService(t *testing.T) {
+	_, service := newService(t)
+	op, _ := service.NewOp()
+
+	var (
+		mu      sync.Mutex
+		headers http.Header
+		bodies  []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		headers = r.Header
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	relay := NewRelay("outbox", service)
+	relay.Interval = 5 * time.Millisecond
+	relay.RegisterDefault(&HTTPPublisher{URL: server.URL, Header: map[string]string{"X-Token": "t"}})
+	assert.NoError(t, relay.Init())
+	assert.True(t, relay.Start())
+
+	msg, err := Enqueue(op, "user.created", []byte(`{"id":1}`))
+	assert.NoError(t, err)
+	deadline := time.Now().Add(time.Second)
+	for len(pending(t, op)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.True(t, relay.Stop())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{`{"id":1}`}, bodies)
+	assert.Equal(t, "user.created", headers.Get("X-Outbox-Topic"))
+	assert.Equal(t, "1", headers.Get("X-Outbox-Id"))
+	assert.EqualValues(t, 1, msg.ID)
+	assert.Equal(t, "t", headers.Get("X-Token"))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failServer.Close()
+	err = (&HTTPPublisher{URL: failServer.URL}).Publish(context.Background(), msg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/d0ngw/go/cache"
+	"github.com/gomodule/redigo/redis"
+)
+
+// Publisher 分发消息,返回nil表示分发成功;同一条消息可能被分发多次
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc 函数形式的Publisher
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish implements Publisher.Publish
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// HTTPPublisher 以POST请求将Payload发送到URL,消息的ID,Topic,Key放在请求头X-Outbox-Id,X-Outbox-Topic,X-Outbox-Key中,
+// 响应的状态码为2xx时表示成功
+type HTTPPublisher struct {
+	URL         string
+	ContentType string            //默认为application/json
+	Header      map[string]string //额外的请求头
+	Client      *http.Client      //为nil时使用超时时间为10秒的http.Client
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Publish implements Publisher.Publish
+func (p *HTTPPublisher) Publish(ctx context.Context, msg *Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range p.Header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("X-Outbox-Id", strconv.FormatInt(msg.ID, 10))
+	req.Header.Set("X-Outbox-Topic", msg.Topic)
+	if msg.Key != "" {
+		req.Header.Set("X-Outbox-Key", msg.Key)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post %s fail,status:%d,body:%s", p.URL, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// RedisPublisher 使用XADD将消息写入Redis Stream,Stream的key为ParamConf的前缀加上Topic,
+// 字段为id,topic,key,payload
+type RedisPublisher struct {
+	Client    *cache.RedisClient
+	ParamConf *cache.ParamConf
+	MaxLen    int //大于0时使用MAXLEN ~限制Stream的长度
+}
+
+// Publish implements Publisher.Publish
+func (p *RedisPublisher) Publish(ctx context.Context, msg *Message) error {
+	param := p.ParamConf.NewParamKey(msg.Topic)
+	_, err := p.Client.Do(param, func(conn redis.Conn) (interface{}, error) {
+		args := redis.Args{param.Key()}
+		if p.MaxLen > 0 {
+			args = args.Add("MAXLEN", "~", p.MaxLen)
+		}
+		args = args.Add("*", "id", msg.ID, "topic", msg.Topic, "key", msg.Key, "payload", msg.Payload)
+		if connCtx, ok := conn.(redis.ConnWithContext); ok {
+			return connCtx.DoContext(ctx, "XADD", args...)
+		}
+		return conn.Do("XADD", args...)
+	})
+	return err
+}
@@ -0,0 +1,280 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+	"github.com/d0ngw/go/orm"
+)
+
+// Relay 轮询发件箱并分发消息的服务;多个Relay可以同时处理同一个发件箱,消息在分发前通过更新NextAt占用
+type Relay struct {
+	c.BaseService
+	BatchSize       int           //每次读取的消息数,默认100
+	Interval        time.Duration //没有待分发的消息时轮询的间隔,默认1秒
+	Lease           time.Duration //分发一条消息占用的时间,超时未完成时可以被重新分发,默认30秒
+	RetryDelay      time.Duration //第一次分发失败后等待的时间,之后每次翻倍,默认1秒
+	MaxRetryDelay   time.Duration //分发失败后最长的等待时间,默认5分钟
+	MaxAttempts     int           //最多分发的次数,超过时标记为StatusFailed,<=0时不限制
+	Retention       time.Duration //已分发的消息保留的时间,默认24小时,<0时不清理
+	CleanupInterval time.Duration //清理已分发消息的间隔,默认1分钟
+	KeyDelay        time.Duration //Key不为空的消息写入后等待的时间,之后才分发,需要大于写入消息的事务的最长执行时间,默认1秒,<0时不等待
+
+	db         orm.OpCreator
+	mu         sync.RWMutex
+	publishers map[string]Publisher
+	fallback   Publisher
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewRelay 创建从db的发件箱分发消息的Relay
+func NewRelay(name string, db orm.OpCreator) *Relay {
+	return &Relay{
+		BaseService: c.BaseService{SName: name},
+		db:          db,
+		publishers:  map[string]Publisher{},
+	}
+}
+
+// Register 设置topic的Publisher
+func (p *Relay) Register(topic string, publisher Publisher) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.publishers[topic] = publisher
+}
+
+// RegisterDefault 设置没有注册Publisher的topic使用的Publisher
+func (p *Relay) RegisterDefault(publisher Publisher) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fallback = publisher
+}
+
+func (p *Relay) publisher(topic string) Publisher {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if publisher := p.publishers[topic]; publisher != nil {
+		return publisher
+	}
+	return p.fallback
+}
+
+// Init implements Initable.Init
+func (p *Relay) Init() error {
+	if p.db == nil {
+		return errors.New("no db")
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = 100
+	}
+	if p.Interval <= 0 {
+		p.Interval = time.Second
+	}
+	if p.Lease <= 0 {
+		p.Lease = 30 * time.Second
+	}
+	if p.RetryDelay <= 0 {
+		p.RetryDelay = time.Second
+	}
+	if p.MaxRetryDelay <= 0 {
+		p.MaxRetryDelay = 5 * time.Minute
+	}
+	if p.Retention == 0 {
+		p.Retention = 24 * time.Hour
+	}
+	if p.CleanupInterval <= 0 {
+		p.CleanupInterval = time.Minute
+	}
+	if p.KeyDelay == 0 {
+		p.KeyDelay = time.Second
+	}
+	return nil
+}
+
+// Start implements Service.Start
+func (p *Relay) Start() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		c.Infof("start outbox relay %s", p.Name())
+		var lastCleanup time.Time
+		for ctx.Err() == nil {
+			n, err := p.Dispatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				c.Errorf("outbox relay %s dispatch fail,err:%v", p.Name(), err)
+			}
+			if p.Retention > 0 && time.Since(lastCleanup) >= p.CleanupInterval {
+				lastCleanup = time.Now()
+				if _, err = p.Cleanup(ctx); err != nil && ctx.Err() == nil {
+					c.Errorf("outbox relay %s cleanup fail,err:%v", p.Name(), err)
+				}
+			}
+			if err == nil && n > 0 {
+				continue
+			}
+			timer := time.NewTimer(p.Interval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+		c.Infof("finish outbox relay %s", p.Name())
+	}()
+	return true
+}
+
+// Stop implements Service.Stop,等待正在分发的消息结束
+func (p *Relay) Stop() bool {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+	return true
+}
+
+// Dispatch 读取一批到期的消息并分发,返回分发的消息数;同一个Key的消息按照ID的顺序分发,
+// 写入不足KeyDelay的消息暂不分发,等待并发写入的ID较小的消息提交
+func (p *Relay) Dispatch(ctx context.Context) (int, error) {
+	op, err := p.db.NewOp()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	msgs, err := orm.From[*Message]().
+		Where(orm.Eq("status", StatusPending), orm.Le("next_at", c.UnixMills(now))).
+		OrderBy("id").
+		Limit(p.BatchSize).
+		FindCtx(ctx, op)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		dispatched int
+		checked    = map[string]bool{}
+		blocked    = map[string]bool{} //前面的消息未完成分发的key,其后的消息本次不分发
+	)
+	for _, msg := range msgs {
+		if err = ctx.Err(); err != nil {
+			return dispatched, err
+		}
+		if msg.Key != "" {
+			if blocked[msg.Key] {
+				continue
+			}
+			if p.KeyDelay > 0 && msg.CreatedAt > c.UnixMills(now.Add(-p.KeyDelay)) {
+				blocked[msg.Key] = true
+				continue
+			}
+			if !checked[msg.Key] {
+				checked[msg.Key] = true
+				// 前面还有未到期或者正在分发的消息
+				n, err := orm.From[*Message]().Where(orm.Eq("msg_key", msg.Key), orm.Eq("status", StatusPending), orm.Lt("id", msg.ID)).CountCtx(ctx, op)
+				if err != nil {
+					return dispatched, err
+				}
+				if n > 0 {
+					blocked[msg.Key] = true
+					continue
+				}
+			}
+		}
+		claimed, err := p.claim(ctx, op, msg, time.Now())
+		if err != nil {
+			return dispatched, err
+		}
+		if !claimed {
+			blocked[msg.Key] = msg.Key != ""
+			continue
+		}
+		dispatched++
+		if err = p.deliver(ctx, op, msg); err != nil {
+			return dispatched, err
+		}
+		if msg.Status == StatusPending {
+			blocked[msg.Key] = msg.Key != ""
+		}
+	}
+	return dispatched, nil
+}
+
+// claim 更新NextAt占用消息,消息已经被其他Relay占用时返回false
+func (p *Relay) claim(ctx context.Context, op *orm.Op, msg *Message, now time.Time) (bool, error) {
+	nextAt := c.UnixMills(now.Add(p.Lease))
+	n, err := orm.From[*Message]().
+		Set("next_at", nextAt).
+		Set("attempts", msg.Attempts+1).
+		Where(orm.Eq("id", msg.ID), orm.Eq("status", StatusPending), orm.Eq("next_at", msg.NextAt)).
+		UpdateCtx(ctx, op)
+	if err != nil || n == 0 {
+		return false, err
+	}
+	msg.NextAt = nextAt
+	msg.Attempts++
+	return true, nil
+}
+
+// deliver 分发占用的消息并记录结果
+func (p *Relay) deliver(ctx context.Context, op *orm.Op, msg *Message) error {
+	publishErr := fmt.Errorf("no publisher for topic %s", msg.Topic)
+	if publisher := p.publisher(msg.Topic); publisher != nil {
+		publishErr = publisher.Publish(ctx, msg)
+	}
+
+	// 停止时也记录分发的结果,减少重复分发
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	update := orm.From[*Message]().Where(orm.Eq("id", msg.ID), orm.Eq("next_at", msg.NextAt))
+	if publishErr == nil {
+		msg.Status, msg.DeliveredAt = StatusDelivered, c.UnixMills(now)
+		update.Set("status", msg.Status).Set("delivered_at", msg.DeliveredAt)
+	} else {
+		msg.LastError = publishErr.Error()
+		if len(msg.LastError) > 1024 {
+			msg.LastError = msg.LastError[:1024]
+		}
+		if p.MaxAttempts > 0 && msg.Attempts >= p.MaxAttempts {
+			msg.Status = StatusFailed
+			c.Errorf("outbox message %d topic %s failed after %d attempts,err:%v", msg.ID, msg.Topic, msg.Attempts, publishErr)
+		} else {
+			msg.NextAt = c.UnixMills(now.Add(p.backoff(msg.Attempts)))
+			c.Warnf("outbox message %d topic %s attempt %d fail,err:%v", msg.ID, msg.Topic, msg.Attempts, publishErr)
+		}
+		update.Set("status", msg.Status).Set("next_at", msg.NextAt).Set("last_error", msg.LastError)
+	}
+	_, err := update.UpdateCtx(ctx, op)
+	return err
+}
+
+// backoff 第attempts次分发失败后等待的时间
+func (p *Relay) backoff(attempts int) time.Duration {
+	delay := p.RetryDelay
+	for i := 1; i < attempts && delay < p.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxRetryDelay {
+		delay = p.MaxRetryDelay
+	}
+	return delay
+}
+
+// Cleanup 删除分发时间早于Retention的消息,返回删除的条数
+func (p *Relay) Cleanup(ctx context.Context) (int64, error) {
+	if p.Retention < 0 {
+		return 0, nil
+	}
+	op, err := p.db.NewOp()
+	if err != nil {
+		return 0, err
+	}
+	before := c.UnixMills(time.Now().Add(-p.Retention))
+	return orm.From[*Message]().Where(orm.Eq("status", StatusDelivered), orm.Lt("delivered_at", before)).DeleteCtx(ctx, op)
+}
@@ -0,0 +1,51 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// NewPostgresDBPool build postgres db pool from config,需要引入驱动,如github.com/lib/pq
+func NewPostgresDBPool(config *DBConfig) (*Pool, error) {
+	if config == nil {
+		return nil, &DBError{"Not found config", nil}
+	}
+
+	if len(config.User) == 0 || len(config.URL) == 0 || len(config.Schema) == 0 {
+		return nil, &DBError{"Invalid config", nil}
+	}
+
+	query := url.Values{}
+	if _, ok := config.Ext["sslmode"]; !ok {
+		query.Set("sslmode", "disable")
+	}
+	keys := make([]string, 0, len(config.Ext))
+	for k := range config.Ext {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		query.Set(k, config.Ext[k])
+	}
+	connectURL := fmt.Sprintf("postgres://%s@%s/%s?%s", url.UserPassword(config.User, config.Pass).String(), config.URL, config.Schema, query.Encode())
+
+	db, err := sql.Open(config.driverName(PostgresDialect), connectURL)
+	if err != nil {
+		c.Errorf("Error on initializing database connection,%v", err)
+		return nil, &DBError{"Can't open connection", err}
+	}
+
+	c.Infof("db max idle connections:%d,max open connections:%d,ext:%v", config.MaxIdle, config.MaxConn, config.Ext)
+	setupDBLimits(db, config)
+	if err = setupCodecs(config); err != nil {
+		db.Close()
+		return nil, NewDBError(err, "Invalid config")
+	}
+	return withReplicas(NewPool(db, PostgresDialect), config, NewPostgresDBPool)
+}
@@ -0,0 +1,351 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RelationKind 关联关系的类型
+type RelationKind string
+
+const (
+	// HasOne 一对一,关联实体的fk列引用当前实体的ref列(默认为主键)
+	HasOne RelationKind = "hasOne"
+	// HasMany 一对多,关联实体的fk列引用当前实体的ref列(默认为主键)
+	HasMany RelationKind = "hasMany"
+	// BelongsTo 从属,当前实体的fk列引用关联实体的ref列(默认为主键)
+	BelongsTo RelationKind = "belongsTo"
+)
+
+// DefaultPreloadBatchSize 预加载时每条IN语句中最多的参数个数
+const DefaultPreloadBatchSize = 500
+
+// metaRelation 实体字段上通过rel标签声明的关联关系
+type metaRelation struct {
+	name   string       //struct中的字段名称
+	kind   RelationKind //关联类型
+	index  []int        //索引
+	target reflect.Type //关联实体的指针类型
+	fk     string       //外键列
+	ref    string       //外键引用的列,为空时使用主键
+	rule   string       //关联实体的分片规则名称,为空时使用默认规则
+}
+
+// parseRelation 解析rel标签,格式为"hasMany,fk=user_id[,ref=id][,rule=name]";
+// hasMany的字段必须是实体指针的slice,hasOne和belongsTo的字段必须是实体指针
+func parseRelation(index []int, field reflect.StructField, tag string) (*metaRelation, error) {
+	parts := strings.Split(tag, ",")
+	rel := &metaRelation{name: field.Name, kind: RelationKind(strings.TrimSpace(parts[0])), index: index}
+	for _, part := range parts[1:] {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid option %s", part)
+		}
+		switch v = strings.TrimSpace(v); strings.TrimSpace(k) {
+		case "fk":
+			rel.fk = v
+		case "ref":
+			rel.ref = v
+		case "rule":
+			rel.rule = v
+		default:
+			return nil, fmt.Errorf("unknown option %s", k)
+		}
+	}
+	if rel.fk == "" {
+		return nil, fmt.Errorf("need fk")
+	}
+
+	typ := field.Type
+	switch rel.kind {
+	case HasMany:
+		if typ.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("%s must be slice", typ)
+		}
+		typ = typ.Elem()
+	case HasOne, BelongsTo:
+	default:
+		return nil, fmt.Errorf("unknown relation %s", rel.kind)
+	}
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct || !typ.Implements(entityType) {
+		return nil, fmt.Errorf("%s must be entity pointer", typ)
+	}
+	rel.target = typ
+	return rel, nil
+}
+
+// newTarget 创建关联的实体
+func (p *metaRelation) newTarget() Entity {
+	return reflect.New(p.target.Elem()).Interface().(Entity)
+}
+
+// columns 当前实体m与关联实体target上用于匹配的字段
+func (p *metaRelation) columns(m, target *meta) (src, dst *metaField, err error) {
+	if p.kind == BelongsTo {
+		src, dst = m.columnFields[p.fk], target.pkField
+		if p.ref != "" {
+			dst = target.columnFields[p.ref]
+		}
+	} else {
+		src, dst = m.pkField, target.columnFields[p.fk]
+		if p.ref != "" {
+			src = m.columnFields[p.ref]
+		}
+	}
+	if src == nil || dst == nil {
+		err = fmt.Errorf("can't find columns of relation %s.%s,fk:%s,ref:%s", m.name, p.name, p.fk, p.ref)
+	}
+	return
+}
+
+// Preload 加载entities的关联实体,参见PreloadCtx
+func Preload(op *Op, entities []Entity, names ...string) error {
+	return PreloadCtx(op.Context(), op, entities, names...)
+}
+
+// PreloadCtx 使用ctx加载entities中名称为names的关联字段,每个关联使用IN批量查询,避免逐个查询;
+// 名称可以使用"."加载多级关联,如"Orders.Items";op由ShardDBService创建且关联实体分片时,
+// 能根据关联列确定分片的按分片分组查询,否则在关联实体的所有分片上查询
+func PreloadCtx(ctx context.Context, op *Op, entities []Entity, names ...string) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	m := findEntityMeta(entities[0])
+
+	var heads []string
+	nested := map[string][]string{}
+	for _, name := range names {
+		head, rest, _ := strings.Cut(name, ".")
+		if _, ok := nested[head]; !ok {
+			heads = append(heads, head)
+			nested[head] = nil
+		}
+		if rest != "" {
+			nested[head] = append(nested[head], rest)
+		}
+	}
+
+	for _, head := range heads {
+		rel := m.relations[head]
+		if rel == nil {
+			return fmt.Errorf("can't find relation %s in %s", head, m.name)
+		}
+		related, err := preloadRelation(ctx, op, m, rel, entities)
+		if err != nil {
+			return err
+		}
+		if len(nested[head]) > 0 {
+			if err = PreloadCtx(ctx, op, related, nested[head]...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PreloadT 加载T的关联实体,参见PreloadCtx
+func PreloadT[T Entity](op *Op, entities []T, names ...string) error {
+	return PreloadTCtx(op.Context(), op, entities, names...)
+}
+
+// PreloadTCtx 使用ctx加载T的关联实体,参见PreloadCtx
+func PreloadTCtx[T Entity](ctx context.Context, op *Op, entities []T, names ...string) error {
+	list := make([]Entity, 0, len(entities))
+	for _, entity := range entities {
+		list = append(list, entity)
+	}
+	return PreloadCtx(ctx, op, list, names...)
+}
+
+// preloadRelation 加载并设置entities的关联字段rel,返回加载的关联实体
+func preloadRelation(ctx context.Context, op *Op, m *meta, rel *metaRelation, entities []Entity) ([]Entity, error) {
+	target := findEntityMeta(rel.newTarget())
+	src, dst, err := rel.columns(m, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []interface{}
+	origins := map[interface{}]reflect.Value{}
+	for _, entity := range entities {
+		_, ind, _ := extract(entity)
+		v := ind.FieldByIndex(src.index)
+		key := relationKey(v)
+		if key == nil {
+			continue
+		}
+		if _, ok := origins[key]; !ok {
+			origins[key] = v
+			keys = append(keys, key)
+		}
+	}
+
+	related, err := loadRelated(ctx, op, rel, target, dst, keys, origins)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[interface{}][]reflect.Value{}
+	for _, entity := range related {
+		v := reflect.ValueOf(entity)
+		key := relationKey(v.Elem().FieldByIndex(dst.index))
+		groups[key] = append(groups[key], v)
+	}
+
+	for _, entity := range entities {
+		_, ind, _ := extract(entity)
+		field := ind.FieldByIndex(rel.index)
+		var matched []reflect.Value
+		if key := relationKey(ind.FieldByIndex(src.index)); key != nil {
+			matched = groups[key]
+		}
+		switch {
+		case rel.kind == HasMany:
+			field.Set(reflect.Append(reflect.MakeSlice(field.Type(), 0, len(matched)), matched...))
+		case len(matched) > 0:
+			field.Set(matched[0])
+		default:
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	return related, nil
+}
+
+// relatedShard 关联实体的一个分片及需要在该分片上查询的键
+type relatedShard struct {
+	poolName string
+	table    string
+	keys     []interface{}
+}
+
+// loadRelated 按主键顺序查询column的值在keys中的关联实体
+func loadRelated(ctx context.Context, op *Op, rel *metaRelation, target *meta, column *metaField, keys []interface{}, origins map[interface{}]reflect.Value) ([]Entity, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	shards, err := relatedShards(op, rel, column, keys, origins)
+	if err != nil {
+		return nil, err
+	}
+
+	var related []Entity
+	for _, shard := range shards {
+		shardOp := op
+		if shard.poolName != "" && shard.poolName != op.PoolName() {
+			if shardOp, err = op.sharDBSerevcie.NewOpByShardName(shard.poolName); err != nil {
+				return nil, err
+			}
+		}
+		for i := 0; i < len(shard.keys); i += DefaultPreloadBatchSize {
+			batch := shard.keys[i:min(i+DefaultPreloadBatchSize, len(shard.keys))]
+			entity := rel.newTarget()
+			if shard.table != "" {
+				if err = bindTable(entity, shard.table); err != nil {
+					return nil, err
+				}
+			}
+			condition := "WHERE " + op.Dialect().Quote(column.column) + " IN (" + strings.Join(toSlice("?", len(batch)), ",") + ")" +
+				" ORDER BY " + op.Dialect().Quote(target.pkField.column)
+			l, err := QueryCtx(ctx, shardOp, entity, condition, batch...)
+			if err != nil {
+				return nil, err
+			}
+			related = append(related, l...)
+		}
+	}
+	if len(shards) > 1 {
+		sort.SliceStable(related, func(i, j int) bool {
+			a := sortValue(reflect.ValueOf(related[i]).Elem().FieldByIndex(target.pkField.index))
+			b := sortValue(reflect.ValueOf(related[j]).Elem().FieldByIndex(target.pkField.index))
+			return compareValues(a, b) < 0
+		})
+	}
+	return related, nil
+}
+
+// relatedShards 将keys按关联实体的分片分组,关联实体没有分片时只有一组并使用op查询
+func relatedShards(op *Op, rel *metaRelation, column *metaField, keys []interface{}, origins map[interface{}]reflect.Value) ([]*relatedShard, error) {
+	service := op.sharDBSerevcie
+	if service == nil {
+		return []*relatedShard{{keys: keys}}, nil
+	}
+	columns, sharded, err := service.shardColumns(rel.newTarget(), rel.rule)
+	if err != nil {
+		return nil, err
+	}
+	if !sharded {
+		return []*relatedShard{{keys: keys}}, nil
+	}
+
+	if slices.ContainsFunc(columns, func(c string) bool { return c != column.column }) {
+		// 分片列不是关联列时无法确定分片,在所有分片上查询
+		tables, err := service.shardTables(rel.newTarget(), rel.rule)
+		if err != nil {
+			return nil, err
+		}
+		var shards []*relatedShard
+		for _, poolName := range sortedKeys(tables) {
+			for _, table := range tables[poolName] {
+				shards = append(shards, &relatedShard{poolName: poolName, table: table, keys: keys})
+			}
+		}
+		return shards, nil
+	}
+
+	var shards []*relatedShard
+	index := map[string]*relatedShard{}
+	for _, key := range keys {
+		probe := rel.newTarget()
+		_, ind, _ := extract(probe)
+		if err = assignValue(ind.FieldByIndex(column.index), origins[key]); err != nil {
+			return nil, err
+		}
+		poolName, err := service.setupTableShard(probe, rel.rule)
+		if err != nil {
+			return nil, err
+		}
+		table, err := tblName(probe)
+		if err != nil {
+			return nil, err
+		}
+		shard := index[poolName+"."+table]
+		if shard == nil {
+			shard = &relatedShard{poolName: poolName, table: table}
+			index[poolName+"."+table] = shard
+			shards = append(shards, shard)
+		}
+		shard.keys = append(shard.keys, key)
+	}
+	return shards, nil
+}
+
+// relationKey 用于匹配关联实体的键,nil表示没有关联;有符号及无符号的整数统一为int64,使不同整数类型的fk与ref可以匹配
+func relationKey(v reflect.Value) interface{} {
+	key := sortValue(v)
+	switch k := key.(type) {
+	case []byte:
+		return string(k)
+	case uint64:
+		if k <= math.MaxInt64 {
+			return int64(k)
+		}
+	}
+	return key
+}
+
+// assignValue 将v赋值给field,类型不同时进行转换
+func assignValue(field, v reflect.Value) error {
+	switch {
+	case v.Type().AssignableTo(field.Type()):
+		field.Set(v)
+	case v.Type().ConvertibleTo(field.Type()):
+		field.Set(v.Convert(field.Type()))
+	default:
+		return fmt.Errorf("can't assign %s to %s", v.Type(), field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package orm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type preloadUser struct {
+	ID      int64           `column:"id" pk:"y" pkAuto:"n"`
+	Name    string          `column:"name"`
+	Orders  []*preloadOrder `rel:"hasMany,fk=user_id"`
+	Profile *preloadProfile `rel:"hasOne,fk=user_id"`
+}
+
+func (p *preloadUser) TableName() string {
+	return "preload_user"
+}
+
+type preloadOrder struct {
+	ID     int64          `column:"id" pk:"y" pkAuto:"n"`
+	UserID int32          `column:"user_id"`
+	User   *preloadUser   `rel:"belongsTo,fk=user_id"`
+	Items  []*preloadItem `rel:"hasMany,fk=order_id"`
+}
+
+func (p *preloadOrder) TableName() string {
+	return "preload_order"
+}
+
+type preloadItem struct {
+	ID      int64  `column:"id" pk:"y" pkAuto:"n"`
+	OrderID uint64 `column:"order_id"` //与preloadOrder.ID的符号不同
+}
+
+func (p *preloadItem) TableName() string {
+	return "preload_item"
+}
+
+type preloadProfile struct {
+	ID     int64  `column:"id" pk:"y" pkAuto:"n"`
+	UserID int64  `column:"user_id"`
+	Bio    string `column:"bio"`
+}
+
+func (p *preloadProfile) TableName() string {
+	return "preload_profile"
+}
+
+type preloadShardUser struct {
+	ID         int64                `column:"id" pk:"y" pkAuto:"n"`
+	ByUser     []*preloadShardOrder `rel:"hasMany,fk=user_id,rule=by_user"`
+	ByID       []*preloadShardOrder `rel:"hasMany,fk=user_id,rule=by_id"`
+	LastByUser *preloadShardOrder   `rel:"hasOne,fk=user_id,rule=by_user"`
+}
+
+func (p *preloadShardUser) TableName() string {
+	return "preload_shard_user"
+}
+
+type preloadShardOrder struct {
+	BaseShardEntity
+	ID     int64 `column:"id" pk:"y" pkAuto:"n"`
+	UserID int64 `column:"user_id"`
+}
+
+func (p *preloadShardOrder) TableName() string {
+	return "preload_shard_order"
+}
+
+type badRelModel struct {
+	ID    int64          `column:"id" pk:"y"`
+	Items []preloadItem  `rel:"hasMany,fk=order_id"`
+	Order *preloadOrder  `rel:"hasOne"`
+	Other *preloadOrder  `rel:"manyToMany,fk=id"`
+	Rel   *preloadItem   `rel:"hasOne,fk=id,foo=bar"`
+	Slice []*preloadItem `rel:"hasOne,fk=id"`
+}
+
+func (p *badRelModel) TableName() string {
+	return "bad_rel_model"
+}
+
+func TestPreload(t *testing.T) {
+	AddMeta(&preloadUser{})
+	AddMeta(&preloadOrder{})
+	AddMeta(&preloadItem{})
+	AddMeta(&preloadProfile{})
+	createTables(t, &preloadUser{}, &preloadOrder{}, &preloadItem{}, &preloadProfile{})
+
+	op := &Op{pool: dbpool}
+	assert.NoError(t, AddBatch(op, []Entity{&preloadUser{ID: 1, Name: "a"}, &preloadUser{ID: 2, Name: "b"}, &preloadUser{ID: 3, Name: "c"}}))
+	assert.NoError(t, AddBatch(op, []Entity{&preloadOrder{ID: 11, UserID: 1}, &preloadOrder{ID: 12, UserID: 1}, &preloadOrder{ID: 21, UserID: 2}}))
+	assert.NoError(t, AddBatch(op, []Entity{&preloadItem{ID: 1, OrderID: 11}, &preloadItem{ID: 2, OrderID: 11}, &preloadItem{ID: 3, OrderID: 21}}))
+	assert.NoError(t, Add(op, &preloadProfile{ID: 1, UserID: 2, Bio: "bio"}))
+
+	users, err := From[*preloadUser]().OrderBy("id").Preload("Orders.Items", "Profile").Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	assert.Len(t, users[0].Orders, 2)
+	assert.EqualValues(t, 11, users[0].Orders[0].ID)
+	assert.EqualValues(t, 12, users[0].Orders[1].ID)
+	assert.Len(t, users[0].Orders[0].Items, 2)
+	assert.NotNil(t, users[0].Orders[1].Items)
+	assert.Len(t, users[0].Orders[1].Items, 0)
+	assert.Nil(t, users[0].Profile)
+	assert.Len(t, users[1].Orders, 1)
+	assert.Len(t, users[1].Orders[0].Items, 1)
+	assert.Equal(t, "bio", users[1].Profile.Bio)
+	assert.NotNil(t, users[2].Orders)
+	assert.Len(t, users[2].Orders, 0)
+
+	orders, err := QueryT[*preloadOrder](op, "ORDER BY id")
+	assert.NoError(t, err)
+	assert.NoError(t, PreloadT(op, orders, "User"))
+	assert.Equal(t, "a", orders[0].User.Name)
+	assert.Equal(t, "a", orders[1].User.Name)
+	assert.Equal(t, "b", orders[2].User.Name)
+
+	assert.Equal(t, relationKey(reflect.ValueOf(int32(5))), relationKey(reflect.ValueOf(uint64(5))))
+	assert.Equal(t, uint64(math.MaxUint64), relationKey(reflect.ValueOf(uint64(math.MaxUint64))))
+
+	assert.Error(t, PreloadT(op, orders, "NoSuch"))
+	assert.NoError(t, Preload(op, nil, "NoSuch"))
+
+	assert.Panics(t, func() {
+		MetaOf(&badRelModel{})
+	})
+	for _, tag := range []string{"hasMany,fk=order_id", "hasOne", "manyToMany,fk=id", "hasOne,fk=id,foo=bar"} {
+		_, err = parseRelation(nil, fieldOf(&preloadOrder{}, "User"), tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func fieldOf(entity Entity, name string) reflect.StructField {
+	_, _, typ := extract(entity)
+	field, _ := typ.FieldByName(name)
+	return field
+}
+
+func TestPreloadShard(t *testing.T) {
+	AddMeta(&preloadShardUser{})
+	AddMeta(&preloadShardOrder{})
+
+	conf := &shardConf{}
+	conf.DBShards = &DBShardConfig{Shards: map[string]*DBConfig{"s0": {URL: "s0", Schema: "s0"}}, Default: "s0"}
+	conf.EntityShards = &EntityShardConfig{Entities: map[string]map[string][]*EntityShardRuleConfig{
+		"github.com/d0ngw/go/orm": {
+			"preloadShardOrder": {
+				{
+					Name:       "by_user",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 2, NamePrefix: "preload_shard_order_u_", FieldName: "user_id"}},
+				},
+				{
+					Name:       "by_id",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 3, NamePrefix: "preload_shard_order_i_", FieldName: "id"}},
+				},
+			},
+		},
+	}}
+	assert.NoError(t, conf.DBShards.Parse())
+	assert.NoError(t, conf.EntityShards.Parse())
+
+	service := NewSimpleShardDBService(func(*DBConfig) (*Pool, error) {
+		return dbpool, nil
+	})
+	service.DBShardConfig = conf
+	service.EntityShardConfig = conf
+	assert.NoError(t, service.Init())
+
+	createTables(t, &preloadShardUser{})
+	for _, table := range []string{"preload_shard_order_u_0", "preload_shard_order_u_1", "preload_shard_order_i_0", "preload_shard_order_i_1", "preload_shard_order_i_2"} {
+		m := &preloadShardOrder{}
+		assert.NoError(t, bindTable(m, table))
+		createTables(t, m)
+	}
+
+	op, err := service.NewOpByShardName("s0")
+	assert.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		assert.NoError(t, Add(op, &preloadShardUser{ID: i}))
+	}
+	for i := int64(1); i <= 6; i++ {
+		for _, rule := range []string{"by_user", "by_id"} {
+			m := &preloadShardOrder{ID: i, UserID: i%2 + 1}
+			orderOp, err := service.NewOpByEntity(m, rule)
+			assert.NoError(t, err)
+			assert.NoError(t, Add(orderOp, m))
+		}
+	}
+
+	users, err := From[*preloadShardUser]().OrderBy("id").Preload("ByUser", "ByID", "LastByUser").Find(op)
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	ids := func(orders []*preloadShardOrder) (ret []int64) {
+		for _, order := range orders {
+			ret = append(ret, order.ID)
+		}
+		return
+	}
+	assert.Equal(t, []int64{2, 4, 6}, ids(users[0].ByUser))
+	assert.Equal(t, []int64{2, 4, 6}, ids(users[0].ByID))
+	assert.Equal(t, []int64{1, 3, 5}, ids(users[1].ByUser))
+	assert.Equal(t, []int64{1, 3, 5}, ids(users[1].ByID))
+	assert.EqualValues(t, 1, users[1].LastByUser.ID)
+	assert.Len(t, users[2].ByUser, 0)
+	assert.Len(t, users[2].ByID, 0)
+	assert.Nil(t, users[2].LastByUser)
+}
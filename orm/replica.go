@@ -0,0 +1,173 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+const (
+	// ReplicaRoundRobin 轮询选择从库
+	ReplicaRoundRobin = "round_robin"
+	// ReplicaWeighted 按权重选择从库
+	ReplicaWeighted = "weighted"
+)
+
+const defaultReplicaCheckInterval = 5 * time.Second
+
+type forcePrimaryKey struct{}
+
+// ForcePrimary 返回强制使用主库读的上下文,用于GetCtx,QueryCtx等读操作
+func ForcePrimary(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+func isForcePrimary(ctx context.Context) bool {
+	force, _ := ctx.Value(forcePrimaryKey{}).(bool)
+	return force
+}
+
+// replica 从库
+type replica struct {
+	db      *sql.DB
+	url     string
+	weight  int
+	current int //平滑加权轮询的当前权重
+	healthy atomic.Bool
+}
+
+// replicaSet 一个主库的所有从库
+type replicaSet struct {
+	policy   string
+	replicas []*replica
+	counter  atomic.Uint64
+	mu       sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplicaSet(policy string, replicas []*replica) *replicaSet {
+	for _, r := range replicas {
+		if r.weight <= 0 {
+			r.weight = 1
+		}
+		r.healthy.Store(true)
+	}
+	return &replicaSet{policy: policy, replicas: replicas, stop: make(chan struct{})}
+}
+
+// pick 按策略从健康的从库中选择一个,没有健康的从库时返回nil
+func (p *replicaSet) pick() *replica {
+	healthy := make([]*replica, 0, len(p.replicas))
+	for _, r := range p.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	if p.policy != ReplicaWeighted {
+		return healthy[(p.counter.Add(1)-1)%uint64(len(healthy))]
+	}
+
+	// 平滑加权轮询
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		total int
+		best  *replica
+	)
+	for _, r := range healthy {
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// check 检查所有从库的连接,不可用的从库被剔除,恢复后重新加入
+func (p *replicaSet) check(timeout time.Duration) {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				c.Infof("replica %s recovered", r.url)
+			} else {
+				c.Warnf("replica %s ejected,err:%v", r.url, err)
+			}
+		}
+	}
+}
+
+func (p *replicaSet) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.check(interval)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *replicaSet) close() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	var err error
+	for _, r := range p.replicas {
+		if e := r.db.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// withReplicas 使用poolFunc创建config中配置的从库,并启动健康检查
+func withReplicas(pool *Pool, config *DBConfig, poolFunc PoolFunc) (*Pool, error) {
+	if len(config.Replicas) == 0 {
+		return pool, nil
+	}
+	replicas := make([]*replica, 0, len(config.Replicas))
+	for _, rc := range config.Replicas {
+		rp, err := poolFunc(config.replicaConfig(rc))
+		if err == nil && rp.Dialect() != pool.Dialect() {
+			err = NewDBErrorf(nil, "replica %s has different dialect %s", rc.URL, rp.Dialect().Name())
+		}
+		if err != nil {
+			for _, r := range replicas {
+				r.db.Close()
+			}
+			pool.db.Close()
+			return nil, err
+		}
+		replicas = append(replicas, &replica{db: rp.db, url: rc.URL, weight: rc.Weight})
+	}
+	pool.replicas = newReplicaSet(config.ReplicaPolicy, replicas)
+
+	interval := time.Duration(config.ReplicaCheckSecond) * time.Second
+	if config.ReplicaCheckSecond == 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	if interval > 0 {
+		go pool.replicas.run(interval)
+	}
+	c.Infof("db replicas count:%d,policy:%s,check interval:%s", len(replicas), config.ReplicaPolicy, interval)
+	return pool, nil
+}
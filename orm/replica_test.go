@@ -0,0 +1,88 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaPick(t *testing.T) {
+	r0, r1, r2 := &replica{url: "r0"}, &replica{url: "r1", weight: 3}, &replica{url: "r2"}
+	rs := newReplicaSet("", []*replica{r0, r1, r2})
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, rs.pick().url)
+	}
+	assert.Equal(t, []string{"r0", "r1", "r2", "r0"}, picked)
+
+	r1.healthy.Store(false)
+	assert.Equal(t, "r0", rs.pick().url)
+	assert.Equal(t, "r2", rs.pick().url)
+
+	r0.healthy.Store(false)
+	r2.healthy.Store(false)
+	assert.Nil(t, rs.pick())
+
+	r0, r1 = &replica{url: "r0"}, &replica{url: "r1", weight: 3}
+	rs = newReplicaSet(ReplicaWeighted, []*replica{r0, r1})
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[rs.pick().url]++
+	}
+	assert.Equal(t, map[string]int{"r0": 2, "r1": 6}, counts)
+
+	config := &DBConfig{User: "root", URL: "127.0.0.1:3306", Schema: "test", Replicas: []*ReplicaConfig{{URL: "127.0.0.1:3307", Pass: "p"}}}
+	assert.NoError(t, config.Parse())
+	rc := config.replicaConfig(config.Replicas[0])
+	assert.Equal(t, "127.0.0.1:3307", rc.URL)
+	assert.Equal(t, "root", rc.User)
+	assert.Equal(t, "p", rc.Pass)
+	assert.Nil(t, rc.Replicas)
+
+	config.ReplicaPolicy = "random"
+	assert.Error(t, config.Parse())
+	config.ReplicaPolicy = ReplicaWeighted
+	config.Replicas = append(config.Replicas, &ReplicaConfig{})
+	assert.Error(t, config.Parse())
+}
+
+func TestReplicaRouting(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+
+	// 不可用的从库,路由到从库的读操作会失败
+	badDB, err := sql.Open("mysql", "root:@tcp(127.0.0.1:1)/test?timeout=200ms")
+	assert.NoError(t, err)
+	defer badDB.Close()
+
+	bad := &replica{db: badDB, url: "127.0.0.1:1"}
+	pool := &Pool{db: dbpool.db, dialect: dbpool.dialect, replicas: newReplicaSet("", []*replica{bad})}
+
+	op := pool.NewOp()
+	_, err = Get(op, &tmodel{}, 1)
+	assert.Error(t, err)
+
+	_, err = GetCtx(ForcePrimary(context.Background()), op, &tmodel{}, 1)
+	assert.NoError(t, err)
+
+	op.SetForcePrimary(true)
+	_, err = Query(op, &tmodel{}, "")
+	assert.NoError(t, err)
+
+	op = pool.NewOp()
+	tm := &tmodel{}
+	assert.NoError(t, Add(op, tm))
+	e, err := Get(op, tm, tm.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, e)
+	_, err = Del(op, tm, tm.ID)
+	assert.NoError(t, err)
+
+	pool.replicas.check(time.Second)
+	assert.False(t, bad.healthy.Load())
+	_, err = QueryCount(pool.NewOp(), &tmodel{}, "*", "")
+	assert.NoError(t, err)
+}
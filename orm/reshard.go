@@ -0,0 +1,617 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// DefaultReshardCheckpointTable 默认记录迁移断点的表名
+const DefaultReshardCheckpointTable = "orm_reshard_checkpoints"
+
+// DefaultReshardBatchSize 迁移时每批复制的行数
+const DefaultReshardBatchSize = 500
+
+// ReshardMode 迁移期间的写入模式
+type ReshardMode int32
+
+const (
+	// ReshardWriteOld 只写旧规则的分片
+	ReshardWriteOld ReshardMode = iota
+	// ReshardWriteBoth 双写,先写旧规则的分片,再将该行同步到新规则的分片
+	ReshardWriteBoth
+	// ReshardWriteNew 只写新规则的分片
+	ReshardWriteNew
+)
+
+// ReshardCheckpoint 一个源分片的迁移断点
+type ReshardCheckpoint struct {
+	ID        string `column:"id" pk:"y" pkAuto:"n" size:"255"`
+	Task      string `column:"task" size:"64"`
+	Source    string `column:"source" size:"128"`
+	LastKey   string `column:"last_key" size:"128"`
+	Copied    int64  `column:"copied"`
+	Done      bool   `column:"done"`
+	UpdatedAt int64  `column:"updated_at"`
+}
+
+// TableName implements Entity.TableName
+func (p *ReshardCheckpoint) TableName() string {
+	return DefaultReshardCheckpointTable
+}
+
+var reshardCheckpointMeta = MetaOf(&ReshardCheckpoint{}).(*meta)
+
+// ReshardCheckpointStore 迁移断点的存储
+type ReshardCheckpointStore interface {
+	// LoadCheckpoint 加载断点,没有时返回nil
+	LoadCheckpoint(ctx context.Context, task, source string) (*ReshardCheckpoint, error)
+	// SaveCheckpoint 保存断点
+	SaveCheckpoint(ctx context.Context, checkpoint *ReshardCheckpoint) error
+}
+
+// MemCheckpointStore 内存中的断点存储,进程重启后断点丢失
+type MemCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]ReshardCheckpoint
+}
+
+// NewMemCheckpointStore 创建内存中的断点存储
+func NewMemCheckpointStore() *MemCheckpointStore {
+	return &MemCheckpointStore{checkpoints: map[string]ReshardCheckpoint{}}
+}
+
+// LoadCheckpoint implements ReshardCheckpointStore.LoadCheckpoint
+func (p *MemCheckpointStore) LoadCheckpoint(ctx context.Context, task, source string) (*ReshardCheckpoint, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	checkpoint, ok := p.checkpoints[checkpointID(task, source)]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+// SaveCheckpoint implements ReshardCheckpointStore.SaveCheckpoint
+func (p *MemCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *ReshardCheckpoint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checkpoints[checkpoint.ID] = *checkpoint
+	return nil
+}
+
+// DBCheckpointStore 使用数据库表保存断点
+type DBCheckpointStore struct {
+	pool  *Pool
+	table string
+	once  sync.Once
+	err   error
+}
+
+// NewDBCheckpointStore 创建保存在pool中的断点存储,table为空时使用DefaultReshardCheckpointTable,表不存在时自动创建
+func NewDBCheckpointStore(pool *Pool, table string) *DBCheckpointStore {
+	if table == "" {
+		table = DefaultReshardCheckpointTable
+	}
+	return &DBCheckpointStore{pool: pool, table: table}
+}
+
+func (p *DBCheckpointStore) ensureTable(ctx context.Context) error {
+	p.once.Do(func() {
+		stmts, err := createTableSQL(reshardCheckpointMeta, p.table, p.pool.Dialect())
+		if err != nil {
+			p.err = err
+			return
+		}
+		executor := p.pool.NewOp().executor()
+		for _, stmt := range stmts {
+			if _, err = exec(ctx, executor, stmt, nil); err != nil {
+				p.err = err
+				return
+			}
+		}
+	})
+	return p.err
+}
+
+// LoadCheckpoint implements ReshardCheckpointStore.LoadCheckpoint
+func (p *DBCheckpointStore) LoadCheckpoint(ctx context.Context, task, source string) (*ReshardCheckpoint, error) {
+	if err := p.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	executor := p.pool.NewOp().primaryExecutor()
+	querySQL := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", executor.columns(reshardCheckpointMeta.fields), p.table, executor.quote("id"))
+	rows, err := query(ctx, executor, querySQL, []interface{}{checkpointID(task, source)})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	cp := &ReshardCheckpoint{}
+	if err = rows.Scan(&cp.ID, &cp.Task, &cp.Source, &cp.LastKey, &cp.Copied, &cp.Done, &cp.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint implements ReshardCheckpointStore.SaveCheckpoint
+func (p *DBCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *ReshardCheckpoint) error {
+	if err := p.ensureTable(ctx); err != nil {
+		return err
+	}
+	executor := p.pool.NewOp().executor()
+	fields := reshardCheckpointMeta.fields
+	updateColumns := make([]string, 0, len(fields))
+	for _, field := range filterFields(noIDPred, fields) {
+		updateColumns = append(updateColumns, field.column)
+	}
+	upsert, err := executor.dialect.Upsert([]string{"id"}, upsertAssignments(executor, updateColumns, executor.dialect.Excluded))
+	if err != nil {
+		return err
+	}
+	saveSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", p.table, executor.columns(fields), strings.Join(toSlice("?", len(fields)), ",")) + upsert
+	_, err = exec(ctx, executor, saveSQL, buildParamValues(reflect.ValueOf(checkpoint).Elem(), fields))
+	return err
+}
+
+func checkpointID(task, source string) string {
+	return task + "/" + source
+}
+
+// Resharder 按新旧分片规则迁移实体T的数据,新旧规则都需要在EntityShardConfig中配置;
+// 迁移的步骤为:开启双写(ReshardWriteBoth),Copy复制存量数据,Verify校验并修复差异,切换到新规则(ReshardWriteNew)
+type Resharder[T Entity] struct {
+	Task        string                 //任务名称,用于记录断点
+	BatchSize   int                    //每批复制的行数,小于等于0时使用DefaultReshardBatchSize
+	Concurrency int                    //同时复制的源分片数,小于等于0时使用DefaultScatterConcurrency
+	Checkpoints ReshardCheckpointStore //断点存储,为空时不记录断点
+	service     ShardDBService
+	fromRule    string
+	toRule      string
+	mode        atomic.Int32
+}
+
+// NewResharder 创建从fromRule迁移到toRule的Resharder
+func NewResharder[T Entity](service ShardDBService, task, fromRule, toRule string) *Resharder[T] {
+	return &Resharder[T]{Task: task, service: service, fromRule: fromRule, toRule: toRule}
+}
+
+// SetMode 设置写入模式
+func (p *Resharder[T]) SetMode(mode ReshardMode) {
+	p.mode.Store(int32(mode))
+}
+
+// Mode 当前的写入模式
+func (p *Resharder[T]) Mode() ReshardMode {
+	return ReshardMode(p.mode.Load())
+}
+
+func (p *Resharder[T]) batchSize() int {
+	if p.BatchSize <= 0 {
+		return DefaultReshardBatchSize
+	}
+	return p.BatchSize
+}
+
+// ReadOp 按写入模式返回读取entity的Op,只写新规则时使用新规则,否则使用旧规则
+func (p *Resharder[T]) ReadOp(entity T) (*Op, error) {
+	if p.Mode() == ReshardWriteNew {
+		return p.service.NewOpByEntity(entity, p.toRule)
+	}
+	return p.service.NewOpByEntity(entity, p.fromRule)
+}
+
+// Write 按写入模式在entity所在的分片上执行写操作f;双写时f在旧规则的分片上执行,成功后按主键从旧分片读取该行,
+// 同步到新规则的分片(已经删除时从新分片删除),因此f执行后entity的主键及新旧规则的分片字段必须有值
+func (p *Resharder[T]) Write(ctx context.Context, entity T, f func(ctx context.Context, op *Op, entity T) error) error {
+	mode := p.Mode()
+	rule := p.fromRule
+	if mode == ReshardWriteNew {
+		rule = p.toRule
+	}
+	op, err := p.service.NewOpByEntity(entity, rule)
+	if err != nil {
+		return err
+	}
+	if err = f(ctx, op, entity); err != nil {
+		return err
+	}
+	if mode != ReshardWriteBoth {
+		return nil
+	}
+	return p.sync(ctx, findEntityMeta(entity), entity)
+}
+
+// sync 将旧规则分片中entity对应的行同步到新规则的分片,使用entity的分片字段确定新旧分片
+func (p *Resharder[T]) sync(ctx context.Context, m *meta, entity T) error {
+	ctx = ForcePrimary(Unscoped(ctx))
+	id := reflect.ValueOf(entity).Elem().FieldByIndex(m.pkField.index).Interface()
+	probe := p.probe(entity)
+	src, err := p.service.NewOpByEntity(probe, p.fromRule)
+	if err != nil {
+		return err
+	}
+	row, err := GetCtx(ctx, src, probe, id)
+	if err != nil {
+		return err
+	}
+
+	target := p.probe(entity)
+	dst, err := p.service.NewOpByEntity(target, p.toRule)
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		_, err = DelCtx(ctx, dst, target, id)
+		return err
+	}
+	table, err := tblName(target)
+	if err != nil {
+		return err
+	}
+	return copyRows(ctx, dst, m, table, []reflect.Value{reflect.ValueOf(row).Elem()}, true)
+}
+
+// probe 复制entity用于确定分片,不修改entity的分表函数
+func (p *Resharder[T]) probe(entity T) T {
+	probe := newEntity[T]()
+	reflect.ValueOf(probe).Elem().Set(reflect.ValueOf(entity).Elem())
+	return probe
+}
+
+// Copy 按主键顺序分批将旧规则所有分片中的数据复制到新规则的分片,新分片中已经存在的行由双写同步,不会被覆盖;
+// 复制期间被删除的行可能被重新写入新分片,因此切换到ReshardWriteNew前需要再次执行Verify,并通过Write重新同步有差异的行;
+// 设置了Checkpoints时每批复制后记录断点,再次执行时从断点继续,返回本次复制的行数
+func (p *Resharder[T]) Copy(ctx context.Context) (int64, error) {
+	m := findEntityMeta(newEntity[T]())
+	if err := checkReshardPK(m); err != nil {
+		return 0, err
+	}
+	scatter := NewShardScatter[T](p.service, p.fromRule).Concurrency(p.Concurrency)
+	shards, err := scatter.shards()
+	if err != nil {
+		return 0, err
+	}
+
+	var copied atomic.Int64
+	err = scatter.each(ctx, shards, func(ctx context.Context, i int, op *Op, entity T) error {
+		source := shards[i].poolName + "." + shards[i].table
+		n, err := p.copyShard(ctx, m, op, entity, source)
+		copied.Add(n)
+		return err
+	})
+	return copied.Load(), err
+}
+
+// copyShard 复制一个源分片
+func (p *Resharder[T]) copyShard(ctx context.Context, m *meta, op *Op, entity T, source string) (int64, error) {
+	checkpoint := &ReshardCheckpoint{ID: checkpointID(p.Task, source), Task: p.Task, Source: source}
+	if p.Checkpoints != nil {
+		saved, err := p.Checkpoints.LoadCheckpoint(ctx, p.Task, source)
+		if err != nil {
+			return 0, err
+		}
+		if saved != nil {
+			if saved.Done {
+				return 0, nil
+			}
+			checkpoint = saved
+		}
+	}
+
+	var (
+		copied  int64
+		lastKey interface{}
+		err     error
+	)
+	if checkpoint.LastKey != "" {
+		if lastKey, err = parseReshardKey(m.pkField, checkpoint.LastKey); err != nil {
+			return 0, err
+		}
+	}
+
+	ops := map[string]*Op{}
+	for {
+		rows, err := scanBatch(ctx, op, entity, m, lastKey, p.batchSize())
+		if err != nil {
+			return copied, err
+		}
+		if len(rows) > 0 {
+			if err = p.copyBatch(ctx, m, ops, rows); err != nil {
+				return copied, err
+			}
+			copied += int64(len(rows))
+			lastKey = reflect.ValueOf(rows[len(rows)-1]).Elem().FieldByIndex(m.pkField.index).Interface()
+			checkpoint.LastKey = fmt.Sprint(lastKey)
+			checkpoint.Copied += int64(len(rows))
+		}
+		checkpoint.Done = len(rows) < p.batchSize()
+		checkpoint.UpdatedAt = c.UnixMills(time.Now())
+		if p.Checkpoints != nil {
+			if err = p.Checkpoints.SaveCheckpoint(ctx, checkpoint); err != nil {
+				return copied, err
+			}
+		}
+		if checkpoint.Done {
+			c.Infof("reshard %s copy %s done,rows:%d", p.Task, source, checkpoint.Copied)
+			return copied, nil
+		}
+	}
+}
+
+// copyBatch 将一批数据按新规则分组后写入目标分片
+func (p *Resharder[T]) copyBatch(ctx context.Context, m *meta, ops map[string]*Op, rows []T) error {
+	type target struct {
+		poolName string
+		table    string
+	}
+	var (
+		targets []target
+		groups  = map[target][]reflect.Value{}
+	)
+	for _, row := range rows {
+		poolName, err := p.service.setupTableShard(row, p.toRule)
+		if err != nil {
+			return err
+		}
+		table, err := tblName(row)
+		if err != nil {
+			return err
+		}
+		t := target{poolName: poolName, table: table}
+		if _, ok := groups[t]; !ok {
+			targets = append(targets, t)
+		}
+		groups[t] = append(groups[t], reflect.ValueOf(row).Elem())
+	}
+
+	for _, t := range targets {
+		op := ops[t.poolName]
+		if op == nil {
+			var err error
+			if op, err = p.service.NewOpByShardName(t.poolName); err != nil {
+				return err
+			}
+			ops[t.poolName] = op
+		}
+		if err := copyRows(ctx, op, m, t.table, groups[t], false); err != nil {
+			return fmt.Errorf("copy to %s.%s fail,err:%w", t.poolName, t.table, err)
+		}
+	}
+	return nil
+}
+
+// ReshardShardReport 一个目标分片的校验结果
+type ReshardShardReport struct {
+	Pool           string
+	Table          string
+	SourceRows     int64  //源分片中应该迁移到该分片的行数
+	TargetRows     int64  //目标分片中的行数
+	SourceChecksum uint64 //源分片中应该迁移到该分片的行的校验和
+	TargetChecksum uint64 //目标分片中的行的校验和
+}
+
+// OK 行数及校验和是否一致
+func (p *ReshardShardReport) OK() bool {
+	return p.SourceRows == p.TargetRows && p.SourceChecksum == p.TargetChecksum
+}
+
+// ReshardReport 校验结果
+type ReshardReport struct {
+	Shards []*ReshardShardReport
+}
+
+// OK 所有目标分片的校验是否都一致
+func (p *ReshardReport) OK() bool {
+	for _, shard := range p.Shards {
+		if !shard.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify 按目标分片比较源数据与目标数据的行数及校验和,校验和与行的顺序无关
+func (p *Resharder[T]) Verify(ctx context.Context) (*ReshardReport, error) {
+	m := findEntityMeta(newEntity[T]())
+	if err := checkReshardPK(m); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		reports = map[string]*ReshardShardReport{}
+	)
+	report := func(poolName, table string) *ReshardShardReport {
+		key := poolName + "." + table
+		r := reports[key]
+		if r == nil {
+			r = &ReshardShardReport{Pool: poolName, Table: table}
+			reports[key] = r
+		}
+		return r
+	}
+
+	source := NewShardScatter[T](p.service, p.fromRule).Concurrency(p.Concurrency)
+	err := source.EachCtx(ctx, func(ctx context.Context, op *Op, entity T) error {
+		return scanAll(ctx, op, entity, m, p.batchSize(), func(rows []T) error {
+			for _, row := range rows {
+				sum := rowChecksum(m, reflect.ValueOf(row).Elem())
+				poolName, err := p.service.setupTableShard(row, p.toRule)
+				if err != nil {
+					return err
+				}
+				table, err := tblName(row)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				r := report(poolName, table)
+				r.SourceRows++
+				r.SourceChecksum += sum
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	target := NewShardScatter[T](p.service, p.toRule).Concurrency(p.Concurrency)
+	shards, err := target.shards()
+	if err != nil {
+		return nil, err
+	}
+	err = target.each(ctx, shards, func(ctx context.Context, i int, op *Op, entity T) error {
+		var (
+			rows int64
+			sum  uint64
+		)
+		err := scanAll(ctx, op, entity, m, p.batchSize(), func(batch []T) error {
+			for _, row := range batch {
+				rows++
+				sum += rowChecksum(m, reflect.ValueOf(row).Elem())
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		r := report(shards[i].poolName, shards[i].table)
+		r.TargetRows += rows
+		r.TargetChecksum += sum
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &ReshardReport{Shards: make([]*ReshardShardReport, 0, len(reports))}
+	for _, r := range reports {
+		ret.Shards = append(ret.Shards, r)
+	}
+	sort.Slice(ret.Shards, func(i, j int) bool {
+		if ret.Shards[i].Pool != ret.Shards[j].Pool {
+			return ret.Shards[i].Pool < ret.Shards[j].Pool
+		}
+		return ret.Shards[i].Table < ret.Shards[j].Table
+	})
+	return ret, nil
+}
+
+// checkReshardPK 迁移按主键分批,主键必须是整数或者字符串
+func checkReshardPK(m *meta) error {
+	switch m.pkField.structField.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+		return nil
+	}
+	return fmt.Errorf("unsupported reshard pk type %s of %s", m.pkField.structField.Type, m.name)
+}
+
+// parseReshardKey 将断点中的主键转为主键字段的类型
+func parseReshardKey(field *metaField, key string) (interface{}, error) {
+	typ := field.structField.Type
+	switch typ.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(typ).Interface(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(v).Convert(typ).Interface(), nil
+	}
+	v, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Convert(typ).Interface(), nil
+}
+
+// scanBatch 按主键顺序查询主键大于lastKey的size行,包括软删除的行
+func scanBatch[T Entity](ctx context.Context, op *Op, entity T, m *meta, lastKey interface{}, size int) ([]T, error) {
+	b := FromEntity(entity).OrderBy(m.pkField.column).Limit(size)
+	if lastKey != nil {
+		b.Where(Gt(m.pkField.column, lastKey))
+	}
+	return b.FindCtx(Unscoped(ctx), op)
+}
+
+// scanAll 按主键顺序分批遍历分表的所有行
+func scanAll[T Entity](ctx context.Context, op *Op, entity T, m *meta, size int, f func([]T) error) error {
+	var lastKey interface{}
+	for {
+		rows, err := scanBatch(ctx, op, entity, m, lastKey, size)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err = f(rows); err != nil {
+				return err
+			}
+			lastKey = reflect.ValueOf(rows[len(rows)-1]).Elem().FieldByIndex(m.pkField.index).Interface()
+		}
+		if len(rows) < size {
+			return nil
+		}
+	}
+}
+
+// copyRows 使用包括主键在内的所有列将行写入table,主键冲突时overwrite为true则覆盖,否则保留已有的行,不执行钩子及自动时间等处理
+func copyRows(ctx context.Context, op *Op, m *meta, table string, rows []reflect.Value, overwrite bool) error {
+	executor := op.executor()
+	rowParams := "(" + strings.Join(toSlice("?", len(m.fields)), ",") + ")"
+	params := make([]interface{}, 0, len(rows)*len(m.fields))
+	for _, ind := range rows {
+		params = append(params, buildParamValues(ind, m.fields)...)
+	}
+	// 不覆盖时冲突的行保持不变
+	pk := executor.quote(m.pkField.column)
+	assignments := []string{pk + "=" + table + "." + pk}
+	if overwrite {
+		updateColumns := make([]string, 0, len(m.fields))
+		for _, field := range filterFields(noIDPred, m.fields) {
+			updateColumns = append(updateColumns, field.column)
+		}
+		assignments = upsertAssignments(executor, updateColumns, executor.dialect.Excluded)
+	}
+	upsert, err := executor.dialect.Upsert([]string{m.pkField.column}, assignments)
+	if err != nil {
+		return err
+	}
+	copySQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, executor.columns(m.fields), strings.Join(toSlice(rowParams, len(rows)), ",")) + upsert
+
+	ctx, cancel := op.stmtContext(ctx)
+	defer cancel()
+	_, err = exec(ctx, executor, copySQL, params)
+	return err
+}
+
+// rowChecksum 行的校验和
+func rowChecksum(m *meta, ind reflect.Value) uint64 {
+	h := fnv.New64a()
+	for _, field := range m.fields {
+		v := sortValue(ind.FieldByIndex(field.index))
+		if t, ok := v.(time.Time); ok {
+			v = t.UnixNano()
+		}
+		fmt.Fprintf(h, "%v\x00", v)
+	}
+	return h.Sum64()
+}
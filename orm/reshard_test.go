@@ -0,0 +1,236 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reshardModel struct {
+	BaseShardEntity
+	ID   int64  `column:"id" pk:"y" pkAuto:"n"`
+	Name string `column:"name"`
+}
+
+func (p *reshardModel) TableName() string {
+	return "reshard_model"
+}
+
+func TestResharder(t *testing.T) {
+	AddMeta(&reshardModel{})
+
+	conf := &shardConf{}
+	conf.DBShards = &DBShardConfig{Shards: map[string]*DBConfig{"s0": {URL: "s0", Schema: "s0"}}, Default: "s0"}
+	conf.EntityShards = &EntityShardConfig{Entities: map[string]map[string][]*EntityShardRuleConfig{
+		"github.com/d0ngw/go/orm": {
+			"reshardModel": {
+				{
+					Name:       "v1",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 2, NamePrefix: "reshard_model_", FieldName: "id"}},
+				},
+				{
+					Name:       "v2",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 3, NamePrefix: "reshard_model_v2_", FieldName: "id"}},
+				},
+			},
+		},
+	}}
+	assert.NoError(t, conf.DBShards.Parse())
+	assert.NoError(t, conf.EntityShards.Parse())
+
+	service := NewSimpleShardDBService(func(*DBConfig) (*Pool, error) {
+		return dbpool, nil
+	})
+	service.DBShardConfig = conf
+	service.EntityShardConfig = conf
+	assert.NoError(t, service.Init())
+
+	for _, table := range []string{"reshard_model_0", "reshard_model_1", "reshard_model_v2_0", "reshard_model_v2_1", "reshard_model_v2_2"} {
+		table := table
+		m := &reshardModel{}
+		m.SetTableShardFunc(func() (string, error) { return table, nil })
+		createTables(t, m)
+	}
+	defer dbpool.db.Exec(DropTableSQL(DefaultReshardCheckpointTable))
+
+	for i := int64(1); i <= 7; i++ {
+		m := &reshardModel{ID: i, Name: fmt.Sprintf("n%d", i)}
+		op, err := service.NewOpByEntity(m, "v1")
+		assert.NoError(t, err)
+		assert.NoError(t, Add(op, m))
+	}
+
+	ctx := context.Background()
+	resharder := NewResharder[*reshardModel](service, "grow", "v1", "v2")
+	resharder.BatchSize = 3
+	resharder.Checkpoints = NewDBCheckpointStore(dbpool, "")
+
+	report, err := resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+
+	copied, err := resharder.Copy(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 7, copied)
+
+	report, err = resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Len(t, report.Shards, 3)
+
+	checkpoint, err := resharder.Checkpoints.LoadCheckpoint(ctx, "grow", "s0.reshard_model_0")
+	assert.NoError(t, err)
+	assert.True(t, checkpoint.Done)
+	assert.EqualValues(t, 3, checkpoint.Copied)
+	assert.Equal(t, "6", checkpoint.LastKey)
+
+	copied, err = resharder.Copy(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, copied)
+
+	resharder.SetMode(ReshardWriteBoth)
+	err = resharder.Write(ctx, &reshardModel{ID: 8, Name: "n8"}, func(ctx context.Context, op *Op, entity *reshardModel) error {
+		return AddCtx(ctx, op, entity)
+	})
+	assert.NoError(t, err)
+	err = resharder.Write(ctx, &reshardModel{ID: 2, Name: "u2"}, func(ctx context.Context, op *Op, entity *reshardModel) error {
+		_, err := UpdateCtx(ctx, op, entity)
+		return err
+	})
+	assert.NoError(t, err)
+	err = resharder.Write(ctx, &reshardModel{ID: 1}, func(ctx context.Context, op *Op, entity *reshardModel) error {
+		_, err := DelCtx(ctx, op, entity, entity.ID)
+		return err
+	})
+	assert.NoError(t, err)
+
+	report, err = resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+
+	resharder.SetMode(ReshardWriteNew)
+	m := &reshardModel{ID: 2}
+	op, err := resharder.ReadOp(m)
+	assert.NoError(t, err)
+	e, err := Get(op, m, m.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "u2", e.(*reshardModel).Name)
+	table, _ := tblName(m)
+	assert.Equal(t, "reshard_model_v2_2", table)
+
+	_, err = dbpool.db.Exec("UPDATE reshard_model_v2_2 SET name='x' WHERE id=5")
+	assert.NoError(t, err)
+	report, err = resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	for _, shard := range report.Shards {
+		assert.Equal(t, shard.Table != "reshard_model_v2_2", shard.OK(), shard.Table)
+	}
+}
+
+type reshardUserModel struct {
+	BaseShardEntity
+	ID     int64  `column:"id" pk:"y" pkAuto:"n"`
+	UserID int64  `column:"user_id"`
+	Name   string `column:"name"`
+}
+
+func (p *reshardUserModel) TableName() string {
+	return "reshard_user_model"
+}
+
+func TestResharderShardField(t *testing.T) {
+	AddMeta(&reshardUserModel{})
+
+	conf := &shardConf{}
+	conf.DBShards = &DBShardConfig{Shards: map[string]*DBConfig{"s0": {URL: "s0", Schema: "s0"}}, Default: "s0"}
+	conf.EntityShards = &EntityShardConfig{Entities: map[string]map[string][]*EntityShardRuleConfig{
+		"github.com/d0ngw/go/orm": {
+			"reshardUserModel": {
+				{
+					Name:       "v1",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 2, NamePrefix: "reshard_user_model_", FieldName: "user_id"}},
+				},
+				{
+					Name:       "v2",
+					DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+					TableShard: &OneRule{Hash: &HashRule{Count: 3, NamePrefix: "reshard_user_model_v2_", FieldName: "user_id"}},
+				},
+			},
+		},
+	}}
+	assert.NoError(t, conf.DBShards.Parse())
+	assert.NoError(t, conf.EntityShards.Parse())
+
+	service := NewSimpleShardDBService(func(*DBConfig) (*Pool, error) {
+		return dbpool, nil
+	})
+	service.DBShardConfig = conf
+	service.EntityShardConfig = conf
+	assert.NoError(t, service.Init())
+
+	for _, table := range []string{"reshard_user_model_0", "reshard_user_model_1", "reshard_user_model_v2_0", "reshard_user_model_v2_1", "reshard_user_model_v2_2"} {
+		table := table
+		m := &reshardUserModel{}
+		m.SetTableShardFunc(func() (string, error) { return table, nil })
+		createTables(t, m)
+	}
+
+	ctx := context.Background()
+	resharder := NewResharder[*reshardUserModel](service, "user", "v1", "v2")
+	resharder.SetMode(ReshardWriteBoth)
+	write := func(m *reshardUserModel, f func(ctx context.Context, op *Op, entity *reshardUserModel) error) {
+		assert.NoError(t, resharder.Write(ctx, m, f))
+	}
+	for i := int64(1); i <= 4; i++ {
+		write(&reshardUserModel{ID: i, UserID: i + 10, Name: fmt.Sprintf("n%d", i)}, func(ctx context.Context, op *Op, entity *reshardUserModel) error {
+			return AddCtx(ctx, op, entity)
+		})
+	}
+	write(&reshardUserModel{ID: 2, UserID: 12, Name: "u2"}, func(ctx context.Context, op *Op, entity *reshardUserModel) error {
+		_, err := UpdateCtx(ctx, op, entity)
+		return err
+	})
+	write(&reshardUserModel{ID: 3, UserID: 13}, func(ctx context.Context, op *Op, entity *reshardUserModel) error {
+		_, err := DelCtx(ctx, op, entity, entity.ID)
+		return err
+	})
+
+	// 按user_id分片,行同步到user_id所在的新分片
+	report, err := resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	var rows int64
+	for _, shard := range report.Shards {
+		rows += shard.TargetRows
+	}
+	assert.EqualValues(t, 3, rows)
+
+	var count int
+	assert.NoError(t, dbpool.db.QueryRow("SELECT COUNT(*) FROM reshard_user_model_v2_0 WHERE id = 2 AND name = 'u2'").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// Copy读到旧数据时不覆盖双写同步的行,差异由Verify发现后重新同步
+	_, err = dbpool.db.Exec("UPDATE reshard_user_model_0 SET name = 'stale' WHERE id = 2")
+	assert.NoError(t, err)
+	copied, err := resharder.Copy(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, copied)
+	assert.NoError(t, dbpool.db.QueryRow("SELECT COUNT(*) FROM reshard_user_model_v2_0 WHERE id = 2 AND name = 'u2'").Scan(&count))
+	assert.Equal(t, 1, count)
+	report, err = resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+
+	write(&reshardUserModel{ID: 2, UserID: 12}, func(ctx context.Context, op *Op, entity *reshardUserModel) error {
+		return nil
+	})
+	report, err = resharder.Verify(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+}
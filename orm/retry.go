@@ -0,0 +1,56 @@
+package orm
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// TxRetryPolicy 事务的重试策略,DoInTrans开始的事务因为死锁等错误失败时,回滚后等待一段时间重新执行整个函数;
+// 加入已有事务或者使用保存点时不重试,由最外层的事务重试;回滚时事务中更新成功的实体的版本号恢复为更新前的值,
+// 其他在函数中修改的实体字段不会恢复,重试的函数需要重新设置或者重新加载实体
+type TxRetryPolicy struct {
+	MaxAttempts int                  //最多执行的次数,<=1时不重试
+	BaseDelay   time.Duration        //第一次重试前等待的时间,之后每次翻倍,<=0时使用DefaultTxRetryPolicy的配置
+	MaxDelay    time.Duration        //最长的等待时间,<=0时使用DefaultTxRetryPolicy的配置
+	Retryable   func(err error) bool //是否重试,为nil时使用IsRetryable
+}
+
+// DefaultTxRetryPolicy 重试策略中未设置的项使用的默认值,默认不重试
+var DefaultTxRetryPolicy = TxRetryPolicy{
+	MaxAttempts: 1,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// withDefault 使用DefaultTxRetryPolicy填充未设置的项
+func (p TxRetryPolicy) withDefault() TxRetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultTxRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultTxRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultTxRetryPolicy.MaxDelay
+	}
+	if p.Retryable == nil {
+		p.Retryable = DefaultTxRetryPolicy.Retryable
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	return p
+}
+
+// backoff 第attempt次执行失败后等待的时间,在[delay/2,delay]之间随机,避免冲突的事务同时重试
+func (p TxRetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
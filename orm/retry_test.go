@@ -0,0 +1,198 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+type sqlStateErr string
+
+func (p sqlStateErr) Error() string {
+	return "sql state " + string(p)
+}
+
+func (p sqlStateErr) SQLState() string {
+	return string(p)
+}
+
+func TestClassifyError(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	assert.Equal(t, ErrorDeadlock, ClassifyError(deadlock))
+	assert.Equal(t, ErrorLockTimeout, ClassifyError(&mysql.MySQLError{Number: 1205}))
+	assert.Equal(t, ErrorDuplicateKey, ClassifyError(&mysql.MySQLError{Number: 1062}))
+	assert.Equal(t, ErrorUnknown, ClassifyError(&mysql.MySQLError{Number: 1054}))
+	assert.Equal(t, ErrorUnknown, ClassifyError(nil))
+	assert.Equal(t, ErrorUnknown, ClassifyError(errors.New("other")))
+	assert.Equal(t, ErrorUnknown, ClassifyError(context.DeadlineExceeded))
+
+	assert.Equal(t, ErrorConnectionLost, ClassifyError(driver.ErrBadConn))
+	assert.Equal(t, ErrorConnectionLost, ClassifyError(mysql.ErrInvalidConn))
+	assert.Equal(t, ErrorDuplicateKey, ClassifyError(sqlStateErr("23505")))
+	assert.Equal(t, ErrorDeadlock, ClassifyError(sqlStateErr("40P01")))
+	assert.Equal(t, ErrorLockTimeout, ClassifyError(sqlStateErr("55P03")))
+	assert.Equal(t, ErrorConnectionLost, ClassifyError(sqlStateErr("08006")))
+
+	dbErr := NewDBErrorf(fmt.Errorf("add fail:%w", deadlock), "add")
+	assert.Equal(t, ErrorDeadlock, dbErr.Kind())
+	assert.True(t, dbErr.IsDeadlock())
+	assert.False(t, dbErr.IsDuplicateKey())
+	assert.False(t, dbErr.IsLockTimeout())
+	assert.False(t, dbErr.IsConnectionLost())
+	assert.True(t, IsDeadlock(dbErr))
+	assert.True(t, IsRetryable(dbErr))
+	assert.True(t, IsRetryable(&mysql.MySQLError{Number: 1205}))
+	assert.False(t, IsRetryable(&mysql.MySQLError{Number: 1062}))
+	assert.Equal(t, "deadlock", ErrorDeadlock.String())
+}
+
+func TestTxRetryPolicy(t *testing.T) {
+	policy := TxRetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond}.withDefault()
+	assert.Equal(t, 1, policy.MaxAttempts)
+	assert.NotNil(t, policy.Retryable)
+	for i, limit := range []time.Duration{10, 20, 40, 40, 40} {
+		attempt := i + 1
+		for j := 0; j < 20; j++ {
+			delay := policy.backoff(attempt)
+			assert.True(t, delay >= limit*time.Millisecond/2 && delay <= limit*time.Millisecond, "attempt %d delay %v", attempt, delay)
+		}
+	}
+}
+
+func TestDoInTransRetry(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&fakeUser{})
+	fake := NewFakeDB()
+	op := fake.NewPool("retry").NewOp()
+
+	// 默认不重试
+	attempts := 0
+	_, err := op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		return nil, &mysql.MySQLError{Number: 1213}
+	})
+	assert.True(t, IsDeadlock(err))
+	assert.Equal(t, 1, attempts)
+
+	op.SetTxRetryPolicy(TxRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	fake.Reset()
+	attempts = 0
+	rt, err := op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		if err := Add(op, &fakeUser{Name: "alice"}); err != nil {
+			return nil, err
+		}
+		if attempts < 3 {
+			return nil, &mysql.MySQLError{Number: 1213}
+		}
+		return attempts, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rt)
+	n, err := From[*fakeUser]().Count(op)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	fake.AssertRolledBack(t, 2)
+	fake.AssertCommitted(t, 1)
+
+	// 回滚后恢复实体的版本号,重试时使用原版本号更新
+	users, err := From[*fakeUser]().Where(Eq("name", "alice")).Find(op)
+	assert.NoError(t, err)
+	alice := users[0]
+	attempts = 0
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		alice.Age = attempts
+		if _, err := Update(op, alice); err != nil {
+			return nil, err
+		}
+		assert.EqualValues(t, 1, alice.Version)
+		if attempts < 2 {
+			return nil, &mysql.MySQLError{Number: 1213}
+		}
+		return op.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			if _, err := Update(op, alice); err != nil {
+				return nil, err
+			}
+			assert.EqualValues(t, 2, alice.Version)
+			return nil, errors.New("nested fail")
+		})
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.EqualValues(t, 0, alice.Version)
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		if _, err := Update(op, alice); err != nil {
+			return nil, err
+		}
+		_, err := op.DoInTransWith(PropagationNested, func(tx *sql.Tx) (interface{}, error) {
+			if _, err := Update(op, alice); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("nested fail")
+		})
+		assert.Error(t, err)
+		assert.EqualValues(t, 1, alice.Version)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	e, err := Get(op, &fakeUser{}, alice.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, e.(*fakeUser).Version)
+	assert.EqualValues(t, 1, alice.Version)
+
+	// 超过最多执行的次数
+	attempts = 0
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		return nil, NewDBError(&mysql.MySQLError{Number: 1205}, "update")
+	})
+	assert.True(t, IsLockTimeout(err))
+	assert.Equal(t, 3, attempts)
+
+	// 不可重试的错误
+	attempts = 0
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		return nil, Add(op, &fakeUser{Name: "alice"})
+	})
+	assert.True(t, IsDuplicateKey(err))
+	assert.Equal(t, 1, attempts)
+
+	// 加入已有的事务时由外层的事务重试
+	outer, inner := 0, 0
+	_, err = op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+		outer++
+		return op.DoInTrans(func(tx *sql.Tx) (interface{}, error) {
+			inner++
+			if outer < 2 {
+				return nil, &mysql.MySQLError{Number: 1213}
+			}
+			return nil, nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, outer)
+	assert.Equal(t, 2, inner)
+
+	// ctx结束时不再重试
+	op.SetTxRetryPolicy(TxRetryPolicy{MaxAttempts: 3, BaseDelay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	attempts = 0
+	start := time.Now()
+	_, err = op.DoInTransCtx(ctx, nil, func(tx *sql.Tx) (interface{}, error) {
+		attempts++
+		return nil, &mysql.MySQLError{Number: 1213}
+	})
+	assert.True(t, IsDeadlock(err))
+	assert.Equal(t, 1, attempts)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,356 @@
+package orm
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScatterConcurrency 跨分片执行的默认并发数
+const DefaultScatterConcurrency = 8
+
+// ShardScatter 跨分片执行器,在实体分片规则对应的所有分库分表上并发执行查询并合并结果
+type ShardScatter[T Entity] struct {
+	service     ShardDBService
+	ruleName    string
+	concurrency int
+}
+
+// scatterShard 一个分库中的一张分表
+type scatterShard struct {
+	poolName string
+	table    string
+}
+
+// NewShardScatter 创建T的跨分片执行器,ruleName为空时使用默认的分片规则
+func NewShardScatter[T Entity](service ShardDBService, ruleName string) *ShardScatter[T] {
+	return &ShardScatter[T]{service: service, ruleName: ruleName, concurrency: DefaultScatterConcurrency}
+}
+
+// Concurrency 设置同时执行的分片数,小于等于0时使用DefaultScatterConcurrency
+func (p *ShardScatter[T]) Concurrency(concurrency int) *ShardScatter[T] {
+	if concurrency <= 0 {
+		concurrency = DefaultScatterConcurrency
+	}
+	p.concurrency = concurrency
+	return p
+}
+
+// shards 按分库名称及分表顺序列出所有分片
+func (p *ShardScatter[T]) shards() ([]scatterShard, error) {
+	if p.service == nil {
+		return nil, fmt.Errorf("no shard db service")
+	}
+	tables, err := p.service.shardTables(newEntity[T](), p.ruleName)
+	if err != nil {
+		return nil, err
+	}
+	poolNames := make([]string, 0, len(tables))
+	for poolName := range tables {
+		poolNames = append(poolNames, poolName)
+	}
+	sort.Strings(poolNames)
+
+	var shards []scatterShard
+	for _, poolName := range poolNames {
+		for _, table := range tables[poolName] {
+			shards = append(shards, scatterShard{poolName: poolName, table: table})
+		}
+	}
+	return shards, nil
+}
+
+// bind 创建绑定到分表table的实体
+func (p *ShardScatter[T]) bind(table string) (T, error) {
+	entity := newEntity[T]()
+	return entity, bindTable(entity, table)
+}
+
+// bindTable 将实体绑定到分表table,不是ShardEntity的实体只能使用自身的表
+func bindTable(entity Entity, table string) error {
+	if shardEntity, ok := entity.(ShardEntity); ok {
+		shardEntity.SetTableShardFunc(func() (string, error) {
+			return table, nil
+		})
+	} else if entity.TableName() != table {
+		return fmt.Errorf("%T is not a ShardEntity,can't query table %s", entity, table)
+	}
+	return nil
+}
+
+// Each 在每个分片上执行f,参见EachCtx
+func (p *ShardScatter[T]) Each(f func(ctx context.Context, op *Op, entity T) error) error {
+	return p.EachCtx(context.Background(), f)
+}
+
+// EachCtx 在每个分片上并发执行f,entity为绑定到该分片分表的实体;任一分片出错时取消其他分片并返回第一个错误
+func (p *ShardScatter[T]) EachCtx(ctx context.Context, f func(ctx context.Context, op *Op, entity T) error) error {
+	shards, err := p.shards()
+	if err != nil {
+		return err
+	}
+	return p.each(ctx, shards, func(ctx context.Context, _ int, op *Op, entity T) error {
+		return f(ctx, op, entity)
+	})
+}
+
+func (p *ShardScatter[T]) each(ctx context.Context, shards []scatterShard, f func(ctx context.Context, i int, op *Op, entity T) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := p.concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultScatterConcurrency
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i, shard := range shards {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, shard scatterShard) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			op, err := p.service.NewOpByShardName(shard.poolName)
+			if err == nil {
+				var entity T
+				if entity, err = p.bind(shard.table); err == nil {
+					err = f(ctx, i, op, entity)
+				}
+			}
+			if err != nil {
+				fail(fmt.Errorf("scatter on %s.%s fail,err:%w", shard.poolName, shard.table, err))
+			}
+		}(i, shard)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// Find 在所有分片上查询,参见FindCtx
+func (p *ShardScatter[T]) Find(b *QueryBuilder[T]) ([]T, error) {
+	return p.FindCtx(context.Background(), b)
+}
+
+// FindCtx 在所有分片上执行b的查询并合并结果;设置了OrderBy时按全局顺序归并,否则按分片顺序拼接;
+// Limit和Offset作用于合并后的结果,每个分片最多查询Limit+Offset条
+func (p *ShardScatter[T]) FindCtx(ctx context.Context, b *QueryBuilder[T]) ([]T, error) {
+	m := findEntityMeta(b.entity)
+	orders, err := b.scatterOrders(m)
+	if err != nil {
+		return nil, err
+	}
+	shards, err := p.shards()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]T, len(shards))
+	err = p.each(ctx, shards, func(ctx context.Context, i int, op *Op, entity T) error {
+		shardBuilder := *b
+		shardBuilder.entity = entity
+		shardBuilder.offset = 0
+		if b.limit > 0 {
+			shardBuilder.limit = b.limit + b.offset
+		}
+		ret, err := shardBuilder.FindCtx(ctx, op)
+		results[i] = ret
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []T
+	for _, ret := range results {
+		merged = append(merged, ret...)
+	}
+	if len(orders) > 0 {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return compareByOrders(orders, reflect.ValueOf(merged[i]).Elem(), reflect.ValueOf(merged[j]).Elem()) < 0
+		})
+	}
+
+	if b.offset >= len(merged) {
+		return []T{}, nil
+	}
+	merged = merged[b.offset:]
+	if b.limit > 0 && b.limit < len(merged) {
+		merged = merged[:b.limit]
+	}
+	return merged, nil
+}
+
+// Count 统计所有分片,参见CountCtx
+func (p *ShardScatter[T]) Count(b *QueryBuilder[T]) (int64, error) {
+	return p.CountCtx(context.Background(), b)
+}
+
+// CountCtx 在所有分片上统计满足b条件的条数并求和,忽略OrderBy,Limit和Offset
+func (p *ShardScatter[T]) CountCtx(ctx context.Context, b *QueryBuilder[T]) (int64, error) {
+	shards, err := p.shards()
+	if err != nil {
+		return 0, err
+	}
+	counts := make([]int64, len(shards))
+	err = p.each(ctx, shards, func(ctx context.Context, i int, op *Op, entity T) error {
+		shardBuilder := *b
+		shardBuilder.entity = entity
+		count, err := shardBuilder.CountCtx(ctx, op)
+		counts[i] = count
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
+
+// scatterOrder 归并时的排序字段
+type scatterOrder struct {
+	field *metaField
+	desc  bool
+}
+
+// scatterOrders 解析归并时的排序字段,排序列必须在查询的列中
+func (p *QueryBuilder[T]) scatterOrders(m *meta) ([]scatterOrder, error) {
+	orders := make([]scatterOrder, 0, len(p.orders))
+	for _, order := range p.orders {
+		column, desc := strings.TrimPrefix(order, "-"), strings.HasPrefix(order, "-")
+		field, ok := m.columnFields[column]
+		if !ok {
+			return nil, fmt.Errorf("can't find column %s in %s", column, m.name)
+		}
+		if len(p.columns) > 0 && !slices.Contains(p.columns, column) {
+			return nil, fmt.Errorf("order column %s must be selected", column)
+		}
+		orders = append(orders, scatterOrder{field: field, desc: desc})
+	}
+	return orders, nil
+}
+
+// compareByOrders 按排序字段比较两个实体
+func compareByOrders(orders []scatterOrder, a, b reflect.Value) int {
+	for _, order := range orders {
+		ret := compareValues(sortValue(a.FieldByIndex(order.field.index)), sortValue(b.FieldByIndex(order.field.index)))
+		if order.desc {
+			ret = -ret
+		}
+		if ret != 0 {
+			return ret
+		}
+	}
+	return 0
+}
+
+// sortValue 将字段值转为可比较的值,NULL为nil
+func sortValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		return dv
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return v.Interface()
+}
+
+// compareValues 比较两个值,nil最小
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	switch av := a.(type) {
+	case int64:
+		if bv, ok := b.(int64); ok {
+			return cmp.Compare(av, bv)
+		}
+	case uint64:
+		if bv, ok := b.(uint64); ok {
+			return cmp.Compare(av, bv)
+		}
+	case float64:
+		if bv, ok := b.(float64); ok {
+			return cmp.Compare(av, bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case []byte:
+		if bv, ok := b.([]byte); ok {
+			return bytes.Compare(av, bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok && av != bv {
+			if av {
+				return 1
+			}
+			return -1
+		}
+		return 0
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return av.Compare(bv)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
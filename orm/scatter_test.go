@@ -0,0 +1,97 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type scatterModel struct {
+	BaseShardEntity
+	ID    int64  `column:"id" pk:"y" pkAuto:"n"`
+	Name  string `column:"name"`
+	Score int64  `column:"score"`
+}
+
+func (p *scatterModel) TableName() string {
+	return "scatter_model"
+}
+
+func TestShardScatter(t *testing.T) {
+	AddMeta(&scatterModel{})
+
+	conf := &shardConf{}
+	conf.DBShards = &DBShardConfig{Shards: map[string]*DBConfig{"s0": {URL: "s0", Schema: "s0"}}, Default: "s0"}
+	conf.EntityShards = &EntityShardConfig{Entities: map[string]map[string][]*EntityShardRuleConfig{
+		"github.com/d0ngw/go/orm": {
+			"scatterModel": {{
+				Name:       "scatter",
+				DBShard:    &OneRule{Named: &NamedRule{Name: "s0"}},
+				TableShard: &OneRule{Hash: &HashRule{Count: 3, NamePrefix: "scatter_model_", FieldName: "id"}},
+			}},
+		},
+	}}
+	assert.NoError(t, conf.DBShards.Parse())
+	assert.NoError(t, conf.EntityShards.Parse())
+
+	service := NewSimpleShardDBService(func(*DBConfig) (*Pool, error) {
+		return dbpool, nil
+	})
+	service.DBShardConfig = conf
+	service.EntityShardConfig = conf
+	assert.NoError(t, service.Init())
+
+	for i := 0; i < 3; i++ {
+		table := fmt.Sprintf("scatter_model_%d", i)
+		m := &scatterModel{}
+		m.SetTableShardFunc(func() (string, error) { return table, nil })
+		createTables(t, m)
+	}
+
+	for i := int64(1); i <= 10; i++ {
+		m := &scatterModel{ID: i, Name: fmt.Sprintf("n%d", i%2), Score: (i * 7) % 11}
+		op, err := service.NewOpByEntity(m, "scatter")
+		assert.NoError(t, err)
+		assert.NoError(t, Add(op, m))
+	}
+
+	scatter := NewShardScatter[*scatterModel](service, "scatter").Concurrency(2)
+	count, err := scatter.Count(From[*scatterModel]())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, count)
+
+	count, err = scatter.Count(From[*scatterModel]().Where(Eq("name", "n1")))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, count)
+
+	// score: 1->7,2->3,3->10,4->6,5->2,6->9,7->5,8->1,9->8,10->4
+	found, err := scatter.Find(From[*scatterModel]().OrderBy("-score").Limit(3).Offset(1))
+	assert.NoError(t, err)
+	var ids []int64
+	for _, m := range found {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []int64{6, 9, 1}, ids)
+
+	found, err = scatter.Find(From[*scatterModel]().Where(Eq("name", "n0")).OrderBy("name", "score"))
+	assert.NoError(t, err)
+	ids = ids[:0]
+	for _, m := range found {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []int64{8, 2, 10, 4, 6}, ids)
+
+	found, err = scatter.Find(From[*scatterModel]().Offset(20))
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, err = scatter.Find(From[*scatterModel]().Select("id").OrderBy("score"))
+	assert.Error(t, err)
+
+	err = scatter.EachCtx(context.Background(), func(ctx context.Context, op *Op, entity *scatterModel) error {
+		return fmt.Errorf("fail")
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,309 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	nullTimeType    = reflect.TypeOf(sql.NullTime{})
+	nullStringType  = reflect.TypeOf(sql.NullString{})
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullInt32Type   = reflect.TypeOf(sql.NullInt32{})
+	nullInt16Type   = reflect.TypeOf(sql.NullInt16{})
+	nullByteType    = reflect.TypeOf(sql.NullByte{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+)
+
+const defaultStringSize = 255
+
+// CreateTableSQL 根据实体的元数据生成建表语句,dialect为nil时使用MySQLDialect;
+// 表名由实体确定(分表的实体需先设置TableShardFunc),返回的第一条是CREATE TABLE语句,其后为创建索引的语句.
+//
+// 列的定义可以通过以下tag调整:
+//
+//	type     列的类型,如 type:"varchar(32)",为空时根据字段类型推断,无法推断的类型(如Valuer)必须指定
+//	size     字符串类型的长度,默认为255
+//	nullable 是否允许NULL,y/n,sql.NullXXX类型默认为y,其余默认为n
+//	index    索引名称,y表示使用idx_列名,名称相同的列组成联合索引
+//	unique   唯一索引名称,y表示使用uk_列名,名称相同的列组成联合唯一索引
+//	default  默认值,原样拼接到DEFAULT之后,如 default:"0", default:"''"
+func CreateTableSQL(entity Entity, dialect Dialect) ([]string, error) {
+	if entity == nil {
+		return nil, fmt.Errorf("invalid entity")
+	}
+	tname, err := tblName(entity)
+	if err != nil {
+		return nil, err
+	}
+	m, err := schemaMeta(entity)
+	if err != nil {
+		return nil, err
+	}
+	return createTableSQL(m, tname, dialect)
+}
+
+// DropTableSQL 生成删除表的语句
+func DropTableSQL(table string) string {
+	return "DROP TABLE IF EXISTS " + table
+}
+
+// schemaMeta 查找实体的元数据,没有注册时解析实体
+func schemaMeta(entity Entity) (m *meta, err error) {
+	_, _, typ := extract(entity)
+	if m = findMeta(typ); m != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse meta fail,%v", r)
+		}
+	}()
+	return parseMeta(entity)
+}
+
+type tableIndex struct {
+	name    string
+	unique  bool
+	columns []string
+}
+
+func createTableSQL(m *meta, table string, dialect Dialect) ([]string, error) {
+	if dialect == nil {
+		dialect = MySQLDialect
+	}
+
+	var (
+		columns  = make([]string, 0, len(m.fields)+2)
+		indexes  []*tableIndex
+		idxMap   = map[string]*tableIndex{}
+		inlinePK bool
+	)
+
+	addIndex := func(name string, unique bool, column string) {
+		key := strconv.FormatBool(unique) + ":" + name
+		idx := idxMap[key]
+		if idx == nil {
+			idx = &tableIndex{name: name, unique: unique}
+			idxMap[key] = idx
+			indexes = append(indexes, idx)
+		}
+		idx.columns = append(idx.columns, column)
+	}
+
+	for _, field := range m.fields {
+		def, inline, err := columnDefinition(dialect, field)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s:%v", m.name, field.name, err)
+		}
+		if inline {
+			inlinePK = true
+		}
+		columns = append(columns, dialect.Quote(field.column)+" "+def)
+
+		if index := field.schema.index; index != "" {
+			if strings.ToLower(index) == "y" {
+				index = "idx_" + field.column
+			}
+			addIndex(index, false, field.column)
+		}
+		if unique := field.schema.unique; unique != "" {
+			if strings.ToLower(unique) == "y" {
+				unique = "uk_" + field.column
+			}
+			addIndex(unique, true, field.column)
+		}
+	}
+	if !inlinePK {
+		columns = append(columns, "PRIMARY KEY ("+dialect.Quote(m.pkField.column)+")")
+	}
+
+	quoteColumns := func(idx *tableIndex) string {
+		quoted := make([]string, 0, len(idx.columns))
+		for _, column := range idx.columns {
+			quoted = append(quoted, dialect.Quote(column))
+		}
+		return strings.Join(quoted, ",")
+	}
+
+	var stmts []string
+	if dialect.Name() == MySQLDialectName {
+		for _, idx := range indexes {
+			key := "KEY "
+			if idx.unique {
+				key = "UNIQUE KEY "
+			}
+			columns = append(columns, key+dialect.Quote(idx.name)+" ("+quoteColumns(idx)+")")
+		}
+		stmts = append(stmts, "CREATE TABLE IF NOT EXISTS "+table+" (\n    "+strings.Join(columns, ",\n    ")+"\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+		return stmts, nil
+	}
+
+	stmts = append(stmts, "CREATE TABLE IF NOT EXISTS "+table+" (\n    "+strings.Join(columns, ",\n    ")+"\n)")
+	for _, idx := range indexes {
+		create := "CREATE INDEX IF NOT EXISTS "
+		if idx.unique {
+			create = "CREATE UNIQUE INDEX IF NOT EXISTS "
+		}
+		// postgres和sqlite的索引名称在schema内唯一,加上表名作为前缀
+		stmts = append(stmts, create+dialect.Quote(table+"_"+idx.name)+" ON "+table+" ("+quoteColumns(idx)+")")
+	}
+	return stmts, nil
+}
+
+// columnDefinition 生成列的定义,inlinePK表示主键已经在列定义中声明
+func columnDefinition(dialect Dialect, field *metaField) (def string, inlinePK bool, err error) {
+	schema := field.schema
+	typ := field.structField.Type
+
+	if field.pk && field.pkAuto {
+		switch dialect.Name() {
+		case MySQLDialectName:
+			sqlType := schema.sqlType
+			if sqlType == "" {
+				if sqlType, _, err = columnType(dialect, typ, schema.size); err != nil {
+					return
+				}
+			}
+			return sqlType + " NOT NULL AUTO_INCREMENT", false, nil
+		case PostgresDialectName:
+			if typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Uint64 || typ.Kind() == reflect.Int || typ.Kind() == reflect.Uint {
+				return "BIGSERIAL", false, nil
+			}
+			return "SERIAL", false, nil
+		case SQLiteDialectName:
+			return "INTEGER PRIMARY KEY AUTOINCREMENT", true, nil
+		}
+		return "", false, fmt.Errorf("unsupported dialect %s", dialect.Name())
+	}
+
+	sqlType, nullable := schema.sqlType, false
+	switch {
+	case field.codec != nil:
+		// 编码后的值以文本保存
+		nullable = true
+		if sqlType == "" {
+			sqlType = "TEXT"
+		}
+	case sqlType == "":
+		if sqlType, nullable, err = columnType(dialect, typ, schema.size); err != nil {
+			return
+		}
+	default:
+		_, nullable, _ = columnType(dialect, typ, schema.size)
+		nullable = nullable || typ.Kind() == reflect.Ptr
+	}
+	switch schema.nullable {
+	case "y":
+		nullable = true
+	case "n":
+		nullable = false
+	}
+	if field.pk {
+		nullable = false
+	}
+
+	def = sqlType
+	if nullable {
+		def += " NULL"
+	} else {
+		def += " NOT NULL"
+	}
+	if schema.hasDefault {
+		def += " DEFAULT " + schema.defaultVal
+	}
+	return def, false, nil
+}
+
+// columnType 根据字段类型推断列的类型
+func columnType(dialect Dialect, typ reflect.Type, size int) (sqlType string, nullable bool, err error) {
+	name := dialect.Name()
+	pick := func(mysql, postgres, sqlite string) string {
+		switch name {
+		case PostgresDialectName:
+			return postgres
+		case SQLiteDialectName:
+			return sqlite
+		}
+		return mysql
+	}
+	stringSQLType := func() string {
+		if size <= 0 {
+			size = defaultStringSize
+		}
+		if size > 65535 {
+			return pick("LONGTEXT", "TEXT", "TEXT")
+		}
+		varchar := "VARCHAR(" + strconv.Itoa(size) + ")"
+		return pick(varchar, varchar, "TEXT")
+	}
+	timeSQLType := func() string {
+		return pick("DATETIME", "TIMESTAMP", "DATETIME")
+	}
+
+	if name != MySQLDialectName && name != PostgresDialectName && name != SQLiteDialectName {
+		return "", false, fmt.Errorf("unsupported dialect %s", name)
+	}
+
+	switch typ {
+	case timeType:
+		return timeSQLType(), false, nil
+	case nullTimeType:
+		return timeSQLType(), true, nil
+	case nullStringType:
+		return stringSQLType(), true, nil
+	case nullInt64Type:
+		return pick("BIGINT", "BIGINT", "INTEGER"), true, nil
+	case nullInt32Type:
+		return pick("INT", "INTEGER", "INTEGER"), true, nil
+	case nullInt16Type:
+		return pick("SMALLINT", "SMALLINT", "INTEGER"), true, nil
+	case nullByteType:
+		return pick("TINYINT UNSIGNED", "SMALLINT", "INTEGER"), true, nil
+	case nullFloat64Type:
+		return pick("DOUBLE", "DOUBLE PRECISION", "REAL"), true, nil
+	case nullBoolType:
+		return pick("TINYINT(1)", "BOOLEAN", "INTEGER"), true, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return pick("TINYINT(1)", "BOOLEAN", "INTEGER"), false, nil
+	case reflect.Int8, reflect.Uint8:
+		return pick("TINYINT", "SMALLINT", "INTEGER"), false, nil
+	case reflect.Int16, reflect.Uint16:
+		return pick("SMALLINT", "SMALLINT", "INTEGER"), false, nil
+	case reflect.Int32, reflect.Uint32:
+		return pick("INT", "INTEGER", "INTEGER"), false, nil
+	case reflect.Int, reflect.Uint, reflect.Int64, reflect.Uint64:
+		return pick("BIGINT", "BIGINT", "INTEGER"), false, nil
+	case reflect.Float32:
+		return pick("FLOAT", "REAL", "REAL"), false, nil
+	case reflect.Float64:
+		return pick("DOUBLE", "DOUBLE PRECISION", "REAL"), false, nil
+	case reflect.String:
+		return stringSQLType(), false, nil
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return pick("BLOB", "BYTEA", "BLOB"), true, nil
+		}
+	}
+	return "", false, fmt.Errorf("can't infer column type for %s,please set the type tag", typ)
+}
+
+// sortedKeys 返回排序后的key
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
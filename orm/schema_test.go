@@ -0,0 +1,115 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaModel struct {
+	ID       int64          `column:"id" pk:"Y"`
+	UserID   int64          `column:"user_id" index:"idx_user_ct"`
+	Name     string         `column:"name" size:"32" unique:"y"`
+	Nick     sql.NullString `column:"nick"`
+	Status   int8           `column:"status" default:"1"`
+	Score    float64        `column:"score" nullable:"y"`
+	Conf     *Conf          `column:"conf" type:"varchar(64)"`
+	CreateAt int64          `column:"ct" index:"idx_user_ct"`
+}
+
+func (p *schemaModel) TableName() string {
+	return "schema_model"
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	stmts, err := CreateTableSQL(&schemaModel{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CREATE TABLE IF NOT EXISTS schema_model (\n" +
+		"    `id` BIGINT NOT NULL AUTO_INCREMENT,\n" +
+		"    `user_id` BIGINT NOT NULL,\n" +
+		"    `name` VARCHAR(32) NOT NULL,\n" +
+		"    `nick` VARCHAR(255) NULL,\n" +
+		"    `status` TINYINT NOT NULL DEFAULT 1,\n" +
+		"    `score` DOUBLE NULL,\n" +
+		"    `conf` varchar(64) NULL,\n" +
+		"    `ct` BIGINT NOT NULL,\n" +
+		"    PRIMARY KEY (`id`),\n" +
+		"    KEY `idx_user_ct` (`user_id`,`ct`),\n" +
+		"    UNIQUE KEY `uk_name` (`name`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"}, stmts)
+
+	stmts, err = CreateTableSQL(&schemaModel{}, PostgresDialect)
+	assert.NoError(t, err)
+	assert.Len(t, stmts, 3)
+	assert.Contains(t, stmts[0], `"id" BIGSERIAL,`)
+	assert.Contains(t, stmts[0], `"score" DOUBLE PRECISION NULL,`)
+	assert.Contains(t, stmts[0], `PRIMARY KEY ("id")`)
+	assert.Equal(t, `CREATE INDEX IF NOT EXISTS "schema_model_idx_user_ct" ON schema_model ("user_id","ct")`, stmts[1])
+	assert.Equal(t, `CREATE UNIQUE INDEX IF NOT EXISTS "schema_model_uk_name" ON schema_model ("name")`, stmts[2])
+
+	stmts, err = CreateTableSQL(&schemaModel{}, SQLiteDialect)
+	assert.NoError(t, err)
+	assert.Contains(t, stmts[0], `"id" INTEGER PRIMARY KEY AUTOINCREMENT,`)
+	assert.NotContains(t, stmts[0], "PRIMARY KEY (")
+
+	_, err = CreateTableSQL(&tmodel{}, nil)
+	assert.Error(t, err)
+}
+
+func TestMigrator(t *testing.T) {
+	createTable, err := CreateTableMigration(1, &schemaModel{}, dbpool.Dialect())
+	assert.NoError(t, err)
+
+	addColumn := &Migration{
+		Version: 2,
+		Name:    "add column",
+		Up:      []string{"ALTER TABLE {{table}} ADD COLUMN ext VARCHAR(32)"},
+		Down:    []string{"ALTER TABLE {{table}} DROP COLUMN ext"},
+		Entity:  &schemaModel{},
+	}
+
+	_, err = NewMigrator(createTable, &Migration{Version: 1})
+	assert.Error(t, err)
+
+	migrator, err := NewMigrator(addColumn, createTable)
+	assert.NoError(t, err)
+	migrator.Table = "orm_migrations_test"
+
+	ctx := context.Background()
+	defer func() {
+		dbpool.db.Exec("DROP TABLE IF EXISTS orm_migrations_test")
+		dbpool.db.Exec("DROP TABLE IF EXISTS schema_model")
+	}()
+
+	assert.NoError(t, migrator.Up(ctx, dbpool))
+	assert.NoError(t, migrator.Up(ctx, dbpool))
+
+	applied, err := migrator.Applied(ctx, dbpool)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.EqualValues(t, 2, applied[1].Version)
+	assert.Equal(t, addColumn.Checksum(), applied[1].Checksum)
+
+	_, err = dbpool.db.Exec("INSERT INTO schema_model (user_id,name,ct,ext) VALUES(1,'a',1,'e')")
+	assert.NoError(t, err)
+
+	assert.NoError(t, migrator.Down(ctx, dbpool, 1))
+	applied, err = migrator.Applied(ctx, dbpool)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+
+	modified, err := NewMigrator(createTable, &Migration{Version: 2, Name: "add column", Up: []string{"SELECT 1"}})
+	assert.NoError(t, err)
+	modified.Table = migrator.Table
+	assert.NoError(t, modified.Up(ctx, dbpool))
+
+	migrator.Table = modified.Table
+	assert.Error(t, migrator.Up(ctx, dbpool))
+
+	assert.NoError(t, modified.Down(ctx, dbpool, 0))
+	applied, err = migrator.Applied(ctx, dbpool)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
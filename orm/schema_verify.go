@@ -0,0 +1,418 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// ColumnMismatch 类型或者是否允许NULL与实体不一致的列
+type ColumnMismatch struct {
+	Column   string
+	Expected string //实体对应的列定义
+	Actual   string //表中列的定义
+}
+
+// SchemaDiff 一个表与实体的差异
+type SchemaDiff struct {
+	Entity        string
+	Pool          string
+	Table         string
+	TableMissing  bool              //表不存在
+	Missing       []string          //实体中有,表中没有的列
+	Extra         []string          //表中有,实体中没有的列
+	Mismatched    []*ColumnMismatch //类型或者是否允许NULL不一致的列
+	requiredExtra bool              //Extra中有NOT NULL且没有默认值的列,插入时会失败
+}
+
+// Breaking 差异是否会导致读写失败,只有多余的列且这些列允许NULL或者有默认值时返回false
+func (p *SchemaDiff) Breaking() bool {
+	return p.TableMissing || len(p.Missing) > 0 || len(p.Mismatched) > 0 || p.requiredExtra
+}
+
+func (p *SchemaDiff) String() string {
+	var parts []string
+	if p.TableMissing {
+		parts = append(parts, "table not exist")
+	}
+	if len(p.Missing) > 0 {
+		parts = append(parts, "missing columns "+strings.Join(p.Missing, ","))
+	}
+	if len(p.Extra) > 0 {
+		parts = append(parts, "extra columns "+strings.Join(p.Extra, ","))
+	}
+	for _, m := range p.Mismatched {
+		parts = append(parts, fmt.Sprintf("column %s expected %s,actual %s", m.Column, m.Expected, m.Actual))
+	}
+	return fmt.Sprintf("%s.%s(%s):%s", p.Pool, p.Table, p.Entity, strings.Join(parts, ";"))
+}
+
+// SchemaError 表结构与实体不一致
+type SchemaError struct {
+	Diffs []*SchemaDiff
+}
+
+func (p *SchemaError) Error() string {
+	diffs := make([]string, 0, len(p.Diffs))
+	for _, diff := range p.Diffs {
+		diffs = append(diffs, diff.String())
+	}
+	return "schema drift " + strings.Join(diffs, " | ")
+}
+
+// Breaking 是否有会导致读写失败的差异
+func (p *SchemaError) Breaking() bool {
+	for _, diff := range p.Diffs {
+		if diff.Breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifySchema 校验pool中entities的表结构,表名由实体确定(分表的实体需先设置TableShardFunc);
+// 有差异时返回*SchemaError,包含缺少的列,多余的列以及类型或者是否允许NULL不一致的列.
+//
+// 类型按照字段类型所属的类别(整数,浮点数,时间等)比较,字符串及[]byte可以对应任意类型的列;
+// 设置了type tag时,mysql还会比较列的类型,设置了size tag时,字符串列的长度不能小于size
+func VerifySchema(pool *Pool, entities ...Entity) error {
+	return VerifySchemaCtx(context.Background(), pool, entities...)
+}
+
+// VerifySchemaCtx 校验pool中entities的表结构
+func VerifySchemaCtx(ctx context.Context, pool *Pool, entities ...Entity) error {
+	var diffs []*SchemaDiff
+	for _, entity := range entities {
+		if entity == nil {
+			return fmt.Errorf("invalid entity")
+		}
+		table, err := tblName(entity)
+		if err != nil {
+			return err
+		}
+		diff, err := verifyTable(ctx, pool, entity, table)
+		if err != nil {
+			return err
+		}
+		if diff != nil {
+			diffs = append(diffs, diff)
+		}
+	}
+	if len(diffs) > 0 {
+		return &SchemaError{Diffs: diffs}
+	}
+	return nil
+}
+
+// VerifyShardSchema 按照实体的默认分片规则,校验service中entities所有分库分表的表结构
+func VerifyShardSchema(service ShardDBService, entities ...Entity) error {
+	return VerifyShardSchemaCtx(context.Background(), service, entities...)
+}
+
+// VerifyShardSchemaCtx 按照实体的默认分片规则,校验service中entities所有分库分表的表结构
+func VerifyShardSchemaCtx(ctx context.Context, service ShardDBService, entities ...Entity) error {
+	var diffs []*SchemaDiff
+	for _, entity := range entities {
+		tables, err := service.shardTables(entity, "")
+		if err != nil {
+			return err
+		}
+		for _, poolName := range sortedKeys(tables) {
+			op, err := service.NewOpByShardName(poolName)
+			if err != nil {
+				return err
+			}
+			for _, table := range tables[poolName] {
+				diff, err := verifyTable(ctx, op.pool, entity, table)
+				if err != nil {
+					return err
+				}
+				if diff != nil {
+					diffs = append(diffs, diff)
+				}
+			}
+		}
+	}
+	if len(diffs) > 0 {
+		return &SchemaError{Diffs: diffs}
+	}
+	return nil
+}
+
+// verifyOnInit 在Init时校验表结构,只有多余的列时记录警告,其余差异返回错误
+func verifyOnInit(err error) error {
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Breaking() {
+		return err
+	}
+	c.Warnf("%v", err)
+	return nil
+}
+
+// tableColumn 表中的列
+type tableColumn struct {
+	name       string
+	sqlType    string
+	nullable   bool
+	hasDefault bool //有默认值,自增或者是生成的列
+}
+
+func (p *tableColumn) String() string {
+	if p.nullable {
+		return p.sqlType + " NULL"
+	}
+	return p.sqlType + " NOT NULL"
+}
+
+func verifyTable(ctx context.Context, pool *Pool, entity Entity, table string) (*SchemaDiff, error) {
+	m, err := schemaMeta(entity)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := tableColumns(ctx, pool, table)
+	if err != nil {
+		return nil, fmt.Errorf("query columns of %s fail,err:%v", table, err)
+	}
+
+	diff := &SchemaDiff{Entity: m.name, Pool: pool.Name(), Table: table}
+	if len(columns) == 0 {
+		diff.TableMissing = true
+		return diff, nil
+	}
+
+	byName := make(map[string]*tableColumn, len(columns))
+	for _, col := range columns {
+		byName[strings.ToLower(col.name)] = col
+	}
+	mapped := map[string]bool{}
+	for _, field := range m.fields {
+		name := strings.ToLower(field.column)
+		mapped[name] = true
+		col := byName[name]
+		if col == nil {
+			diff.Missing = append(diff.Missing, field.column)
+			continue
+		}
+		if !columnMatch(pool.Dialect(), field, col) {
+			expected, _, err := columnDefinition(pool.Dialect(), field)
+			if err != nil {
+				expected = field.structField.Type.String()
+			}
+			diff.Mismatched = append(diff.Mismatched, &ColumnMismatch{Column: field.column, Expected: expected, Actual: col.String()})
+		}
+	}
+	for _, col := range columns {
+		if mapped[strings.ToLower(col.name)] {
+			continue
+		}
+		diff.Extra = append(diff.Extra, col.name)
+		if !col.nullable && !col.hasDefault {
+			diff.requiredExtra = true
+		}
+	}
+	if len(diff.Missing) == 0 && len(diff.Extra) == 0 && len(diff.Mismatched) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+// tableColumns 查询表中的列,表不存在时返回空
+func tableColumns(ctx context.Context, pool *Pool, table string) ([]*tableColumn, error) {
+	executor := pool.NewOp().primaryExecutor()
+	var (
+		querySQL string
+		args     []interface{}
+	)
+	switch pool.Dialect().Name() {
+	case MySQLDialectName:
+		querySQL = "SELECT COLUMN_NAME,COLUMN_TYPE,IS_NULLABLE,COLUMN_DEFAULT,EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+		args = []interface{}{table}
+	case PostgresDialectName:
+		querySQL = "SELECT column_name,CASE WHEN character_maximum_length IS NULL THEN data_type ELSE data_type || '(' || character_maximum_length || ')' END,is_nullable,column_default,'' FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? ORDER BY ordinal_position"
+		args = []interface{}{table}
+	case SQLiteDialectName:
+		querySQL = "PRAGMA table_info(" + pool.Dialect().Quote(table) + ")"
+	default:
+		return nil, fmt.Errorf("unsupported dialect %s", pool.Dialect().Name())
+	}
+
+	rows, err := query(ctx, executor, querySQL, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []*tableColumn
+	for rows.Next() {
+		var (
+			col        = &tableColumn{}
+			defaultVal sql.NullString
+		)
+		if pool.Dialect().Name() == SQLiteDialectName {
+			var cid, notNull, pk int
+			if err = rows.Scan(&cid, &col.name, &col.sqlType, &notNull, &defaultVal, &pk); err != nil {
+				return nil, err
+			}
+			col.nullable = notNull == 0 && pk == 0
+			col.hasDefault = defaultVal.Valid || (pk > 0 && strings.EqualFold(col.sqlType, "INTEGER"))
+		} else {
+			var nullable, extra string
+			if err = rows.Scan(&col.name, &col.sqlType, &nullable, &defaultVal, &extra); err != nil {
+				return nil, err
+			}
+			extra = strings.ToLower(extra)
+			col.nullable = strings.EqualFold(nullable, "YES")
+			col.hasDefault = defaultVal.Valid || strings.Contains(extra, "auto_increment") || strings.Contains(extra, "generated")
+		}
+		columns = append(columns, col)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+const (
+	familyBool  = "bool"
+	familyInt   = "int"
+	familyFloat = "float"
+	familyTime  = "time"
+	familyText  = "text"
+)
+
+// typeFamily 列类型的类别
+func typeFamily(sqlType string) string {
+	t := normalizeSQLType(sqlType)
+	if t == "tinyint(1)" {
+		return familyBool
+	}
+	t, _, _ = strings.Cut(t, "(")
+	switch {
+	case strings.HasPrefix(t, "enum") || strings.HasPrefix(t, "set"):
+		return familyText
+	case strings.Contains(t, "bool") || t == "bit":
+		return familyBool
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		return familyInt
+	case strings.Contains(t, "dec") || strings.Contains(t, "numeric") || strings.Contains(t, "float") || strings.Contains(t, "double") || strings.Contains(t, "real"):
+		return familyFloat
+	case strings.Contains(t, "date") || strings.Contains(t, "time"):
+		return familyTime
+	}
+	return familyText
+}
+
+// fieldFamilies 字段可以对应的列类型的类别,返回nil表示不限制
+func fieldFamilies(field *metaField) []string {
+	if field.codec != nil {
+		return []string{familyText}
+	}
+	typ := field.structField.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case timeType, nullTimeType:
+		return []string{familyTime}
+	case nullInt64Type, nullInt32Type, nullInt16Type, nullByteType:
+		return []string{familyInt, familyBool, familyFloat}
+	case nullFloat64Type:
+		return []string{familyFloat, familyInt}
+	case nullBoolType:
+		return []string{familyBool, familyInt}
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return []string{familyBool, familyInt}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{familyInt, familyBool, familyFloat}
+	case reflect.Float32, reflect.Float64:
+		return []string{familyFloat, familyInt}
+	}
+	return nil
+}
+
+// fieldNullable 字段能否读取NULL
+func fieldNullable(field *metaField) bool {
+	typ := field.structField.Type
+	if field.codec != nil || typ.Kind() == reflect.Ptr {
+		return true
+	}
+	if typ == timeType {
+		return false
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return false
+	}
+	// sql.NullXXX,[]byte及实现了sql.Scanner的类型自行处理NULL
+	return true
+}
+
+var (
+	intDisplayWidth = regexp.MustCompile(`^((?:tiny|small|medium|big)?int)\(\d+\)`)
+	charLength      = regexp.MustCompile(`char[^(]*\((\d+)\)`)
+)
+
+// normalizeSQLType 统一类型的写法,去掉整数类型的显示宽度(tinyint(1)除外)
+func normalizeSQLType(sqlType string) string {
+	t := strings.Join(strings.Fields(strings.ToLower(sqlType)), " ")
+	switch t {
+	case "integer":
+		return "int"
+	case "bool", "boolean":
+		return "tinyint(1)"
+	}
+	if t == "tinyint(1)" {
+		return t
+	}
+	return intDisplayWidth.ReplaceAllString(t, "$1")
+}
+
+// columnMatch 列的类型及是否允许NULL是否与字段兼容
+func columnMatch(dialect Dialect, field *metaField, col *tableColumn) bool {
+	if col.nullable && !fieldNullable(field) && !field.pk {
+		return false
+	}
+
+	actual := normalizeSQLType(col.sqlType)
+	if sqlType := field.schema.sqlType; sqlType != "" && dialect.Name() == MySQLDialectName {
+		// type tag没有指定长度时只比较类型的名称
+		expected, compared := normalizeSQLType(sqlType), actual
+		if !strings.Contains(expected, "(") {
+			compared, _, _ = strings.Cut(actual, "(")
+		}
+		if expected != compared && !strings.HasPrefix(compared, expected+" ") {
+			return false
+		}
+	}
+
+	if families := fieldFamilies(field); families != nil {
+		family, ok := typeFamily(col.sqlType), false
+		for _, f := range families {
+			ok = ok || f == family
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if size := field.schema.size; size > 0 {
+		if match := charLength.FindStringSubmatch(actual); match != nil {
+			if n, err := strconv.Atoi(match[1]); err == nil && n < size {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type verifyModel struct {
+	ID      int64     `column:"id" pk:"y"`
+	Name    string    `column:"name" size:"32"`
+	Age     int       `column:"age"`
+	Score   int64     `column:"score"`
+	Created time.Time `column:"created"`
+}
+
+func (p *verifyModel) TableName() string {
+	return "verify_model"
+}
+
+// verifyModelV2 增加及修改了字段,但是没有修改表
+type verifyModelV2 struct {
+	ID      int64          `column:"id" pk:"y"`
+	Name    string         `column:"name" size:"32"`
+	Age     string         `column:"age"`
+	Created int64          `column:"created"`
+	Nick    string         `column:"nick"`
+	Code    sql.NullString `column:"code" size:"16"`
+	Email   string         `column:"email"`
+}
+
+func (p *verifyModelV2) TableName() string {
+	return "verify_model"
+}
+
+type verifyMissing struct {
+	ID int64 `column:"id" pk:"y"`
+}
+
+func (p *verifyMissing) TableName() string {
+	return "verify_missing"
+}
+
+func TestVerifySchema(t *testing.T) {
+	createTables(t, &verifyModel{})
+	assert.NoError(t, VerifySchema(dbpool, &verifyModel{}))
+
+	for _, stmt := range []string{"ALTER TABLE verify_model ADD COLUMN nick VARCHAR(32) NULL", "ALTER TABLE verify_model ADD COLUMN code VARCHAR(8) NULL"} {
+		_, err = dbpool.db.Exec(stmt)
+		assert.NoError(t, err)
+	}
+
+	// 只有允许NULL的多余列
+	err = VerifySchema(dbpool, &verifyModel{})
+	var schemaErr *SchemaError
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Len(t, schemaErr.Diffs, 1)
+	assert.Equal(t, "verify_model", schemaErr.Diffs[0].Table)
+	assert.Equal(t, []string{"nick", "code"}, schemaErr.Diffs[0].Extra)
+	assert.False(t, schemaErr.Breaking())
+	assert.NoError(t, verifyOnInit(err))
+
+	err = VerifySchema(dbpool, &verifyModelV2{}, &verifyMissing{})
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Len(t, schemaErr.Diffs, 2)
+	diff := schemaErr.Diffs[0]
+	assert.True(t, diff.Breaking())
+	assert.Equal(t, []string{"email"}, diff.Missing)
+	assert.Equal(t, []string{"score"}, diff.Extra)
+	var mismatched []string
+	for _, m := range diff.Mismatched {
+		mismatched = append(mismatched, m.Column)
+	}
+	assert.Equal(t, []string{"created", "nick", "code"}, mismatched)
+	assert.Contains(t, diff.Mismatched[1].Actual, " NULL")
+	assert.True(t, schemaErr.Diffs[1].TableMissing)
+	assert.Contains(t, err.Error(), "missing columns email")
+	assert.Equal(t, err, verifyOnInit(err))
+
+	poolFunc := func(*DBConfig) (*Pool, error) {
+		return NewPool(dbpool.db, dbpool.Dialect()), nil
+	}
+	service := NewSimpleDBService(poolFunc)
+	service.Config = &DBConfig{}
+	service.SchemaEntities = []Entity{&verifyModel{}}
+	assert.NoError(t, service.Init())
+
+	service = NewSimpleDBService(poolFunc)
+	service.Config = &DBConfig{}
+	service.SchemaEntities = []Entity{&verifyModel{}, &verifyMissing{}}
+	assert.Error(t, service.Init())
+	_, err = service.NewOp()
+	assert.Error(t, err)
+}
+
+func TestVerifyShardSchema(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	AddMeta(&User{})
+
+	conf := &shardConf{}
+	assert.NoError(t, loadShardConf(conf))
+	assert.NoError(t, conf.Parse())
+
+	shardService := NewSimpleShardDBService(NewDBPool)
+	shardService.DBShardConfig = conf
+	shardService.EntityShardConfig = conf
+	shardService.SchemaEntities = []Entity{&User{}, &tmodel{}}
+	assert.NoError(t, shardService.Init())
+	assert.NoError(t, VerifyShardSchema(shardService, &User{}, &tmodel{}))
+
+	op, err := shardService.NewOpByShardName("test_2")
+	assert.NoError(t, err)
+	_, err = op.DB().Exec("ALTER TABLE user_1 ADD COLUMN ext VARCHAR(32) NULL")
+	assert.NoError(t, err)
+	defer op.DB().Exec("ALTER TABLE user_1 DROP COLUMN ext")
+
+	err = VerifyShardSchema(shardService, &User{})
+	var schemaErr *SchemaError
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Len(t, schemaErr.Diffs, 1)
+	diff := schemaErr.Diffs[0]
+	assert.Equal(t, "test_2", diff.Pool)
+	assert.Equal(t, "user_1", diff.Table)
+	assert.Equal(t, []string{"ext"}, diff.Extra)
+	assert.False(t, diff.Breaking())
+
+	other := NewSimpleShardDBService(NewDBPool)
+	other.DBShardConfig = conf
+	other.EntityShardConfig = conf
+	other.SchemaEntities = []Entity{&User{}}
+	assert.NoError(t, other.Init())
+
+	other = NewSimpleShardDBService(NewDBPool)
+	other.DBShardConfig = conf
+	other.EntityShardConfig = conf
+	other.SchemaEntities = []Entity{&User{}, &verifyMissing{}}
+	err = other.Init()
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, "test0", schemaErr.Diffs[len(schemaErr.Diffs)-1].Pool)
+	assert.True(t, schemaErr.Breaking())
+	_, err = other.NewOp()
+	assert.Error(t, err)
+}
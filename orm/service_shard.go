@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"fmt"
 
 	c "github.com/d0ngw/go/common"
@@ -13,14 +14,21 @@ type ShardDBService interface {
 	NewOpByShardName(name string) (op *Op, err error)
 	// NewOpByEntity create Op for entity with rule name,if rule name is empty use default rule
 	NewOpByEntity(entity Entity, ruleName string) (op *Op, err error)
+	// PoolNames names of all pools,sorted by name
+	PoolNames() []string
 	// setupTableShard setup ShardEntity.TableShardFunc with rule name,if rule name is empty use default rule
 	setupTableShard(entity Entity, ruleName string) (poolName string, err error)
+	// shardTables all shards of entity with rule name,pool name -> table names
+	shardTables(entity Entity, ruleName string) (tables map[string][]string, err error)
+	// shardColumns columns used by the shard rule of entity with rule name,sharded is false if entity has no shard rule
+	shardColumns(entity Entity, ruleName string) (columns []string, sharded bool, err error)
 }
 
 // SimpleShardDBService implements DBService interface
 type SimpleShardDBService struct {
 	DBShardConfig     DBShardConfigurer     `inject:"_"`
 	EntityShardConfig EntityShardConfigurer `inject:"_,optional"`
+	SchemaEntities    []Entity              //不为空时,Init时使用VerifyShardSchema校验这些实体所有分表的表结构,有缺少或者不一致的列时Init失败
 	poolFunc          PoolFunc
 	pools             map[string]*Pool
 	defaultPool       *Pool
@@ -70,6 +78,12 @@ func (p *SimpleShardDBService) Init() error {
 		if p.defaultPool == nil {
 			return fmt.Errorf("no default pool")
 		}
+		if len(p.SchemaEntities) > 0 {
+			if err := verifyOnInit(VerifyShardSchema(p, p.SchemaEntities...)); err != nil {
+				p.pools, p.defaultPool = nil, nil
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -109,6 +123,64 @@ func (p *SimpleShardDBService) NewOpByEntity(entity Entity, ruleName string) (op
 	return
 }
 
+// PoolNames implements ShardDBService.PoolNames
+func (p *SimpleShardDBService) PoolNames() []string {
+	return sortedKeys(p.pools)
+}
+
+// shardTables implements ShardDBService.shardTables
+func (p *SimpleShardDBService) shardTables(entity Entity, ruleName string) (tables map[string][]string, err error) {
+	if entity == nil {
+		err = fmt.Errorf("invalid entity")
+		return
+	}
+
+	rule, err := p.findShardRule(entity, ruleName)
+	if err != nil {
+		return
+	}
+
+	var poolNames []string
+	if rule == nil || rule.DBShard == nil {
+		pool, err := p.getDefaultPool()
+		if err != nil {
+			return nil, err
+		}
+		poolNames = []string{pool.Name()}
+	} else {
+		poolNames = rule.DBShard.AllShards()
+	}
+
+	tableNames := []string{entity.TableName()}
+	if rule != nil && rule.TableShard != nil {
+		tableNames = rule.TableShard.AllShards()
+	}
+
+	tables = map[string][]string{}
+	for _, poolName := range poolNames {
+		if p.pools[poolName] == nil {
+			return nil, fmt.Errorf("can't find pool by name %s", poolName)
+		}
+		tables[poolName] = tableNames
+	}
+	return
+}
+
+// shardColumns implements ShardDBService.shardColumns
+func (p *SimpleShardDBService) shardColumns(entity Entity, ruleName string) (columns []string, sharded bool, err error) {
+	rule, err := p.findShardRule(entity, ruleName)
+	if err != nil || rule == nil {
+		return
+	}
+	sharded = true
+	for _, shard := range []*OneRule{rule.DBShard, rule.TableShard} {
+		if shard != nil && shard.ShardFieldName() != "" {
+			columns = append(columns, shard.ShardFieldName())
+		}
+	}
+	return
+}
+
 // setupTableShard setup ShardEntity.TableShardFunc
 func (p *SimpleShardDBService) setupTableShard(entity Entity, ruleName string) (poolName string, err error) {
 	pool, err := p.matchPoolAndSetupTblShard(entity, ruleName)
@@ -220,6 +292,10 @@ func (p *SimpleShardDBService) matchPoolAndSetupTblShard(entity Entity, ruleName
 		return
 	}
 
+	if err = generateShardID(entity, rule); err != nil {
+		return
+	}
+
 	pool, err = p.findShardPool(entity, rule)
 	if err != nil {
 		return
@@ -237,6 +313,24 @@ func (p *SimpleShardDBService) matchPoolAndSetupTblShard(entity Entity, ruleName
 	return
 }
 
+// generateShardID 按主键分片且主键由IDGenerator生成时,在分片前生成主键
+func generateShardID(entity Entity, rule *EntityShardRuleConfig) error {
+	if rule == nil {
+		return nil
+	}
+	m := findEntityMeta(entity)
+	if m.pkField.pkGen == "" {
+		return nil
+	}
+	for _, shard := range []*OneRule{rule.DBShard, rule.TableShard} {
+		if shard != nil && shard.ShardFieldName() == m.pkField.column {
+			_, ind, _ := extract(entity)
+			return m.fillID(context.Background(), ind)
+		}
+	}
+	return nil
+}
+
 func (p *SimpleShardDBService) getDefaultPool() (pool *Pool, err error) {
 	if p.defaultPool != nil {
 		return p.defaultPool, nil
@@ -1,10 +1,10 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
-	c "github.com/d0ngw/go/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,13 +16,13 @@ func TestShardDBServcie(t *testing.T) {
 	AddMeta(user)
 
 	conf := &shardConf{}
-	err := c.LoadYAMLFromPath("testdata/shard.yaml", conf)
+	err := loadShardConf(conf)
 	assert.NoError(t, err)
 
 	err = conf.Parse()
 	assert.NoError(t, err)
 
-	shardServcie := NewSimpleShardDBService(NewMySQLDBPool)
+	shardServcie := NewSimpleShardDBService(NewDBPool)
 	shardServcie.DBShardConfig = conf
 	shardServcie.EntityShardConfig = conf
 
@@ -109,3 +109,63 @@ func TestShardDBServcie(t *testing.T) {
 		return nil, nil
 	})
 }
+
+func TestMigratorShards(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	AddMeta(&User{})
+
+	conf := &shardConf{}
+	err := loadShardConf(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, conf.Parse())
+
+	shardServcie := NewSimpleShardDBService(NewDBPool)
+	shardServcie.DBShardConfig = conf
+	shardServcie.EntityShardConfig = conf
+	assert.NoError(t, shardServcie.Init())
+
+	assert.Equal(t, []string{"test0", "test_2"}, shardServcie.PoolNames())
+
+	tables, err := shardServcie.shardTables(&User{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"test_2": {"user_0", "user_1", "user_2"}}, tables)
+
+	tables, err = shardServcie.shardTables(&tmodel{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"test0": {"tt"}}, tables)
+
+	_, err = shardServcie.shardTables(&tmodel{}, "test_db_shard_num_range")
+	assert.Error(t, err)
+
+	migrator, err := NewMigrator(&Migration{
+		Version: 1,
+		Name:    "add user ext",
+		Up:      []string{"ALTER TABLE {{table}} ADD COLUMN ext VARCHAR(32)"},
+		Down:    []string{"ALTER TABLE {{table}} DROP COLUMN ext"},
+		Entity:  &User{},
+	})
+	assert.NoError(t, err)
+	migrator.Table = "orm_migrations_shard"
+
+	ctx := context.Background()
+	assert.NoError(t, migrator.UpShards(ctx, shardServcie))
+	assert.NoError(t, migrator.UpShards(ctx, shardServcie))
+
+	op, err := shardServcie.NewOpByShardName("test_2")
+	assert.NoError(t, err)
+	for _, table := range []string{"user_0", "user_1", "user_2"} {
+		_, err = op.DB().Exec("SELECT ext FROM " + table)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, migrator.DownShards(ctx, shardServcie, 0))
+	_, err = op.DB().Exec("SELECT ext FROM user_0")
+	assert.Error(t, err)
+
+	for _, name := range shardServcie.PoolNames() {
+		op, err = shardServcie.NewOpByShardName(name)
+		assert.NoError(t, err)
+		op.DB().Exec("DROP TABLE IF EXISTS orm_migrations_shard")
+	}
+}
@@ -14,9 +14,10 @@ type DBService interface {
 
 // SimpleDBService implements DBService interface
 type SimpleDBService struct {
-	Config   DBConfigurer `inject:"_"`
-	poolFunc PoolFunc
-	pool     *Pool
+	Config         DBConfigurer `inject:"_"`
+	SchemaEntities []Entity     //不为空时,Init时使用VerifySchema校验这些实体的表结构,有缺少或者不一致的列时Init失败
+	poolFunc       PoolFunc
+	pool           *Pool
 }
 
 // NewSimpleDBService build simple db service
@@ -40,6 +41,11 @@ func (p *SimpleDBService) Init() error {
 	if err != nil {
 		return err
 	}
+	if len(p.SchemaEntities) > 0 {
+		if err = verifyOnInit(VerifySchema(pool, p.SchemaEntities...)); err != nil {
+			return err
+		}
+	}
 	p.pool = pool
 	return nil
 }
@@ -1,10 +1,13 @@
 package orm
 
 import (
+	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"reflect"
 	"sort"
 	"strconv"
+	"time"
 
 	c "github.com/d0ngw/go/common"
 )
@@ -21,6 +24,8 @@ type ShardRule interface {
 	Shard(val interface{}) (shardName string, err error)
 	// ShardFieldName 用于分片的字段名称
 	ShardFieldName() string
+	// AllShards 所有可能的分片名称
+	AllShards() []string
 }
 
 const (
@@ -30,11 +35,15 @@ const (
 	Named ShardPolicy = "named"
 	//NumRange number range shard
 	NumRange ShardPolicy = "num_range"
+	//ConsistentHash consistent hash shard
+	ConsistentHash ShardPolicy = "consistent_hash"
+	//TimeRange time range shard
+	TimeRange ShardPolicy = "time_range"
 )
 
 // IsValid 是否有效
 func (p ShardPolicy) IsValid() bool {
-	return p == Hash || p == Named || p == NumRange
+	return p == Hash || p == Named || p == NumRange || p == ConsistentHash || p == TimeRange
 }
 
 // HashRule hash规则
@@ -80,6 +89,15 @@ func (p *HashRule) ShardFieldName() string {
 	return p.FieldName
 }
 
+// AllShards implements ShardRule.AllShards
+func (p *HashRule) AllShards() []string {
+	ret := make([]string, 0, p.Count)
+	for i := int64(0); i < p.Count; i++ {
+		ret = append(ret, p.NamePrefix+strconv.FormatInt(i, 10))
+	}
+	return ret
+}
+
 // NamedRule 指定命名
 type NamedRule struct {
 	Name string `yaml:"name"`
@@ -108,6 +126,11 @@ func (p *NamedRule) ShardFieldName() string {
 	return ""
 }
 
+// AllShards implements ShardRule.AllShards
+func (p *NamedRule) AllShards() []string {
+	return []string{p.Name}
+}
+
 // NumRangeRule 数字区间
 type NumRangeRule struct {
 	FieldName   string `yaml:"field_name"`   //分片取值的字段名
@@ -182,18 +205,327 @@ func (p *NumRangeRule) ShardFieldName() string {
 	return p.FieldName
 }
 
+// AllShards implements ShardRule.AllShards
+func (p *NumRangeRule) AllShards() []string {
+	var names []string
+	for _, r := range p.Ranges {
+		names = append(names, r.Name)
+	}
+	if p.DefaultName != "" {
+		names = append(names, p.DefaultName)
+	}
+	return distinctNames(names)
+}
+
+// distinctNames 去掉重复的名称,保持原有的顺序
+func distinctNames(names []string) []string {
+	ret := make([]string, 0, len(names))
+	exist := map[string]struct{}{}
+	for _, name := range names {
+		if _, ok := exist[name]; ok {
+			continue
+		}
+		exist[name] = struct{}{}
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// DefaultConsistentHashReplicas 一致性hash中每个权重的默认虚拟节点数
+const DefaultConsistentHashReplicas = 160
+
+// ConsistentHashNode 一致性hash的节点
+type ConsistentHashNode struct {
+	Name   string `yaml:"name"`   //分片名称
+	Weight int    `yaml:"weight"` //权重,虚拟节点数为Weight*Replicas,默认为1
+}
+
+// ConsistentHashRule 一致性hash规则,增加节点时只有部分数据需要迁移
+type ConsistentHashRule struct {
+	FieldName string                `yaml:"field_name"` //hash取值的字段名
+	Replicas  int                   `yaml:"replicas"`   //每个权重的虚拟节点数,默认为DefaultConsistentHashReplicas
+	Nodes     []*ConsistentHashNode `yaml:"nodes"`      //节点
+	ring      []uint64
+	ringNames []string
+}
+
+// Policy implements ShardRule
+func (p *ConsistentHashRule) Policy() ShardPolicy {
+	return ConsistentHash
+}
+
+// Parse implements Configurer
+func (p *ConsistentHashRule) Parse() error {
+	if p.FieldName == "" {
+		return fmt.Errorf("invalid field_name")
+	}
+	if len(p.Nodes) == 0 {
+		return fmt.Errorf("invalid nodes")
+	}
+	if p.Replicas < 0 {
+		return fmt.Errorf("invalid replicas %d", p.Replicas)
+	}
+	if p.Replicas == 0 {
+		p.Replicas = DefaultConsistentHashReplicas
+	}
+
+	type vnode struct {
+		hash uint64
+		name string
+	}
+	var vnodes []vnode
+	names := map[string]struct{}{}
+	for _, node := range p.Nodes {
+		if node == nil || node.Name == "" {
+			return fmt.Errorf("invalid node name")
+		}
+		if _, ok := names[node.Name]; ok {
+			return fmt.Errorf("duplicate node %s", node.Name)
+		}
+		names[node.Name] = struct{}{}
+		if node.Weight < 0 {
+			return fmt.Errorf("invalid node %s weight %d", node.Name, node.Weight)
+		}
+		if node.Weight == 0 {
+			node.Weight = 1
+		}
+		for i := 0; i < node.Weight*p.Replicas; i++ {
+			vnodes = append(vnodes, vnode{hash: hashKey(node.Name + "#" + strconv.Itoa(i)), name: node.Name})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool {
+		return vnodes[i].hash < vnodes[j].hash
+	})
+
+	p.ring = make([]uint64, 0, len(vnodes))
+	p.ringNames = make([]string, 0, len(vnodes))
+	for _, v := range vnodes {
+		p.ring = append(p.ring, v.hash)
+		p.ringNames = append(p.ringNames, v.name)
+	}
+	return nil
+}
+
+// Shard implements ShardRule.Shard
+func (p *ConsistentHashRule) Shard(val interface{}) (shardName string, err error) {
+	if len(p.ring) == 0 {
+		return "", fmt.Errorf("consistent hash rule not parsed")
+	}
+	var key string
+	switch v := val.(type) {
+	case string:
+		key = v
+	case []byte:
+		key = string(v)
+	default:
+		valInt64, err := c.Int64(val)
+		if err != nil {
+			return "", err
+		}
+		key = strconv.FormatInt(valInt64, 10)
+	}
+
+	h := hashKey(key)
+	i := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i] >= h
+	})
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.ringNames[i], nil
+}
+
+// ShardFieldName 用于分片的字段名
+func (p *ConsistentHashRule) ShardFieldName() string {
+	return p.FieldName
+}
+
+// AllShards implements ShardRule.AllShards
+func (p *ConsistentHashRule) AllShards() []string {
+	names := make([]string, 0, len(p.Nodes))
+	for _, node := range p.Nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// fnv对只有末尾不同的短字符串区分度不够,再混合一次
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+const (
+	// TimeUnitDay 按天分片
+	TimeUnitDay = "day"
+	// TimeUnitWeek 按ISO周分片
+	TimeUnitWeek = "week"
+	// TimeUnitMonth 按月分片
+	TimeUnitMonth = "month"
+)
+
+// TimeRangeRule 按时间分片,分片名称为NamePrefix加上时间格式化后的字符串,如log_202610
+type TimeRangeRule struct {
+	FieldName  string `yaml:"field_name"`  //分片取值的字段名,字段类型为time.Time,NullTime或者unix毫秒数(int64,sql.NullInt64)
+	Unit       string `yaml:"unit"`        //day,week或month
+	NamePrefix string `yaml:"name_prefix"` //名称的前缀
+	Format     string `yaml:"format"`      //时间格式,默认day为20060102,month为200601;week固定为年份加两位周数,如202642
+	Begin      string `yaml:"begin"`       //第一个分片的日期,如2026-01-01,用于AllShards
+	End        string `yaml:"end"`         //最后一个分片的日期,为空时为当前时间
+	Location   string `yaml:"location"`    //时区,默认为Local
+	begin      time.Time
+	end        time.Time
+	loc        *time.Location
+	now        func() time.Time //End为空时取当前时间,默认为time.Now
+}
+
+// Policy implements ShardRule
+func (p *TimeRangeRule) Policy() ShardPolicy {
+	return TimeRange
+}
+
+// Parse implements Configurer
+func (p *TimeRangeRule) Parse() (err error) {
+	if p.FieldName == "" {
+		return fmt.Errorf("invalid field_name")
+	}
+	switch p.Unit {
+	case TimeUnitDay:
+		if p.Format == "" {
+			p.Format = "20060102"
+		}
+	case TimeUnitMonth:
+		if p.Format == "" {
+			p.Format = "200601"
+		}
+	case TimeUnitWeek:
+		if p.Format != "" {
+			return fmt.Errorf("format is not supported by week unit")
+		}
+	default:
+		return fmt.Errorf("invalid unit %s", p.Unit)
+	}
+
+	p.loc = time.Local
+	if p.Location != "" {
+		if p.loc, err = time.LoadLocation(p.Location); err != nil {
+			return fmt.Errorf("invalid location %s,err:%v", p.Location, err)
+		}
+	}
+	if p.Begin == "" {
+		return fmt.Errorf("invalid begin")
+	}
+	if p.begin, err = time.ParseInLocation("2006-01-02", p.Begin, p.loc); err != nil {
+		return fmt.Errorf("invalid begin %s,err:%v", p.Begin, err)
+	}
+	if p.End != "" {
+		if p.end, err = time.ParseInLocation("2006-01-02", p.End, p.loc); err != nil {
+			return fmt.Errorf("invalid end %s,err:%v", p.End, err)
+		}
+		if p.end.Before(p.begin) {
+			return fmt.Errorf("invalid time range begin:%s > end:%s", p.Begin, p.End)
+		}
+	}
+	return nil
+}
+
+// Shard implements ShardRule.Shard
+func (p *TimeRangeRule) Shard(val interface{}) (shardName string, err error) {
+	var t time.Time
+	switch v := val.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v != nil {
+			t = *v
+		}
+	case NullTime:
+		if v.Valid {
+			t = v.Time
+		}
+	case sql.NullInt64:
+		if v.Valid {
+			t = time.UnixMilli(v.Int64)
+		}
+	default:
+		mills, err := c.Int64(val)
+		if err != nil {
+			return "", err
+		}
+		t = time.UnixMilli(mills)
+	}
+	if t.IsZero() {
+		return "", fmt.Errorf("invalid time val %v", val)
+	}
+	return p.name(t), nil
+}
+
+// name 时间对应的分片名称
+func (p *TimeRangeRule) name(t time.Time) string {
+	loc := p.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	if p.Unit == TimeUnitWeek {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s%04d%02d", p.NamePrefix, year, week)
+	}
+	return p.NamePrefix + t.Format(p.Format)
+}
+
+// ShardFieldName 用于分片的字段名
+func (p *TimeRangeRule) ShardFieldName() string {
+	return p.FieldName
+}
+
+// AllShards implements ShardRule.AllShards,返回Begin到End(为空时为当前时间)之间的所有分片
+func (p *TimeRangeRule) AllShards() []string {
+	end := p.end
+	if end.IsZero() {
+		now := p.now
+		if now == nil {
+			now = time.Now
+		}
+		end = now()
+	}
+	var names []string
+	for t := p.begin; !t.After(end); {
+		names = append(names, p.name(t))
+		switch p.Unit {
+		case TimeUnitDay:
+			t = t.AddDate(0, 0, 1)
+		case TimeUnitWeek:
+			t = t.AddDate(0, 0, 7)
+		default:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		}
+	}
+	if len(names) > 0 && p.name(end) != names[len(names)-1] {
+		names = append(names, p.name(end))
+	}
+	return names
+}
+
 // OneRule 选择一个
 type OneRule struct {
-	Hash     *HashRule     `yaml:"hash"`
-	Named    *NamedRule    `yaml:"named"`
-	NumRange *NumRangeRule `yaml:"num_range"`
-	policy   ShardPolicy
-	rule     ShardRule
+	Hash           *HashRule           `yaml:"hash"`
+	Named          *NamedRule          `yaml:"named"`
+	NumRange       *NumRangeRule       `yaml:"num_range"`
+	ConsistentHash *ConsistentHashRule `yaml:"consistent_hash"`
+	TimeRange      *TimeRangeRule      `yaml:"time_range"`
+	policy         ShardPolicy
+	rule           ShardRule
 }
 
 // Parse implements Configurer
 func (p *OneRule) Parse() error {
-	var rules = []ShardRule{p.Hash, p.Named, p.NumRange}
+	var rules = []ShardRule{p.Hash, p.Named, p.NumRange, p.ConsistentHash, p.TimeRange}
 	for _, v := range rules {
 		if v == nil || reflect.ValueOf(v).IsNil() {
 			continue
@@ -229,3 +561,8 @@ func (p *OneRule) Shard(val interface{}) (shardName string, err error) {
 func (p *OneRule) ShardFieldName() string {
 	return p.rule.ShardFieldName()
 }
+
+// AllShards implements ShardRule.AllShards
+func (p *OneRule) AllShards() []string {
+	return p.rule.AllShards()
+}
@@ -1,7 +1,9 @@
 package orm
 
 import (
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -44,7 +46,7 @@ func TestShardConfig(t *testing.T) {
 	AddMeta(&User{})
 
 	conf := &shardConf{}
-	err := c.LoadYAMLFromPath("testdata/shard.yaml", conf)
+	err := loadShardConf(conf)
 	assert.NoError(t, err)
 
 	err = conf.Parse()
@@ -181,3 +183,117 @@ func TestShardConfig(t *testing.T) {
 	numRangeTest(tableNumRangeRule, "tt", "tt_")
 	defaultMetaReg.clean()
 }
+
+func TestConsistentHashRule(t *testing.T) {
+	rule := &ConsistentHashRule{FieldName: "id", Nodes: []*ConsistentHashNode{{Name: "s0"}, {Name: "s1"}, {Name: "s2", Weight: 2}}}
+	assert.NoError(t, rule.Parse())
+	assert.Equal(t, DefaultConsistentHashReplicas, rule.Replicas)
+	assert.Equal(t, []string{"s0", "s1", "s2"}, rule.AllShards())
+
+	counts := map[string]int{}
+	before := map[int]string{}
+	for i := 0; i < 10000; i++ {
+		name, err := rule.Shard(i)
+		assert.NoError(t, err)
+		counts[name]++
+		before[i] = name
+	}
+	assert.InDelta(t, 2500, counts["s0"], 500)
+	assert.InDelta(t, 2500, counts["s1"], 500)
+	assert.InDelta(t, 5000, counts["s2"], 700)
+
+	// 增加节点时,只有迁移到新节点的数据发生变化
+	grown := &ConsistentHashRule{FieldName: "id", Nodes: []*ConsistentHashNode{{Name: "s0"}, {Name: "s1"}, {Name: "s2", Weight: 2}, {Name: "s3"}}}
+	assert.NoError(t, grown.Parse())
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		name, err := grown.Shard(i)
+		assert.NoError(t, err)
+		if name != before[i] {
+			assert.Equal(t, "s3", name)
+			moved++
+		}
+	}
+	assert.InDelta(t, 2000, moved, 500)
+
+	name, err := rule.Shard("user-1")
+	assert.NoError(t, err)
+	name2, err := rule.Shard("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, name, name2)
+
+	_, err = rule.Shard(1.5i)
+	assert.Error(t, err)
+
+	assert.Error(t, (&ConsistentHashRule{FieldName: "id"}).Parse())
+	assert.Error(t, (&ConsistentHashRule{FieldName: "id", Nodes: []*ConsistentHashNode{{Name: "s0"}, {Name: "s0"}}}).Parse())
+	assert.Error(t, (&ConsistentHashRule{FieldName: "id", Nodes: []*ConsistentHashNode{{Name: "s0", Weight: -1}}}).Parse())
+}
+
+func TestTimeRangeRule(t *testing.T) {
+	rule := &TimeRangeRule{FieldName: "create_time", Unit: TimeUnitMonth, NamePrefix: "log_", Begin: "2026-08-20", End: "2026-10-01", Location: "UTC"}
+	assert.NoError(t, rule.Parse())
+	assert.Equal(t, []string{"log_202608", "log_202609", "log_202610"}, rule.AllShards())
+
+	ts := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, val := range []interface{}{ts, &ts, NullTime{Time: ts, Valid: true}, c.UnixMills(ts), sql.NullInt64{Int64: c.UnixMills(ts), Valid: true}} {
+		name, err := rule.Shard(val)
+		assert.NoError(t, err)
+		assert.Equal(t, "log_202610", name)
+	}
+	_, err := rule.Shard(NullTime{})
+	assert.Error(t, err)
+	_, err = rule.Shard("x")
+	assert.Error(t, err)
+
+	day := &TimeRangeRule{FieldName: "create_time", Unit: TimeUnitDay, NamePrefix: "log_", Begin: "2026-10-30", End: "2026-11-01", Location: "UTC"}
+	assert.NoError(t, day.Parse())
+	assert.Equal(t, []string{"log_20261030", "log_20261031", "log_20261101"}, day.AllShards())
+
+	week := &TimeRangeRule{FieldName: "create_time", Unit: TimeUnitWeek, NamePrefix: "log_", Begin: "2026-12-24", End: "2027-01-06", Location: "UTC"}
+	assert.NoError(t, week.Parse())
+	assert.Equal(t, []string{"log_202652", "log_202653", "log_202701"}, week.AllShards())
+
+	open := &TimeRangeRule{FieldName: "create_time", Unit: TimeUnitMonth, NamePrefix: "log_", Begin: "2026-01-01", Location: "UTC"}
+	assert.NoError(t, open.Parse())
+	open.now = func() time.Time { return ts }
+	shards := open.AllShards()
+	assert.Len(t, shards, 10)
+	assert.Equal(t, "log_202601", shards[0])
+	assert.Equal(t, "log_202610", shards[len(shards)-1])
+
+	assert.Error(t, (&TimeRangeRule{FieldName: "create_time", Unit: "year", Begin: "2026-01-01"}).Parse())
+	assert.Error(t, (&TimeRangeRule{FieldName: "create_time", Unit: TimeUnitDay}).Parse())
+	assert.Error(t, (&TimeRangeRule{FieldName: "create_time", Unit: TimeUnitDay, Begin: "2026-02-01", End: "2026-01-01"}).Parse())
+	assert.Error(t, (&TimeRangeRule{FieldName: "create_time", Unit: TimeUnitWeek, Format: "2006", Begin: "2026-01-01"}).Parse())
+}
+
+func TestShardConfigNewPolicies(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+	AddMeta(&User{})
+	defer defaultMetaReg.clean()
+
+	conf := &shardConf{}
+	assert.NoError(t, loadShardConf(conf))
+	assert.NoError(t, conf.Parse())
+
+	var rule *EntityShardRuleConfig
+	for _, r := range conf.EntityShards.Entities["github.com/d0ngw/go/orm"]["tmodel"] {
+		if r.Name == "test_db_shard_consistent_hash" {
+			rule = r
+		}
+	}
+	assert.NotNil(t, rule)
+	assert.Equal(t, ConsistentHash, rule.DBShard.Policy())
+	assert.Equal(t, 2, rule.DBShard.ConsistentHash.Nodes[1].Weight)
+	assert.Equal(t, []string{"test0", "test_2"}, rule.DBShard.AllShards())
+	assert.Equal(t, TimeRange, rule.TableShard.Policy())
+	assert.Equal(t, []string{"tt_202601", "tt_202602", "tt_202603"}, rule.TableShard.AllShards())
+
+	name, err := rule.TableShard.Shard(sql.NullInt64{Int64: c.UnixMills(time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC)), Valid: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "tt_202602", name)
+
+	assert.Error(t, (&OneRule{Hash: &HashRule{Count: 1, NamePrefix: "t_", FieldName: "id"}, TimeRange: rule.TableShard.TimeRange}).Parse())
+}
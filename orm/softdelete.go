@@ -0,0 +1,216 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+type unscopedKey struct{}
+
+// Unscoped 返回不排除软删除记录的上下文,在XxxCtx操作中使用时查询包含已删除的记录,删除为物理删除
+func Unscoped(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+func isUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
+
+type entityRestoreFunc func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (bool, error)
+
+// checkSoftDeleteField 检查软删除字段的类型,支持:
+//
+//	bool                        删除时为true
+//	int64,uint64                删除时为当前的毫秒数,如deleted_at
+//	其他整数类型                删除时为1,如status
+//	sql.NullTime,sql.NullInt64  未删除时为NULL,删除时为当前时间或者毫秒数
+func checkSoftDeleteField(field *metaField) error {
+	typ := field.structField.Type
+	switch typ {
+	case nullTimeType, nullInt64Type:
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return nil
+	}
+	return fmt.Errorf("unsupported soft delete field type %s", typ)
+}
+
+// notDeleted 未删除记录的条件
+func (p *metaField) notDeleted(executor *sqlExecutor) string {
+	column := executor.quote(p.column)
+	typ := p.structField.Type
+	switch {
+	case typ == nullTimeType || typ == nullInt64Type:
+		return column + " IS NULL"
+	case typ.Kind() == reflect.Bool:
+		return column + " = FALSE"
+	}
+	return column + " = 0"
+}
+
+// deletedValue 删除记录时设置的值
+func (p *metaField) deletedValue(now time.Time) interface{} {
+	typ := p.structField.Type
+	switch typ {
+	case nullTimeType:
+		return sql.NullTime{Time: now, Valid: true}
+	case nullInt64Type:
+		return sql.NullInt64{Int64: c.UnixMills(now), Valid: true}
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return true
+	case reflect.Int64, reflect.Uint64:
+		return c.UnixMills(now)
+	}
+	return 1
+}
+
+// restoredValue 恢复记录时设置的值
+func (p *metaField) restoredValue() interface{} {
+	typ := p.structField.Type
+	switch {
+	case typ == nullTimeType || typ == nullInt64Type:
+		return nil
+	case typ.Kind() == reflect.Bool:
+		return false
+	}
+	return 0
+}
+
+// scope 为条件加上排除软删除记录的条件
+func (p *meta) scope(ctx context.Context, executor *sqlExecutor, condition string) string {
+	if p.softDeleteField == nil || isUnscoped(ctx) {
+		return condition
+	}
+	return scopeCondition(condition, p.softDeleteField.notDeleted(executor))
+}
+
+// 条件中WHERE之后的子句
+var conditionTailKeywords = []string{"GROUP BY", "HAVING", "ORDER BY", "LIMIT", "OFFSET", "FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"}
+
+// scopeCondition 将scope以AND加入到condition的WHERE中,condition可以包含ORDER BY,LIMIT等子句
+func scopeCondition(condition, scope string) string {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return "WHERE " + scope
+	}
+	tailAt := conditionTail(condition)
+	head, tail := strings.TrimSpace(condition[:tailAt]), condition[tailAt:]
+	if n := matchKeyword(head, "WHERE"); n > 0 {
+		ret := "WHERE (" + strings.TrimSpace(head[n:]) + ") AND " + scope
+		if tail != "" {
+			ret += " " + tail
+		}
+		return ret
+	}
+	return "WHERE " + scope + " " + condition
+}
+
+// conditionTail 查找条件中不在引号及括号中的第一个WHERE之后的子句的位置,没有时返回len(condition)
+func conditionTail(condition string) int {
+	var (
+		quote byte
+		depth int
+	)
+	for i := 0; i < len(condition); i++ {
+		ch := condition[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"', '`':
+			quote = ch
+			continue
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && !isSpace(condition[i-1]) && condition[i-1] != ')') {
+			continue
+		}
+		for _, keyword := range conditionTailKeywords {
+			if matchKeyword(condition[i:], keyword) > 0 {
+				return i
+			}
+		}
+	}
+	return len(condition)
+}
+
+// matchKeyword s是否以keyword开头(忽略大小写,单词之间可以是任意空白),返回匹配的长度
+func matchKeyword(s string, keyword string) int {
+	n := 0
+	for i, word := range strings.Fields(keyword) {
+		if i > 0 {
+			start := n
+			for n < len(s) && isSpace(s[n]) {
+				n++
+			}
+			if n == start {
+				return 0
+			}
+		}
+		if len(s)-n < len(word) || !strings.EqualFold(s[n:n+len(word)], word) {
+			return 0
+		}
+		n += len(word)
+	}
+	if n < len(s) && isIdentChar(s[n]) {
+		return 0
+	}
+	return n
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// 构建恢复软删除记录的函数
+func createRestoreFunc(modelInfo *meta) entityRestoreFunc {
+	return func(ctx context.Context, executor *sqlExecutor, entity Entity, id interface{}) (bool, error) {
+		checkEntity(modelInfo, entity, executor)
+		field := modelInfo.softDeleteField
+		if field == nil {
+			return false, fmt.Errorf("%s has no soft delete column", modelInfo.name)
+		}
+		tname, err := tblName(entity)
+		if err != nil {
+			return false, err
+		}
+		columns, params := modelInfo.bumpUpdateTime(ctx, executor, executor.quote(field.column)+"=?", []interface{}{field.restoredValue(), id})
+		restoreSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", tname, updateSetVersion(modelInfo, executor, columns), executor.quote(modelInfo.pkField.column))
+		rs, err := exec(ctx, executor, restoreSQL, params)
+		if err != nil {
+			return false, err
+		}
+		rows, err := rs.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+}
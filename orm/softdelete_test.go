@@ -0,0 +1,154 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type softModel struct {
+	ID        int64  `column:"id" pk:"y"`
+	Name      string `column:"name" size:"32"`
+	DeletedAt int64  `column:"deleted_at" softDelete:"y"`
+}
+
+func (p *softModel) TableName() string {
+	return "soft_model"
+}
+
+func TestScopeCondition(t *testing.T) {
+	scope := "`deleted_at` = 0"
+	assert.Equal(t, "WHERE `deleted_at` = 0", scopeCondition("", scope))
+	assert.Equal(t, "WHERE (a = ? OR b = ?) AND `deleted_at` = 0", scopeCondition(" where a = ? OR b = ?", scope))
+	assert.Equal(t, "WHERE (a IN (SELECT id FROM x ORDER BY id LIMIT 1)) AND `deleted_at` = 0 ORDER BY id DESC LIMIT 10", scopeCondition("WHERE a IN (SELECT id FROM x ORDER BY id LIMIT 1) ORDER BY id DESC LIMIT 10", scope))
+	assert.Equal(t, "WHERE (name = 'order by') AND `deleted_at` = 0 GROUP  BY name", scopeCondition("WHERE name = 'order by' GROUP  BY name", scope))
+	assert.Equal(t, "WHERE (limited = 1) AND `deleted_at` = 0", scopeCondition("WHERE limited = 1", scope))
+	assert.Equal(t, "WHERE `deleted_at` = 0 ORDER BY id", scopeCondition("ORDER BY id", scope))
+}
+
+func TestSoftDelete(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&softModel{})
+	AddMeta(&tmodel{})
+
+	createTables(t, &softModel{})
+
+	dboper := &Op{pool: dbpool}
+	for _, name := range []string{"s0", "s1", "s2"} {
+		assert.NoError(t, Add(dboper, &softModel{Name: name}))
+	}
+	l, err := Query(dboper, &softModel{}, "ORDER BY id")
+	assert.NoError(t, err)
+	assert.Len(t, l, 3)
+	s0, s1 := l[0].(*softModel), l[1].(*softModel)
+
+	deleted, err := Del(dboper, s0, s0.ID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	e, err := Get(dboper, s0, s0.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	e, err = GetCtx(Unscoped(context.Background()), dboper, s0, s0.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, e)
+	assert.True(t, e.(*softModel).DeletedAt > 0)
+
+	n, err := DelByCondition(dboper, s0, "WHERE name = ? OR name = ?", "s0", "s1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	total, err := QueryCount(dboper, &softModel{}, "*", "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+
+	total, err = From[*softModel]().Count(dboper)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+
+	total, err = QueryCountCtx(Unscoped(context.Background()), dboper, &softModel{}, "*", "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+
+	restored, err := Restore(dboper, s1, s1.ID)
+	assert.NoError(t, err)
+	assert.True(t, restored)
+
+	e, err = Get(dboper, s1, s1.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, e)
+
+	_, err = Restore(dboper, &tmodel{}, 1)
+	assert.Error(t, err)
+
+	hard, err := HardDel(dboper, s0, s0.ID)
+	assert.NoError(t, err)
+	assert.True(t, hard)
+
+	n, err = HardDelByCondition(dboper, s0, "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	total, err = QueryCountCtx(Unscoped(context.Background()), dboper, &softModel{}, "*", "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, total)
+}
+
+type softVersionModel struct {
+	ID        int64  `column:"id" pk:"y"`
+	Name      string `column:"name" size:"32"`
+	Version   int64  `column:"version" version:"y"`
+	UpdateAt  int64  `column:"update_at" autoUpdateTime:"y"`
+	DeletedAt int64  `column:"deleted_at" softDelete:"y"`
+}
+
+func (p *softVersionModel) TableName() string {
+	return "soft_version_model"
+}
+
+func TestSoftDeleteVersion(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&softVersionModel{})
+
+	createTables(t, &softVersionModel{})
+
+	dboper := &Op{pool: dbpool}
+	m := &softVersionModel{Name: "s0"}
+	assert.NoError(t, Add(dboper, m))
+	m.UpdateAt = 1
+	_, err = UpdateCtx(NoAutoUpdateTime(context.Background()), dboper, m)
+	assert.NoError(t, err)
+
+	// 软删除更新版本号及更新时间,持有旧版本的实体不能再更新
+	holder := *m
+	deleted, err := Del(dboper, m, m.ID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	e, err := GetCtx(Unscoped(context.Background()), dboper, &softVersionModel{}, m.ID)
+	assert.NoError(t, err)
+	stored := e.(*softVersionModel)
+	assert.EqualValues(t, 2, stored.Version)
+	assert.True(t, stored.UpdateAt > 1)
+
+	holder.Name = "stale"
+	_, err = Update(dboper, &holder)
+	assert.True(t, IsStaleEntity(err))
+
+	// 按主键更新时排除已删除的记录
+	stored.Name = "deleted"
+	_, err = Update(dboper, stored)
+	assert.True(t, IsStaleEntity(err))
+	ok, err := UpdateCtx(Unscoped(context.Background()), dboper, stored)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	restored, err := Restore(dboper, m, m.ID)
+	assert.NoError(t, err)
+	assert.True(t, restored)
+	e, err = Get(dboper, &softVersionModel{}, m.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, e.(*softVersionModel).Version)
+	assert.Equal(t, "deleted", e.(*softVersionModel).Name)
+}
@@ -0,0 +1,56 @@
+package orm
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// NewSQLiteDBPool build sqlite db pool from config,URL为数据库文件路径(或:memory:),Ext作为连接参数;
+// 需要引入驱动,如modernc.org/sqlite,使用github.com/mattn/go-sqlite3时需配置driverName为sqlite3
+func NewSQLiteDBPool(config *DBConfig) (*Pool, error) {
+	if config == nil {
+		return nil, &DBError{"Not found config", nil}
+	}
+
+	if len(config.URL) == 0 {
+		return nil, &DBError{"Invalid config", nil}
+	}
+
+	connectURL := config.URL
+	if len(config.Ext) > 0 {
+		keys := make([]string, 0, len(config.Ext))
+		for k := range config.Ext {
+			if k != "" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		params := make([]string, 0, len(keys))
+		for _, k := range keys {
+			params = append(params, k+"="+url.QueryEscape(config.Ext[k]))
+		}
+		sep := "?"
+		if strings.Contains(connectURL, "?") {
+			sep = "&"
+		}
+		connectURL = connectURL + sep + strings.Join(params, "&")
+	}
+
+	db, err := sql.Open(config.driverName(SQLiteDialect), connectURL)
+	if err != nil {
+		c.Errorf("Error on initializing database connection,%v", err)
+		return nil, &DBError{"Can't open connection", err}
+	}
+
+	c.Infof("db max idle connections:%d,max open connections:%d,ext:%v", config.MaxIdle, config.MaxConn, config.Ext)
+	setupDBLimits(db, config)
+	if err = setupCodecs(config); err != nil {
+		db.Close()
+		return nil, NewDBError(err, "Invalid config")
+	}
+	return withReplicas(NewPool(db, SQLiteDialect), config, NewSQLiteDBPool)
+}
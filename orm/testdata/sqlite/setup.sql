@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS "tt" (
+    "id" INTEGER NOT NULL PRIMARY KEY,
+    "name" varchar(64) DEFAULT NULL,
+    "name2" varchar(64) DEFAULT '',
+    "create_time" bigint DEFAULT NULL,
+    "f64" double DEFAULT NULL,
+    "conf" varchar(64),
+    "conf2" varchar(64) DEFAULT '',
+    "ver" bigint NOT NULL DEFAULT 0,
+    "age" bigint NOT NULL DEFAULT 0)
+--
+CREATE TABLE IF NOT EXISTS "tt_2" (
+    "id" INTEGER NOT NULL PRIMARY KEY,
+    "name" varchar(64) DEFAULT NULL,
+    "name2" varchar(64) DEFAULT '',
+    "create_time" bigint DEFAULT NULL,
+    "f64" double DEFAULT NULL,
+    "conf" varchar(64),
+    "conf2" varchar(64) DEFAULT '',
+    "ver" bigint NOT NULL DEFAULT 0,
+    "age" bigint NOT NULL DEFAULT 0)
+--
+CREATE TABLE IF NOT EXISTS "user_0" (
+    "id" INTEGER NOT NULL PRIMARY KEY,
+    "name" varchar(64) DEFAULT NULL,
+    "age" bigint NOT NULL DEFAULT 0,
+    "birthday" DATE)
+--
+CREATE TABLE IF NOT EXISTS "user_1" (
+    "id" INTEGER NOT NULL PRIMARY KEY,
+    "name" varchar(64) DEFAULT NULL,
+    "age" bigint NOT NULL DEFAULT 0,
+    "birthday" DATE)
+--
+CREATE TABLE IF NOT EXISTS "user_2" (
+    "id" INTEGER NOT NULL PRIMARY KEY,
+    "name" varchar(64) DEFAULT NULL,
+    "age" bigint NOT NULL DEFAULT 0,
+    "birthday" DATE)
@@ -0,0 +1,103 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+
+	c "github.com/d0ngw/go/common"
+)
+
+type noAutoUpdateTimeKey struct{}
+
+// NoAutoUpdateTime 返回不自动更新autoUpdateTime列的上下文,用于UpdateColumnsCtx等按条件更新的操作
+func NoAutoUpdateTime(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, noAutoUpdateTimeKey{}, true)
+}
+
+func isNoAutoUpdateTime(ctx context.Context) bool {
+	no, _ := ctx.Value(noAutoUpdateTimeKey{}).(bool)
+	return no
+}
+
+// checkAutoTimeField 检查自动时间字段的类型,支持int64(毫秒数,与common.UnixMills一致),time.Time及NullTime
+func checkAutoTimeField(field *metaField) error {
+	typ := field.structField.Type
+	if typ == timeType || typ == nullTimeType || typ.Kind() == reflect.Int64 {
+		return nil
+	}
+	return fmt.Errorf("unsupported auto time field type %s", typ)
+}
+
+// timeValue 时间对应字段类型的值
+func (p *metaField) timeValue(now time.Time) interface{} {
+	switch p.structField.Type {
+	case timeType:
+		return now
+	case nullTimeType:
+		return NullTime{Time: now, Valid: true}
+	}
+	return c.UnixMills(now)
+}
+
+// setTime 设置时间字段的值,onlyZero为true时只在字段为零值时设置
+func (p *metaField) setTime(ind reflect.Value, now time.Time, onlyZero bool) {
+	fv := ind.FieldByIndex(p.index)
+	if onlyZero && !fv.IsZero() {
+		return
+	}
+	if p.structField.Type.Kind() == reflect.Int64 {
+		fv.SetInt(c.UnixMills(now))
+		return
+	}
+	fv.Set(reflect.ValueOf(p.timeValue(now)))
+}
+
+// fillInsertTime 插入前为零值的autoCreateTime及autoUpdateTime字段设置当前时间
+func (p *meta) fillInsertTime(ind reflect.Value) {
+	if p.createTimeField == nil && p.updateTimeField == nil {
+		return
+	}
+	now := time.Now()
+	if p.createTimeField != nil {
+		p.createTimeField.setTime(ind, now, true)
+	}
+	if p.updateTimeField != nil {
+		p.updateTimeField.setTime(ind, now, true)
+	}
+}
+
+// fillUpdateTime 按实体更新前为autoUpdateTime字段设置当前时间
+func (p *meta) fillUpdateTime(ind reflect.Value) {
+	if p.updateTimeField != nil {
+		p.updateTimeField.setTime(ind, time.Now(), false)
+	}
+}
+
+// bumpUpdateTime 按条件更新时在columns之前加上autoUpdateTime列的更新,columns中已经设置该列或者ctx设置了NoAutoUpdateTime时不处理
+func (p *meta) bumpUpdateTime(ctx context.Context, executor *sqlExecutor, columns string, params []interface{}) (string, []interface{}) {
+	field := p.updateTimeField
+	if field == nil || isNoAutoUpdateTime(ctx) || field.assignedIn(columns) {
+		return columns, params
+	}
+	columns = executor.quote(field.column) + "=?," + columns
+	params = append([]interface{}{field.timeValue(time.Now())}, params...)
+	return columns, params
+}
+
+// assignedIn columns中是否有对该列的赋值
+func (p *metaField) assignedIn(columns string) bool {
+	if p.assignExpr == nil {
+		return false
+	}
+	return p.assignExpr.MatchString(columns)
+}
+
+func assignExpr(column string) *regexp.Regexp {
+	return regexp.MustCompile("(^|[\\s,])[`\"]?" + regexp.QuoteMeta(column) + "[`\"]?\\s*=")
+}
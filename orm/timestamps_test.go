@@ -0,0 +1,94 @@
+package orm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeModel struct {
+	ID       int64    `column:"id" pk:"y"`
+	Name     string   `column:"name" size:"32" unique:"y"`
+	CreateAt int64    `column:"create_at" autoCreateTime:"y"`
+	UpdateAt NullTime `column:"update_at" autoUpdateTime:"y"`
+}
+
+func (p *timeModel) TableName() string {
+	return "time_model"
+}
+
+type timeModel2 struct {
+	ID       int64     `column:"id" pk:"y"`
+	CreateAt time.Time `column:"create_at" autoCreateTime:"y"`
+}
+
+func (p *timeModel2) TableName() string {
+	return "time_model2"
+}
+
+func TestAssignExpr(t *testing.T) {
+	expr := assignExpr("update_at")
+	assert.True(t, expr.MatchString("update_at=?"))
+	assert.True(t, expr.MatchString("name=?, `update_at` = ?"))
+	assert.True(t, expr.MatchString(`"update_at"=now()`))
+	assert.False(t, expr.MatchString("last_update_at=?"))
+	assert.False(t, expr.MatchString("name=?"))
+}
+
+func TestAutoTime(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&timeModel{})
+	AddMeta(&timeModel2{})
+
+	assert.Panics(t, func() {
+		parseMeta(&struct {
+			timeModel
+			X string `column:"x" autoCreateTime:"y"`
+		}{})
+	})
+
+	m2 := &timeModel2{}
+	_, ind, _ := extract(m2)
+	findEntityMeta(m2).fillInsertTime(ind)
+	assert.False(t, m2.CreateAt.IsZero())
+
+	createTables(t, &timeModel{})
+
+	dboper := &Op{pool: dbpool}
+	before := time.Now().Add(-time.Second)
+	tm := &timeModel{Name: "t0"}
+	assert.NoError(t, Add(dboper, tm))
+	assert.True(t, tm.CreateAt >= before.UnixMilli())
+	assert.True(t, tm.UpdateAt.Valid)
+
+	created := tm.CreateAt
+	tm.UpdateAt = NullTime{}
+	_, err = Update(dboper, tm)
+	assert.NoError(t, err)
+	assert.True(t, tm.UpdateAt.Valid)
+	assert.Equal(t, created, tm.CreateAt)
+
+	_, err = dbpool.db.Exec("UPDATE time_model SET update_at = NULL")
+	assert.NoError(t, err)
+	_, err = UpdateColumnsCtx(NoAutoUpdateTime(context.Background()), dboper, tm, "name=?", "WHERE id = ?", "t1", tm.ID)
+	assert.NoError(t, err)
+	e, err := Get(dboper, tm, tm.ID)
+	assert.NoError(t, err)
+	assert.False(t, e.(*timeModel).UpdateAt.Valid)
+
+	n, err := UpdateColumns(dboper, tm, "name=?", "WHERE id = ?", "t2", tm.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	e, err = Get(dboper, tm, tm.ID)
+	assert.NoError(t, err)
+	assert.True(t, e.(*timeModel).UpdateAt.Valid)
+	assert.Equal(t, "t2", e.(*timeModel).Name)
+
+	upsertFields := filterFields(upsertUpdatePred, findEntityMeta(tm).fields)
+	assert.Len(t, upsertFields, 2)
+	for _, field := range upsertFields {
+		assert.NotEqual(t, "create_at", field.column)
+	}
+}
@@ -0,0 +1,93 @@
+package orm
+
+import (
+	"context"
+
+	c "github.com/d0ngw/go/common"
+)
+
+// toTyped 将[]Entity转换为[]T
+func toTyped[T Entity](entities []Entity) []T {
+	if entities == nil {
+		return nil
+	}
+	ret := make([]T, 0, len(entities))
+	for _, e := range entities {
+		ret = append(ret, e.(T))
+	}
+	return ret
+}
+
+// GetT 根据ID查询T,没有找到时返回T的零值
+func GetT[T Entity](op *Op, id interface{}) (T, error) {
+	return GetTCtx[T](op.Context(), op, id)
+}
+
+// GetTCtx 使用ctx根据ID查询T,没有找到时返回T的零值
+func GetTCtx[T Entity](ctx context.Context, op *Op, id interface{}) (ret T, err error) {
+	e, err := GetCtx(ctx, op, newEntity[T](), id)
+	if e == nil || err != nil {
+		return
+	}
+	return e.(T), nil
+}
+
+// QueryT 根据条件查询T
+func QueryT[T Entity](op *Op, condition string, params ...interface{}) ([]T, error) {
+	return QueryTCtx[T](op.Context(), op, condition, params...)
+}
+
+// QueryTCtx 使用ctx根据条件查询T
+func QueryTCtx[T Entity](ctx context.Context, op *Op, condition string, params ...interface{}) ([]T, error) {
+	entities, err := QueryCtx(ctx, op, newEntity[T](), condition, params...)
+	if err != nil {
+		return nil, err
+	}
+	return toTyped[T](entities), nil
+}
+
+// QueryColumnsT 根据条件查询T中columns指定的字段
+func QueryColumnsT[T Entity](op *Op, columns []string, condition string, params ...interface{}) ([]T, error) {
+	return QueryColumnsTCtx[T](op.Context(), op, columns, condition, params...)
+}
+
+// QueryColumnsTCtx 使用ctx根据条件查询T中columns指定的字段
+func QueryColumnsTCtx[T Entity](ctx context.Context, op *Op, columns []string, condition string, params ...interface{}) ([]T, error) {
+	entities, err := QueryColumnsCtx(ctx, op, newEntity[T](), columns, condition, params...)
+	if err != nil {
+		return nil, err
+	}
+	return toTyped[T](entities), nil
+}
+
+// QueryPageT 分页查询T,condition为WHERE条件,orderBy为排序语句(如"ORDER BY id DESC"),
+// page会先经过PageParam.Limit(0, 0)的修正
+func QueryPageT[T Entity](op *Op, page c.PageParam, condition string, orderBy string, params ...interface{}) (*c.PageResult[T], error) {
+	return QueryPageTCtx[T](op.Context(), op, page, condition, orderBy, params...)
+}
+
+// QueryPageTCtx 使用ctx分页查询T
+func QueryPageTCtx[T Entity](ctx context.Context, op *Op, page c.PageParam, condition string, orderBy string, params ...interface{}) (*c.PageResult[T], error) {
+	page.Limit(0, 0)
+	ret := &c.PageResult[T]{PageParam: page}
+
+	entity := newEntity[T]()
+	total, err := QueryCountCtx(ctx, op, entity, "*", condition, params...)
+	if err != nil {
+		return nil, err
+	}
+	ret.SetTotal(total)
+	ret.CalTotalPage()
+	if total <= int64(page.StartIndex()) {
+		ret.Items = []T{}
+		return ret, nil
+	}
+
+	pageCondition := condition + " " + orderBy + " " + op.Dialect().Limit(page.PageSize, page.StartIndex())
+	entities, err := QueryCtx(ctx, op, entity, pageCondition, params...)
+	if err != nil {
+		return nil, err
+	}
+	ret.Items = toTyped[T](entities)
+	return ret, nil
+}
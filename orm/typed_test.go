@@ -0,0 +1,56 @@
+package orm
+
+import (
+	"database/sql"
+	"testing"
+
+	c "github.com/d0ngw/go/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTyped(t *testing.T) {
+	defaultMetaReg.clean()
+	AddMeta(&tmodel{})
+
+	dboper := &Op{pool: dbpool}
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		tm := tmodel{Name: sql.NullString{String: "typed", Valid: true}, Age: int64(i)}
+		err := Add(dboper, &tm)
+		assert.NoError(t, err)
+		ids = append(ids, tm.ID)
+	}
+
+	tm, err := GetT[*tmodel](dboper, ids[0])
+	assert.NoError(t, err)
+	assert.NotNil(t, tm)
+	assert.Equal(t, ids[0], tm.ID)
+
+	tm, err = GetT[*tmodel](dboper, -1)
+	assert.NoError(t, err)
+	assert.Nil(t, tm)
+
+	l, err := QueryT[*tmodel](dboper, "WHERE name = ? ORDER BY age", "typed")
+	assert.NoError(t, err)
+	assert.Len(t, l, 5)
+	assert.EqualValues(t, 4, l[4].Age)
+
+	l, err = QueryColumnsT[*tmodel](dboper, []string{"id"}, "WHERE name = ?", "typed")
+	assert.NoError(t, err)
+	assert.Len(t, l, 5)
+	assert.False(t, l[0].Name.Valid)
+
+	page, err := QueryPageT[*tmodel](dboper, c.PageParam{Page: 2, PageSize: 2}, "WHERE name = ?", "ORDER BY age", "typed")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, page.Total)
+	assert.EqualValues(t, 3, page.TotalPage)
+	assert.Len(t, page.Items, 2)
+	assert.EqualValues(t, 2, page.Items[0].Age)
+
+	page, err = QueryPageT[*tmodel](dboper, c.PageParam{Page: 4, PageSize: 2}, "WHERE name = ?", "ORDER BY age", "typed")
+	assert.NoError(t, err)
+	assert.Empty(t, page.Items)
+
+	_, err = DelByCondition(dboper, &tmodel{}, "WHERE name = ?", "typed")
+	assert.NoError(t, err)
+}